@@ -17,24 +17,245 @@ limitations under the License.
 package main
 
 import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/vmware-tanzu/velero/pkg/plugin/framework"
 
 	"github.com/lubronzhan/velero-vmgroup-plugin/pkg/plugin"
 )
 
+// defaultVeleroNamespace is used when VELERO_NAMESPACE is not set
+const defaultVeleroNamespace = "velero"
+
+// enableBackupEnv and enableRestoreEnv are the environment variables disabling the backup or the
+// restore actions when set to "false", e.g. for a restore-only deployment. The delete action
+// cleans up after the restore actions, so it is registered with them.
+const (
+	enableBackupEnv  = "VMGROUP_PLUGIN_ENABLE_BACKUP"
+	enableRestoreEnv = "VMGROUP_PLUGIN_ENABLE_RESTORE"
+)
+
+// enabledActions are the kinds of actions the plugin registers
+type enabledActions struct {
+	backup  bool
+	restore bool
+}
+
 func main() {
-	framework.NewServer().
-		RegisterRestoreItemAction("lubronzhan.io/vm-restore", newVMRestorePlugin).
-		RegisterRestoreItemAction("lubronzhan.io/pvc-restore", newPVCRestorePlugin).
-		Serve()
+	enabled, err := enabledActionsFromEnv()
+	if err != nil {
+		logrus.WithError(err).Fatal("Invalid plugin configuration")
+	}
+	registerPlugins(framework.NewServer(), enabled).Serve()
+}
+
+// enabledActionsFromEnv returns the kinds of actions enabled by VMGROUP_PLUGIN_ENABLE_BACKUP and
+// VMGROUP_PLUGIN_ENABLE_RESTORE, both enabled by default
+func enabledActionsFromEnv() (enabledActions, error) {
+	backup, err := boolFromEnv(enableBackupEnv)
+	if err != nil {
+		return enabledActions{}, err
+	}
+	restore, err := boolFromEnv(enableRestoreEnv)
+	if err != nil {
+		return enabledActions{}, err
+	}
+	if !backup && !restore {
+		return enabledActions{}, errors.Errorf("%s and %s disable every action", enableBackupEnv, enableRestoreEnv)
+	}
+	return enabledActions{backup: backup, restore: restore}, nil
+}
+
+// boolFromEnv returns the boolean value of an environment variable, true when it is not set
+func boolFromEnv(name string) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return true, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid %s %q", name, value)
+	}
+	return enabled, nil
+}
+
+// registerPlugins registers the enabled actions of the plugin on a server
+func registerPlugins(server framework.Server, enabled enabledActions) framework.Server {
+	if enabled.backup {
+		server = server.
+			RegisterBackupItemAction(plugin.VMGroupBackupPluginName, newVMGroupBackupPlugin).
+			RegisterBackupItemAction(plugin.VMBackupPluginName, newVMBackupPlugin).
+			RegisterBackupItemAction(plugin.PVCBackupPluginName, newPVCBackupPlugin)
+	}
+	if enabled.restore {
+		server = server.
+			RegisterRestoreItemActionV2(plugin.VMRestorePluginName, newVMRestorePlugin).
+			RegisterRestoreItemActionV2(plugin.PVCRestorePluginName, newPVCRestorePlugin).
+			RegisterRestoreItemAction(plugin.VMGroupRestorePluginName, newVMGroupRestorePlugin).
+			RegisterRestoreItemAction(plugin.SecretRestorePluginName, newSecretRestorePlugin).
+			RegisterRestoreItemAction(plugin.VMImageRestorePluginName, newVMImageRestorePlugin).
+			RegisterDeleteItemAction(plugin.VMGroupDeletePluginName, newVMGroupDeletePlugin)
+	}
+	return server
+}
+
+func newVMGroupBackupPlugin(logger logrus.FieldLogger) (interface{}, error) {
+	restConfig, err := getRestConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kubernetes client config for vmgroup-backup plugin")
+	}
+
+	configMapClient, err := getConfigMapClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config map client for vmgroup-backup plugin")
+	}
+
+	action, err := plugin.NewVMGroupBackupItemAction(logger, restConfig, configMapClient)
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+func newVMBackupPlugin(logger logrus.FieldLogger) (interface{}, error) {
+	return plugin.NewVMBackupItemAction(logger), nil
 }
 
 func newVMRestorePlugin(logger logrus.FieldLogger) (interface{}, error) {
-	return plugin.NewVMRestoreItemAction(logger), nil
+	restConfig, err := getRestConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kubernetes client config for vm-restore plugin")
+	}
+
+	configMapClient, err := getConfigMapClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config map client for vm-restore plugin")
+	}
+
+	action, err := plugin.NewVMRestoreItemAction(logger, restConfig, configMapClient)
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+func newPVCBackupPlugin(logger logrus.FieldLogger) (interface{}, error) {
+	restConfig, err := getRestConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kubernetes client config for pvc-backup plugin")
+	}
+
+	action, err := plugin.NewPVCBackupItemAction(logger, restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
 }
 
 func newPVCRestorePlugin(logger logrus.FieldLogger) (interface{}, error) {
-	return plugin.NewPVCRestoreItemAction(logger), nil
+	restConfig, err := getRestConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kubernetes client config for pvc-restore plugin")
+	}
+
+	configMapClient, err := getConfigMapClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config map client for pvc-restore plugin")
+	}
+
+	action, err := plugin.NewPVCRestoreItemAction(logger, restConfig, configMapClient)
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+func newVMGroupRestorePlugin(logger logrus.FieldLogger) (interface{}, error) {
+	configMapClient, err := getConfigMapClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config map client for vmgroup-restore plugin")
+	}
+	return plugin.NewVMGroupRestoreItemAction(logger, configMapClient), nil
+}
+
+func newSecretRestorePlugin(logger logrus.FieldLogger) (interface{}, error) {
+	configMapClient, err := getConfigMapClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config map client for secret-restore plugin")
+	}
+	return plugin.NewSecretRestoreItemAction(logger, configMapClient), nil
+}
+
+func newVMImageRestorePlugin(logger logrus.FieldLogger) (interface{}, error) {
+	configMapClient, err := getConfigMapClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config map client for vmimage-restore plugin")
+	}
+	return plugin.NewVMImageRestoreItemAction(logger, configMapClient), nil
+}
+
+func newVMGroupDeletePlugin(logger logrus.FieldLogger) (interface{}, error) {
+	restConfig, err := getRestConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get kubernetes client config for vmgroup-delete plugin")
+	}
+
+	configMapClient, err := getConfigMapClient()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config map client for vmgroup-delete plugin")
+	}
+
+	action, err := plugin.NewVMGroupDeleteItemAction(logger, restConfig, configMapClient)
+	if err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// getConfigMapClient returns a client for the ConfigMaps in Velero's namespace,
+// where the plugin config ConfigMaps live
+func getConfigMapClient() (corev1client.ConfigMapInterface, error) {
+	restConfig, err := getRestConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kubernetes clientset")
+	}
+
+	namespace := os.Getenv("VELERO_NAMESPACE")
+	if namespace == "" {
+		namespace = defaultVeleroNamespace
+	}
+	return clientset.CoreV1().ConfigMaps(namespace), nil
+}
+
+// getRestConfig returns the in-cluster config, falling back to the
+// kubeconfig pointed to by the KUBECONFIG environment variable
+func getRestConfig() (*rest.Config, error) {
+	restConfig, err := rest.InClusterConfig()
+	if err == nil {
+		return restConfig, nil
+	}
+
+	kubeconfig := os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		return nil, errors.Wrap(err, "not running in a cluster and KUBECONFIG is not set")
+	}
+
+	restConfig, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load kubeconfig %s", kubeconfig)
+	}
+	return restConfig, nil
 }
@@ -0,0 +1,142 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework"
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+
+	"github.com/lubronzhan/velero-vmgroup-plugin/pkg/plugin"
+)
+
+// recordingServer records the actions registered on it by kind
+// Methods the plugin does not call are left to the embedded nil Server and panic.
+type recordingServer struct {
+	framework.Server
+	registered map[string]string
+}
+
+func (s *recordingServer) record(kind, name string, initializer common.HandlerInitializer) framework.Server {
+	if initializer != nil {
+		s.registered[name] = kind
+	}
+	return s
+}
+
+func (s *recordingServer) RegisterBackupItemAction(name string, initializer common.HandlerInitializer) framework.Server {
+	return s.record("BackupItemAction", name, initializer)
+}
+
+func (s *recordingServer) RegisterRestoreItemAction(name string, initializer common.HandlerInitializer) framework.Server {
+	return s.record("RestoreItemAction", name, initializer)
+}
+
+func (s *recordingServer) RegisterRestoreItemActionV2(name string, initializer common.HandlerInitializer) framework.Server {
+	return s.record("RestoreItemActionV2", name, initializer)
+}
+
+func (s *recordingServer) RegisterDeleteItemAction(name string, initializer common.HandlerInitializer) framework.Server {
+	return s.record("DeleteItemAction", name, initializer)
+}
+
+var (
+	backupActions = map[string]string{
+		plugin.VMGroupBackupPluginName: "BackupItemAction",
+		plugin.VMBackupPluginName:      "BackupItemAction",
+		plugin.PVCBackupPluginName:     "BackupItemAction",
+	}
+	restoreActions = map[string]string{
+		plugin.VMRestorePluginName:      "RestoreItemActionV2",
+		plugin.PVCRestorePluginName:     "RestoreItemActionV2",
+		plugin.VMGroupRestorePluginName: "RestoreItemAction",
+		plugin.SecretRestorePluginName:  "RestoreItemAction",
+		plugin.VMImageRestorePluginName: "RestoreItemAction",
+		plugin.VMGroupDeletePluginName:  "DeleteItemAction",
+	}
+)
+
+func TestRegisterPlugins(t *testing.T) {
+	allActions := maps.Clone(backupActions)
+	maps.Copy(allActions, restoreActions)
+
+	tests := []struct {
+		name     string
+		enabled  enabledActions
+		expected map[string]string
+	}{
+		{name: "all", enabled: enabledActions{backup: true, restore: true}, expected: allActions},
+		{name: "backup only", enabled: enabledActions{backup: true}, expected: backupActions},
+		{name: "restore only", enabled: enabledActions{restore: true}, expected: restoreActions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &recordingServer{registered: map[string]string{}}
+			registerPlugins(server, tt.enabled)
+
+			assert.Equal(t, tt.expected, server.registered)
+		})
+	}
+}
+
+func TestEnabledActionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		backup        string
+		restore       string
+		expected      enabledActions
+		expectedError string
+	}{
+		{name: "default", expected: enabledActions{backup: true, restore: true}},
+		{name: "backup only", restore: "false", expected: enabledActions{backup: true}},
+		{name: "restore only", backup: "false", restore: "true", expected: enabledActions{restore: true}},
+		{name: "invalid", backup: "sometimes", expectedError: `invalid VMGROUP_PLUGIN_ENABLE_BACKUP "sometimes"`},
+		{name: "none", backup: "false", restore: "0", expectedError: "disable every action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(enableBackupEnv, tt.backup)
+			t.Setenv(enableRestoreEnv, tt.restore)
+
+			enabled, err := enabledActionsFromEnv()
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, enabled)
+		})
+	}
+}
+
+func TestNewVMGroupBackupPluginWithoutClusterConfig(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBECONFIG", "")
+
+	action, err := newVMGroupBackupPlugin(logrus.New())
+	require.Error(t, err)
+	assert.Nil(t, action)
+	assert.Contains(t, err.Error(), "vmgroup-backup plugin")
+}
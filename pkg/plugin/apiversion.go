@@ -0,0 +1,203 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/pkg/errors"
+	vmopv1a4 "github.com/vmware-tanzu/vm-operator/api/v1alpha4"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// The plugins work with the v1alpha5 VM Operator types. Clusters that only serve v1alpha4
+// are supported by converting at the edges: items are converted according to their
+// apiVersion, and the client reads and writes v1alpha4 and converts to and from v1alpha5.
+
+// vmopV1alpha4APIVersion is the apiVersion of the VM Operator v1alpha4 API
+var vmopV1alpha4APIVersion = vmopv1a4.GroupVersion.String()
+
+// servesV1alpha5 reports whether the cluster serves the VM Operator v1alpha5 API
+func servesV1alpha5(restConfig *rest.Config) (bool, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to create discovery client")
+	}
+
+	if _, err := discoveryClient.ServerResourcesForGroupVersion(vmopv1.GroupVersion.String()); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to discover %s", vmopv1.GroupVersion)
+	}
+	return true, nil
+}
+
+// fromUnstructured converts an item to a v1alpha5 object, converting v1alpha4 items through their hub conversion
+// Items of another kind or API version are rejected, as the converter would silently drop their unknown fields.
+func fromUnstructured(obj map[string]interface{}, hub conversion.Hub) error {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	if expectedKind := reflect.TypeOf(hub).Elem().Name(); kind != expectedKind {
+		return errors.Errorf("unexpected kind %q, expected %s", kind, expectedKind)
+	}
+
+	switch apiVersion {
+	case vmopv1.GroupVersion.String():
+		return runtime.DefaultUnstructuredConverter.FromUnstructured(obj, hub)
+	case vmopV1alpha4APIVersion:
+	default:
+		return errors.Errorf("unsupported apiVersion %q of %s, expected %s or %s", apiVersion, kind, vmopv1.GroupVersion, vmopV1alpha4APIVersion)
+	}
+
+	spoke, err := spokeFor(hub)
+	if err != nil {
+		return err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, spoke); err != nil {
+		return err
+	}
+	return spoke.ConvertTo(hub)
+}
+
+// spokeFor returns an empty v1alpha4 object for a v1alpha5 object
+func spokeFor(hub runtime.Object) (interface {
+	client.Object
+	conversion.Convertible
+}, error) {
+	switch hub.(type) {
+	case *vmopv1.VirtualMachine:
+		return &vmopv1a4.VirtualMachine{}, nil
+	case *vmopv1.VirtualMachineGroup:
+		return &vmopv1a4.VirtualMachineGroup{}, nil
+	case *vmopv1.VirtualMachineImage:
+		return &vmopv1a4.VirtualMachineImage{}, nil
+	case *vmopv1.ClusterVirtualMachineImage:
+		return &vmopv1a4.ClusterVirtualMachineImage{}, nil
+	case *vmopv1.VirtualMachineService:
+		return &vmopv1a4.VirtualMachineService{}, nil
+	}
+	return nil, errors.Errorf("no v1alpha4 conversion for %T", hub)
+}
+
+// v1alpha4Client is a client for clusters that only serve the VM Operator v1alpha4 API
+// Reads and writes of v1alpha5 objects go to v1alpha4 and are converted, other objects pass through.
+type v1alpha4Client struct {
+	client.Client
+}
+
+// Get reads the v1alpha4 version of a v1alpha5 object and converts it
+func (c *v1alpha4Client) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	hub, isHub := obj.(conversion.Hub)
+	if !isHub {
+		return c.Client.Get(ctx, key, obj, opts...)
+	}
+
+	spoke, err := spokeFor(hub)
+	if err != nil {
+		return err
+	}
+	if err := c.Client.Get(ctx, key, spoke, opts...); err != nil {
+		return err
+	}
+	return spoke.ConvertTo(hub)
+}
+
+// List lists the v1alpha4 VirtualMachines, VirtualMachineGroups and VirtualMachineServices and
+// converts them
+func (c *v1alpha4Client) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	var err error
+	switch hubList := list.(type) {
+	case *vmopv1.VirtualMachineList:
+		spokeList := &vmopv1a4.VirtualMachineList{}
+		if err := c.Client.List(ctx, spokeList, opts...); err != nil {
+			return err
+		}
+		hubList.ListMeta = spokeList.ListMeta
+		hubList.Items, err = convertItems[vmopv1a4.VirtualMachine, vmopv1.VirtualMachine](spokeList.Items)
+		return err
+	case *vmopv1.VirtualMachineGroupList:
+		spokeList := &vmopv1a4.VirtualMachineGroupList{}
+		if err := c.Client.List(ctx, spokeList, opts...); err != nil {
+			return err
+		}
+		hubList.ListMeta = spokeList.ListMeta
+		hubList.Items, err = convertItems[vmopv1a4.VirtualMachineGroup, vmopv1.VirtualMachineGroup](spokeList.Items)
+		return err
+	case *vmopv1.VirtualMachineServiceList:
+		spokeList := &vmopv1a4.VirtualMachineServiceList{}
+		if err := c.Client.List(ctx, spokeList, opts...); err != nil {
+			return err
+		}
+		hubList.ListMeta = spokeList.ListMeta
+		hubList.Items, err = convertItems[vmopv1a4.VirtualMachineService, vmopv1.VirtualMachineService](spokeList.Items)
+		return err
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+// convertItems converts the v1alpha4 items of a list to v1alpha5, one by one with the same
+// conversion as a single object
+func convertItems[S, H any, SP interface {
+	*S
+	conversion.Convertible
+}, HP interface {
+	*H
+	conversion.Hub
+}](spokes []S) ([]H, error) {
+	hubs := make([]H, len(spokes))
+	for i := range spokes {
+		if err := SP(&spokes[i]).ConvertTo(HP(&hubs[i])); err != nil {
+			return nil, err
+		}
+	}
+	return hubs, nil
+}
+
+// Patch sends the patch of a v1alpha5 object to its v1alpha4 version
+// The patch data is computed from the v1alpha5 object, so only changes common to both versions apply.
+func (c *v1alpha4Client) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	hub, isHub := obj.(conversion.Hub)
+	if !isHub {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+
+	spoke, err := spokeFor(hub)
+	if err != nil {
+		return err
+	}
+	if err := spoke.ConvertFrom(hub); err != nil {
+		return err
+	}
+	if err := c.Client.Patch(ctx, spoke, client.RawPatch(patch.Type(), data), opts...); err != nil {
+		return err
+	}
+	return spoke.ConvertTo(hub)
+}
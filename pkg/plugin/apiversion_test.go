@@ -0,0 +1,195 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1a4 "github.com/vmware-tanzu/vm-operator/api/v1alpha4"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// newV1alpha4VM returns a v1alpha4 VirtualMachine in the test namespace
+func newV1alpha4VM(name, className string) *vmopv1a4.VirtualMachine {
+	return &vmopv1a4.VirtualMachine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: vmopv1a4.GroupVersion.String(), Kind: "VirtualMachine"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name},
+		Spec:       vmopv1a4.VirtualMachineSpec{ClassName: className},
+	}
+}
+
+// newV1alpha4VMGroup returns a v1alpha4 VirtualMachineGroup in the test namespace booting the named VMs
+func newV1alpha4VMGroup(name string, vmNames ...string) *vmopv1a4.VirtualMachineGroup {
+	bootOrderGroup := vmopv1a4.VirtualMachineGroupBootOrderGroup{}
+	for _, vmName := range vmNames {
+		bootOrderGroup.Members = append(bootOrderGroup.Members, vmopv1a4.GroupMember{Name: vmName, Kind: "VirtualMachine"})
+	}
+	return &vmopv1a4.VirtualMachineGroup{
+		TypeMeta:   metav1.TypeMeta{APIVersion: vmopv1a4.GroupVersion.String(), Kind: "VirtualMachineGroup"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name},
+		Spec:       vmopv1a4.VirtualMachineGroupSpec{BootOrder: []vmopv1a4.VirtualMachineGroupBootOrderGroup{bootOrderGroup}},
+	}
+}
+
+func TestFromUnstructured(t *testing.T) {
+	tests := []struct {
+		name        string
+		obj         client.Object
+		expectedErr string
+	}{
+		{name: "v1alpha5", obj: newVMGroup("group-1", "vm-1", "vm-2")},
+		{name: "v1alpha4", obj: newV1alpha4VMGroup("group-1", "vm-1", "vm-2")},
+		{name: "mismatched kind", obj: newVM("group-1"), expectedErr: `unexpected kind "VirtualMachine", expected VirtualMachineGroup`},
+		{
+			name: "unsupported apiVersion",
+			obj: func() client.Object {
+				vmGroup := newVMGroup("group-1")
+				vmGroup.APIVersion = "vmoperator.vmware.com/v1alpha3"
+				return vmGroup
+			}(),
+			expectedErr: `unsupported apiVersion "vmoperator.vmware.com/v1alpha3"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vmGroup := &vmopv1.VirtualMachineGroup{}
+			err := fromUnstructured(toUnstructured(t, tt.obj).Object, vmGroup)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "group-1", vmGroup.Name)
+			assert.Equal(t, []vmopv1.GroupMember{{Name: "vm-1", Kind: "VirtualMachine"}, {Name: "vm-2", Kind: "VirtualMachine"}}, groupMembers(vmGroup, true))
+		})
+	}
+}
+
+func TestExecuteUnexpectedGroupItem(t *testing.T) {
+	unsupported := newVMGroup("group-1", "vm-1")
+	unsupported.APIVersion = "vmoperator.vmware.com/v1alpha3"
+	foreign := newVMGroup("group-1", "vm-1")
+	foreign.APIVersion = "example.com/v1"
+
+	tests := []struct {
+		name        string
+		obj         client.Object
+		expectedErr string
+	}{
+		{name: "mismatched kind", obj: newVM("group-1"), expectedErr: `unexpected kind "VirtualMachine", expected VirtualMachineGroup`},
+		{name: "unsupported version", obj: unsupported, expectedErr: `unsupported apiVersion "vmoperator.vmware.com/v1alpha3"`},
+		{name: "mismatched group", obj: foreign, expectedErr: `unsupported apiVersion "example.com/v1"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _ := newTestBackupAction(t, nil, newVM("vm-1"))
+
+			_, additionalItems, err := action.Execute(toUnstructured(t, tt.obj), &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+			assert.ErrorContains(t, err, tt.expectedErr)
+			assert.Empty(t, additionalItems)
+		})
+	}
+}
+
+func TestExecuteV1alpha4Group(t *testing.T) {
+	c := &v1alpha4Client{Client: newFakeClient(t, newV1alpha4VM("vm-1", "best-effort-small"), newV1alpha4VM("vm-2", "best-effort-small"))}
+	action, _ := newTestBackupActionWithClient(t, nil, c)
+
+	item := toUnstructured(t, newV1alpha4VMGroup("group-1", "vm-1", "vm-2"))
+	updatedItem, additionalItems, err := action.Execute(item, &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+	require.NoError(t, err)
+	assert.Equal(t, item, updatedItem)
+	assert.Equal(t, []string{"vm-1", "vm-2"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, []string{"best-effort-small"}, namesOf(additionalItems, "virtualmachineclasses"))
+}
+
+func TestVMRestoreV1alpha4Item(t *testing.T) {
+	vm := newV1alpha4VM("vm-1", "best-effort-small")
+	vm.Spec.GroupName = "group-1"
+	vm.Spec.InstanceUUID = "instance-uuid"
+
+	action, _ := newTestVMRestoreAction(t, nil)
+	output, err := action.Execute(newRestoreInput(t, vm))
+	require.NoError(t, err)
+
+	obj := output.UpdatedItem.UnstructuredContent()
+	assert.Equal(t, vmopv1a4.GroupVersion.String(), nestedString(obj, "apiVersion"))
+	assert.Empty(t, nestedString(obj, "spec", "instanceUUID"))
+	assert.Equal(t, []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")}, output.AdditionalItems)
+}
+
+func TestV1alpha4Client(t *testing.T) {
+	c := &v1alpha4Client{Client: newFakeClient(t, newV1alpha4VM("vm-1", "best-effort-small"), newV1alpha4VMGroup("group-1", "vm-1"))}
+	ctx := context.Background()
+
+	vm := &vmopv1.VirtualMachine{}
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: testNamespace, Name: "vm-1"}, vm))
+	assert.Equal(t, "best-effort-small", vm.Spec.ClassName)
+}
+
+func TestV1alpha4ClientList(t *testing.T) {
+	service := &vmopv1a4.VirtualMachineService{
+		TypeMeta:   metav1.TypeMeta{APIVersion: vmopv1a4.GroupVersion.String(), Kind: "VirtualMachineService"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "web"},
+		Spec: vmopv1a4.VirtualMachineServiceSpec{
+			Type:     vmopv1a4.VirtualMachineServiceTypeLoadBalancer,
+			Selector: map[string]string{"app": "web"},
+		},
+	}
+	c := &v1alpha4Client{Client: newFakeClient(t, newV1alpha4VM("vm-1", "best-effort-small"), newV1alpha4VMGroup("group-1", "vm-1"), service)}
+	ctx := context.Background()
+
+	t.Run("VirtualMachines", func(t *testing.T) {
+		vmList := &vmopv1.VirtualMachineList{}
+		require.NoError(t, c.List(ctx, vmList, client.InNamespace(testNamespace)))
+		require.Len(t, vmList.Items, 1)
+		assert.Equal(t, "vm-1", vmList.Items[0].Name)
+		assert.Equal(t, "best-effort-small", vmList.Items[0].Spec.ClassName)
+	})
+
+	t.Run("VirtualMachineGroups", func(t *testing.T) {
+		vmGroupList := &vmopv1.VirtualMachineGroupList{}
+		require.NoError(t, c.List(ctx, vmGroupList, client.InNamespace(testNamespace)))
+		require.Len(t, vmGroupList.Items, 1)
+		assert.Equal(t, []vmopv1.GroupMember{{Name: "vm-1", Kind: "VirtualMachine"}}, groupMembers(&vmGroupList.Items[0], true))
+	})
+
+	t.Run("VirtualMachineServices", func(t *testing.T) {
+		serviceList := &vmopv1.VirtualMachineServiceList{}
+		require.NoError(t, c.List(ctx, serviceList, client.InNamespace(testNamespace)))
+		require.Len(t, serviceList.Items, 1)
+		assert.Equal(t, "web", serviceList.Items[0].Name)
+		assert.Equal(t, map[string]string{"app": "web"}, serviceList.Items[0].Spec.Selector)
+	})
+
+	t.Run("other kinds pass through", func(t *testing.T) {
+		pvcList := &corev1.PersistentVolumeClaimList{}
+		require.NoError(t, c.List(ctx, pvcList, client.InNamespace(testNamespace)))
+		assert.Empty(t, pvcList.Items)
+	})
+}
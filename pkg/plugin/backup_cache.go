@@ -0,0 +1,62 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/lru"
+)
+
+// maxCachedBackups is how many backups a backupCache holds the state of
+// It leaves room for several backups running at the same time. The state is only an
+// optimization: a running backup whose state is evicted gets fresh state, which costs it repeated
+// API requests but not correctness, as Velero skips the items it already backed up.
+const maxCachedBackups = 32
+
+// backupCache holds the state a backup item action keeps for each backup run, e.g. the groups it
+// already expanded. Backup item actions are not told when a backup completes, so the state of
+// the least recently used backups is evicted rather than removed, keeping a long-running plugin
+// process from growing without bound.
+type backupCache struct {
+	mu      sync.Mutex
+	backups *lru.Cache
+}
+
+// newBackupCache returns an empty backupCache
+func newBackupCache() *backupCache {
+	return &backupCache{backups: lru.New(maxCachedBackups)}
+}
+
+// get returns the state of a backup, created with newState on its first use
+// Backups without a UID cannot be told apart, so they get fresh state on every call.
+func (c *backupCache) get(backupUID types.UID, newState func() any) any {
+	if backupUID == "" {
+		return newState()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if state, found := c.backups.Get(backupUID); found {
+		return state
+	}
+	state := newState()
+	c.backups.Add(backupUID, state)
+	return state
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestBackupCache(t *testing.T) {
+	cache := newBackupCache()
+	newCount := 0
+	newState := func() any {
+		newCount++
+		return new(int)
+	}
+
+	first := cache.get("backup-uid-1", newState)
+	assert.Same(t, first, cache.get("backup-uid-1", newState))
+	assert.Equal(t, 1, newCount)
+
+	// Backups without a UID never share state
+	cache.get("", newState)
+	cache.get("", newState)
+	assert.Equal(t, 3, newCount)
+
+	// The least recently used backup is evicted once maxCachedBackups newer backups are cached
+	for i := range maxCachedBackups {
+		cache.get(types.UID(fmt.Sprintf("backup-uid-%d", i+2)), newState)
+	}
+	newCount = 0
+	cache.get("backup-uid-1", newState)
+	assert.Equal(t, 1, newCount)
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	vmopv1a4 "github.com/vmware-tanzu/vm-operator/api/v1alpha4"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+)
+
+// Names the plugins are registered under. The plugin config ConfigMaps are
+// looked up by these names, e.g. a ConfigMap labeled
+// "velero.io/plugin-config" and "lubronzhan.io/pvc-restore: RestoreItemAction"
+const (
+	VMGroupBackupPluginName  = "lubronzhan.io/vmgroup-backup"
+	VMBackupPluginName       = "lubronzhan.io/vm-backup"
+	VMRestorePluginName      = "lubronzhan.io/vm-restore"
+	PVCBackupPluginName      = "lubronzhan.io/pvc-backup"
+	PVCRestorePluginName     = "lubronzhan.io/pvc-restore"
+	VMGroupRestorePluginName = "lubronzhan.io/vmgroup-restore"
+	SecretRestorePluginName  = "lubronzhan.io/secret-restore"
+	VMImageRestorePluginName = "lubronzhan.io/vmimage-restore"
+	VMGroupDeletePluginName  = "lubronzhan.io/vmgroup-delete"
+)
+
+// vmoperatorGroup is the API group of the VM Operator resources
+const vmoperatorGroup = "vmoperator.vmware.com"
+
+// encryptionGroup is the API group of the VM Operator EncryptionClasses
+const encryptionGroup = "encryption.vmware.com"
+
+// The "<resource>.<group>" names the plugins select their resources by in AppliesTo
+// Velero resolves them against discovery, so they must be the plural resource names.
+const (
+	virtualMachinesResource             = "virtualmachines." + vmoperatorGroup
+	virtualMachineGroupsResource        = "virtualmachinegroups." + vmoperatorGroup
+	virtualMachineImagesResource        = "virtualmachineimages." + vmoperatorGroup
+	clusterVirtualMachineImagesResource = "clustervirtualmachineimages." + vmoperatorGroup
+)
+
+// newScheme returns a scheme with the types the plugins read and create: the core types for
+// PVCs and secrets, SelfSubjectAccessReviews and both VM Operator API versions
+// Every client gets its own scheme, so the plugins never mutate the global client-go scheme.
+func newScheme() (*runtime.Scheme, error) {
+	s := runtime.NewScheme()
+	if err := corev1.AddToScheme(s); err != nil {
+		return nil, errors.Wrap(err, "failed to add core types to scheme")
+	}
+	if err := authorizationv1.AddToScheme(s); err != nil {
+		return nil, errors.Wrap(err, "failed to add authorization types to scheme")
+	}
+	if err := vmopv1.AddToScheme(s); err != nil {
+		return nil, errors.Wrap(err, "failed to add VM Operator types to scheme")
+	}
+	if err := vmopv1a4.AddToScheme(s); err != nil {
+		return nil, errors.Wrap(err, "failed to add VM Operator v1alpha4 types to scheme")
+	}
+	return s, nil
+}
+
+// newClient creates a controller-runtime client that knows the VM Operator types
+// On clusters only serving v1alpha4 the client converts VM Operator objects to and from v1alpha5.
+func newClient(restConfig *rest.Config) (client.Client, error) {
+	s, err := newScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(restConfig, client.Options{Scheme: s})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create kubernetes client")
+	}
+
+	servesV1alpha5, err := servesV1alpha5(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !servesV1alpha5 {
+		return &v1alpha4Client{Client: c}, nil
+	}
+	return c, nil
+}
+
+// kubeconfigConfigKey and kubeContextConfigKey are the plugin config keys pointing a plugin
+// at a kubeconfig file and a context in it instead of the in-cluster config
+const (
+	kubeconfigConfigKey  = "kubeconfig"
+	kubeContextConfigKey = "kubeContext"
+)
+
+// loadKubeconfig builds a rest config from a kubeconfig file and an optional context
+func loadKubeconfig(path, context string) (*rest.Config, error) {
+	loadingRules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: path}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: context}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+}
+
+// restConfigFromPluginConfig returns the rest config selected by the kubeconfig and kubeContext
+// keys of the plugin config, or defaultConfig when no kubeconfig is configured
+func restConfigFromPluginConfig(config map[string]string, defaultConfig *rest.Config) (*rest.Config, error) {
+	path := strings.TrimSpace(config[kubeconfigConfigKey])
+	if path == "" {
+		return defaultConfig, nil
+	}
+
+	restConfig, err := loadKubeconfig(path, strings.TrimSpace(config[kubeContextConfigKey]))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load kubeconfig %s", path)
+	}
+	return restConfig, nil
+}
+
+// getPluginConfig returns the data of the ConfigMap configuring the named plugin
+// An empty map is returned when there is no client or no ConfigMap for the plugin
+func getPluginConfig(client corev1client.ConfigMapInterface, kind common.PluginKind, name string) (map[string]string, error) {
+	configMap, err := getPluginConfigMap(client, kind, name)
+	if err != nil {
+		return nil, err
+	}
+	if configMap == nil || configMap.Data == nil {
+		return map[string]string{}, nil
+	}
+
+	return configMap.Data, nil
+}
+
+// getPluginConfigMap returns the ConfigMap configuring the named plugin
+// Nil is returned when there is no client or no ConfigMap for the plugin.
+func getPluginConfigMap(client corev1client.ConfigMapInterface, kind common.PluginKind, name string) (*corev1.ConfigMap, error) {
+	if client == nil {
+		return nil, nil
+	}
+	return common.GetPluginConfig(kind, name, client)
+}
+
+// parseList splits a comma-separated config value, dropping empty entries
+func parseList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// getBool returns the boolean value of a config key, or defaultValue when the key is not set
+func getBool(config map[string]string, key string, defaultValue bool) (bool, error) {
+	value, found := config[key]
+	if !found || strings.TrimSpace(value) == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, errors.Wrapf(err, "invalid %s config", key)
+	}
+	return parsed, nil
+}
+
+// getInt returns the integer value of a config key, or defaultValue when the key is not set
+func getInt(config map[string]string, key string, defaultValue int) (int, error) {
+	value, found := config[key]
+	if !found || strings.TrimSpace(value) == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s config", key)
+	}
+	return parsed, nil
+}
+
+// getFloat returns the floating point value of a config key, or defaultValue when the key is not set
+func getFloat(config map[string]string, key string, defaultValue float64) (float64, error) {
+	value, found := config[key]
+	if !found || strings.TrimSpace(value) == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s config", key)
+	}
+	return parsed, nil
+}
+
+// getDuration returns the duration value of a config key, or defaultValue when the key is not set
+func getDuration(config map[string]string, key string, defaultValue time.Duration) (time.Duration, error) {
+	value, found := config[key]
+	if !found || strings.TrimSpace(value) == "" {
+		return defaultValue, nil
+	}
+
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s config", key)
+	}
+	return parsed, nil
+}
+
+// restoreLabelConfigKey is the plugin config key holding the "key=value" label set on the
+// items a restore plugin restores. An empty value disables the label.
+const restoreLabelConfigKey = "restoreLabel"
+
+// defaultRestoreLabel is used when restoreLabel is not configured
+const defaultRestoreLabel = "restored-by=velero-vmgroup-plugin"
+
+// restoreLabel returns the key and value of the label configured with restoreLabel, and an empty
+// key when the label is disabled
+func restoreLabel(config map[string]string) (string, string, error) {
+	value, found := config[restoreLabelConfigKey]
+	if !found {
+		value = defaultRestoreLabel
+	}
+	if value = strings.TrimSpace(value); value == "" {
+		return "", "", nil
+	}
+
+	key, labelValue, _ := strings.Cut(value, "=")
+	key, labelValue = strings.TrimSpace(key), strings.TrimSpace(labelValue)
+	if errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(labelValue)...); len(errs) > 0 {
+		return "", "", errors.Errorf("invalid %s config %q: %s", restoreLabelConfigKey, value, strings.Join(errs, ", "))
+	}
+	return key, labelValue, nil
+}
+
+// setRestoreLabel sets the label configured with restoreLabel on a restored item
+// It reports whether the label was set.
+func setRestoreLabel(item *unstructured.Unstructured, config map[string]string) (bool, error) {
+	key, labelValue, err := restoreLabel(config)
+	if err != nil || key == "" {
+		return false, err
+	}
+
+	labels := item.GetLabels()
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[key] = labelValue
+	item.SetLabels(labels)
+	return true, nil
+}
+
+// clearManagedFieldsConfigKey is the plugin config key that, unless set to "false", removes the
+// metadata.managedFields written by the source cluster's controllers from restored items
+const clearManagedFieldsConfigKey = "clearManagedFields"
+
+// clearManagedFields removes metadata.managedFields from a restored item unless clearManagedFields is disabled
+// Items without managed fields are left as they are, so it can run more than once.
+func clearManagedFields(item *unstructured.Unstructured, config map[string]string, log logrus.FieldLogger) error {
+	enabled, err := getBool(config, clearManagedFieldsConfigKey, true)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+	if _, found, _ := unstructured.NestedFieldNoCopy(item.Object, "metadata", "managedFields"); found {
+		log.Info("Removing metadata.managedFields")
+		unstructured.RemoveNestedField(item.Object, "metadata", "managedFields")
+	}
+	return nil
+}
+
+// parseMapping parses a comma-separated list of "from:to" pairs into a map
+func parseMapping(value string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, entry := range parseList(value) {
+		from, to, found := strings.Cut(entry, ":")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !found || from == "" || to == "" {
+			return nil, errors.Errorf("invalid mapping entry %q, expected from:to", entry)
+		}
+		mapping[from] = to
+	}
+	return mapping, nil
+}
+
+// matchesAnyKey reports whether key matches one of the patterns
+// A pattern ending in "*" matches every key with that prefix, other patterns must match exactly
+func matchesAnyKey(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, isWildcard := strings.CutSuffix(pattern, "*"); isWildcard {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
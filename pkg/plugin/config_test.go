@@ -0,0 +1,353 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1a4 "github.com/vmware-tanzu/vm-operator/api/v1alpha4"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// testKubeconfig has a context for each of two clusters, the first being the current one
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: production
+  cluster:
+    server: https://production.example.com:6443
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+users:
+- name: velero
+  user:
+    token: test-token
+contexts:
+- name: production
+  context:
+    cluster: production
+    user: velero
+- name: staging
+  context:
+    cluster: staging
+    user: velero
+current-context: production
+`
+
+func TestRestConfigFromPluginConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(path, []byte(testKubeconfig), 0o600))
+
+	defaultConfig := &rest.Config{Host: "https://in-cluster.example.com"}
+
+	tests := []struct {
+		name         string
+		config       map[string]string
+		expectedHost string
+		expectedErr  string
+	}{
+		{
+			name:         "in-cluster by default",
+			expectedHost: "https://in-cluster.example.com",
+		},
+		{
+			name:         "current context of the kubeconfig",
+			config:       map[string]string{kubeconfigConfigKey: path},
+			expectedHost: "https://production.example.com:6443",
+		},
+		{
+			name:         "configured context",
+			config:       map[string]string{kubeconfigConfigKey: path, kubeContextConfigKey: "staging"},
+			expectedHost: "https://staging.example.com:6443",
+		},
+		{
+			name:        "unknown context",
+			config:      map[string]string{kubeconfigConfigKey: path, kubeContextConfigKey: "test"},
+			expectedErr: "failed to load kubeconfig",
+		},
+		{
+			name:        "missing kubeconfig",
+			config:      map[string]string{kubeconfigConfigKey: filepath.Join(t.TempDir(), "missing")},
+			expectedErr: "failed to load kubeconfig",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restConfig, err := restConfigFromPluginConfig(tt.config, defaultConfig)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedHost, restConfig.Host)
+		})
+	}
+}
+
+func TestRestoreLabel(t *testing.T) {
+	type executeFunc func(*veleroplugin.RestoreItemActionExecuteInput) (*veleroplugin.RestoreItemActionExecuteOutput, error)
+
+	actions := []struct {
+		name   string
+		obj    runtime.Object
+		action func(t *testing.T, config map[string]string) executeFunc
+	}{
+		{
+			name: "vm-restore",
+			obj:  newVM("vm-1"),
+			action: func(t *testing.T, config map[string]string) executeFunc {
+				action, _ := newTestVMRestoreAction(t, config)
+				return action.Execute
+			},
+		},
+		{
+			name: "pvc-restore",
+			obj:  newPVC("data"),
+			action: func(t *testing.T, config map[string]string) executeFunc {
+				log, _ := newTestLogger()
+				return NewPVCRestoreItemActionWithClient(log, newFakeClient(t), newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName, config)).Execute
+			},
+		},
+		{
+			name: "vmgroup-restore",
+			obj:  newVMGroup("group-1"),
+			action: func(t *testing.T, config map[string]string) executeFunc {
+				return newTestGroupRestoreAction(config).Execute
+			},
+		},
+		{
+			name: "secret-restore",
+			obj:  newSecret("cloud-config", vmOwnerReference),
+			action: func(t *testing.T, config map[string]string) executeFunc {
+				log, _ := newTestLogger()
+				return NewSecretRestoreItemAction(log, newConfigMapClient(common.PluginKindRestoreItemAction, SecretRestorePluginName, config)).Execute
+			},
+		},
+		{
+			name: "vmimage-restore",
+			obj:  newVMImage("photon-5"),
+			action: func(t *testing.T, config map[string]string) executeFunc {
+				return newTestVMImageRestoreAction(config).Execute
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		config      map[string]string
+		expected    map[string]string
+		expectedErr string
+	}{
+		{name: "default", expected: map[string]string{"restored-by": "velero-vmgroup-plugin"}},
+		{name: "configured", config: map[string]string{restoreLabelConfigKey: "example.com/restore=cutover-1"}, expected: map[string]string{"example.com/restore": "cutover-1"}},
+		{name: "disabled", config: map[string]string{restoreLabelConfigKey: ""}},
+		{name: "invalid", config: map[string]string{restoreLabelConfigKey: "restored by=plugin"}, expectedErr: "invalid restoreLabel config"},
+	}
+
+	for _, action := range actions {
+		for _, tt := range tests {
+			t.Run(action.name+" "+tt.name, func(t *testing.T) {
+				output, err := action.action(t, tt.config)(newRestoreInput(t, action.obj))
+				if tt.expectedErr != "" {
+					assert.ErrorContains(t, err, tt.expectedErr)
+					return
+				}
+				require.NoError(t, err)
+
+				restored := &unstructured.Unstructured{Object: output.UpdatedItem.UnstructuredContent()}
+				assert.Equal(t, tt.expected, restored.GetLabels())
+			})
+		}
+	}
+}
+
+func TestClearManagedFields(t *testing.T) {
+	type executeFunc func(*veleroplugin.RestoreItemActionExecuteInput) (*veleroplugin.RestoreItemActionExecuteOutput, error)
+
+	managedFields := []metav1.ManagedFieldsEntry{{
+		Manager:    "vmware-system-vmop",
+		Operation:  metav1.ManagedFieldsOperationUpdate,
+		APIVersion: "vmoperator.vmware.com/v1alpha5",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:status":{}}`)},
+	}}
+	vm := newVM("vm-1")
+	vm.ManagedFields = managedFields
+	pvc := newPVC("data")
+	pvc.ManagedFields = managedFields
+
+	actions := []struct {
+		name   string
+		obj    runtime.Object
+		action func(t *testing.T, config map[string]string) executeFunc
+	}{
+		{
+			name: "vm-restore",
+			obj:  vm,
+			action: func(t *testing.T, config map[string]string) executeFunc {
+				action, _ := newTestVMRestoreAction(t, config)
+				return action.Execute
+			},
+		},
+		{
+			name: "pvc-restore",
+			obj:  pvc,
+			action: func(t *testing.T, config map[string]string) executeFunc {
+				log, _ := newTestLogger()
+				return NewPVCRestoreItemActionWithClient(log, newFakeClient(t), newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName, config)).Execute
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		config      map[string]string
+		expectKept  bool
+		expectedErr string
+	}{
+		{name: "default"},
+		{name: "enabled", config: map[string]string{clearManagedFieldsConfigKey: "true"}},
+		{name: "disabled", config: map[string]string{clearManagedFieldsConfigKey: "false"}, expectKept: true},
+		{name: "invalid", config: map[string]string{clearManagedFieldsConfigKey: "maybe"}, expectedErr: "invalid clearManagedFields config"},
+	}
+
+	for _, action := range actions {
+		for _, tt := range tests {
+			t.Run(action.name+" "+tt.name, func(t *testing.T) {
+				output, err := action.action(t, tt.config)(newRestoreInput(t, action.obj))
+				if tt.expectedErr != "" {
+					assert.ErrorContains(t, err, tt.expectedErr)
+					return
+				}
+				require.NoError(t, err)
+
+				restored := &unstructured.Unstructured{Object: output.UpdatedItem.UnstructuredContent()}
+				if tt.expectKept {
+					assert.Len(t, restored.GetManagedFields(), 1)
+				} else {
+					_, found, _ := unstructured.NestedFieldNoCopy(restored.Object, "metadata", "managedFields")
+					assert.False(t, found, "metadata.managedFields should be removed")
+				}
+
+				// Restoring the output again changes nothing
+				again, err := action.action(t, tt.config)(&veleroplugin.RestoreItemActionExecuteInput{
+					Item:           restored,
+					ItemFromBackup: restored,
+					Restore:        newRestoreInput(t, action.obj).Restore,
+				})
+				require.NoError(t, err)
+				assert.Equal(t, restored.GetManagedFields(), (&unstructured.Unstructured{Object: again.UpdatedItem.UnstructuredContent()}).GetManagedFields())
+			})
+		}
+	}
+}
+
+func TestAppliesTo(t *testing.T) {
+	log, _ := newTestLogger()
+	configMapClient := newConfigMapClient(common.PluginKindRestoreItemAction, VMRestorePluginName, nil)
+	c := newFakeClient(t)
+
+	virtualMachines := schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "virtualmachines"}
+	virtualMachineGroups := schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "virtualmachinegroups"}
+	persistentVolumeClaims := schema.GroupResource{Resource: "persistentvolumeclaims"}
+	secrets := schema.GroupResource{Resource: "secrets"}
+	virtualMachineImages := schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "virtualmachineimages"}
+	clusterVirtualMachineImages := schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "clustervirtualmachineimages"}
+
+	tests := []struct {
+		name   string
+		action interface {
+			AppliesTo() (veleroplugin.ResourceSelector, error)
+		}
+		expected []schema.GroupResource
+	}{
+		{name: VMGroupBackupPluginName, action: NewVMGroupBackupItemActionWithClient(log, c, configMapClient), expected: []schema.GroupResource{virtualMachineGroups}},
+		{name: VMBackupPluginName, action: NewVMBackupItemAction(log), expected: []schema.GroupResource{virtualMachines}},
+		{name: PVCBackupPluginName, action: NewPVCBackupItemActionWithClient(log, c), expected: []schema.GroupResource{persistentVolumeClaims}},
+		{name: VMRestorePluginName, action: NewVMRestoreItemActionWithClient(log, c, configMapClient), expected: []schema.GroupResource{virtualMachines}},
+		{name: VMGroupRestorePluginName, action: NewVMGroupRestoreItemAction(log, configMapClient), expected: []schema.GroupResource{virtualMachineGroups}},
+		{name: PVCRestorePluginName, action: NewPVCRestoreItemActionWithClient(log, c, configMapClient), expected: []schema.GroupResource{persistentVolumeClaims}},
+		{name: SecretRestorePluginName, action: NewSecretRestoreItemAction(log, configMapClient), expected: []schema.GroupResource{secrets}},
+		{name: VMImageRestorePluginName, action: NewVMImageRestoreItemAction(log, configMapClient), expected: []schema.GroupResource{virtualMachineImages, clusterVirtualMachineImages}},
+		{name: VMGroupDeletePluginName, action: NewVMGroupDeleteItemActionWithClient(log, c, configMapClient), expected: []schema.GroupResource{virtualMachineGroups}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := tt.action.AppliesTo()
+			require.NoError(t, err)
+
+			// Velero matches the resources of a selector parsed as group resources
+			var resources []schema.GroupResource
+			for _, resource := range selector.IncludedResources {
+				resources = append(resources, schema.ParseGroupResource(resource))
+			}
+			assert.Equal(t, tt.expected, resources)
+		})
+	}
+}
+
+func TestNewScheme(t *testing.T) {
+	s, err := newScheme()
+	require.NoError(t, err)
+
+	for _, obj := range []runtime.Object{
+		&corev1.PersistentVolumeClaim{},
+		&corev1.Secret{},
+		&authorizationv1.SelfSubjectAccessReview{},
+		&vmopv1.VirtualMachine{},
+		&vmopv1.VirtualMachineGroup{},
+		&vmopv1a4.VirtualMachine{},
+	} {
+		_, _, err := s.ObjectKinds(obj)
+		assert.NoError(t, err, "%T", obj)
+	}
+
+	// The global client-go scheme is left alone
+	assert.False(t, clientgoscheme.Scheme.IsGroupRegistered(vmoperatorGroup))
+}
+
+func TestBackupWithPluginScheme(t *testing.T) {
+	s, err := newScheme()
+	require.NoError(t, err)
+	vm := withPVCVolumes(withCloudConfigSecret(newVM("vm-1"), "cloud-config"), "data")
+	c := fake.NewClientBuilder().WithScheme(s).WithObjects(vm, withStorageClass(newPVC("data"), "vsan-gold")).Build()
+	action, _ := newTestBackupActionWithClient(t, nil, c)
+
+	// The PVC Get for the StorageClass needs the core types
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+	assert.Equal(t, []string{"data"}, namesOf(additionalItems, "persistentvolumeclaims"))
+	assert.Equal(t, []string{"vsan-gold"}, namesOf(additionalItems, "storageclasses"))
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// DependencyCollector collects the additional items of a backup
+// Every item is kept once, in the order it was first added. Empty names are ignored.
+type DependencyCollector struct {
+	items []veleroplugin.ResourceIdentifier
+	seen  map[veleroplugin.ResourceIdentifier]struct{}
+}
+
+// NewDependencyCollector creates an empty DependencyCollector
+func NewDependencyCollector() *DependencyCollector {
+	return &DependencyCollector{
+		seen: make(map[veleroplugin.ResourceIdentifier]struct{}),
+	}
+}
+
+// Add adds resource identifiers and reports whether any of them was not collected yet
+func (c *DependencyCollector) Add(items ...veleroplugin.ResourceIdentifier) bool {
+	added := false
+	for _, item := range items {
+		if item.Name == "" {
+			continue
+		}
+		if _, exists := c.seen[item]; exists {
+			continue
+		}
+		c.seen[item] = struct{}{}
+		c.items = append(c.items, item)
+		added = true
+	}
+	return added
+}
+
+// add adds a single resource and reports whether it was not collected yet
+func (c *DependencyCollector) add(group, resource, namespace, name string) bool {
+	return c.Add(veleroplugin.ResourceIdentifier{
+		GroupResource: schema.GroupResource{Group: group, Resource: resource},
+		Namespace:     namespace,
+		Name:          name,
+	})
+}
+
+// AddVirtualMachine adds a VirtualMachine
+func (c *DependencyCollector) AddVirtualMachine(namespace, name string) bool {
+	return c.add(vmoperatorGroup, "virtualmachines", namespace, name)
+}
+
+// AddVirtualMachineGroup adds a VirtualMachineGroup
+func (c *DependencyCollector) AddVirtualMachineGroup(namespace, name string) bool {
+	return c.add(vmoperatorGroup, "virtualmachinegroups", namespace, name)
+}
+
+// AddSecret adds a Secret
+func (c *DependencyCollector) AddSecret(namespace, name string) bool {
+	return c.add("", "secrets", namespace, name)
+}
+
+// AddConfigMap adds a ConfigMap
+func (c *DependencyCollector) AddConfigMap(namespace, name string) bool {
+	return c.add("", "configmaps", namespace, name)
+}
+
+// AddPVC adds a PersistentVolumeClaim
+func (c *DependencyCollector) AddPVC(namespace, name string) bool {
+	return c.add("", "persistentvolumeclaims", namespace, name)
+}
+
+// AddStorageClass adds a cluster-scoped StorageClass
+func (c *DependencyCollector) AddStorageClass(name string) bool {
+	return c.add("storage.k8s.io", "storageclasses", "", name)
+}
+
+// AddVolumeSnapshot adds a CSI VolumeSnapshot
+func (c *DependencyCollector) AddVolumeSnapshot(namespace, name string) bool {
+	return c.add(volumeSnapshotGroup, "volumesnapshots", namespace, name)
+}
+
+// AddImage adds a VirtualMachineImage, or a ClusterVirtualMachineImage when namespace is empty
+func (c *DependencyCollector) AddImage(namespace, name string) bool {
+	if namespace == "" {
+		return c.add(vmoperatorGroup, "clustervirtualmachineimages", "", name)
+	}
+	return c.add(vmoperatorGroup, "virtualmachineimages", namespace, name)
+}
+
+// AddClass adds a VirtualMachineClass
+func (c *DependencyCollector) AddClass(namespace, name string) bool {
+	return c.add(vmoperatorGroup, "virtualmachineclasses", namespace, name)
+}
+
+// AddResourcePolicy adds a VirtualMachineSetResourcePolicy
+func (c *DependencyCollector) AddResourcePolicy(namespace, name string) bool {
+	return c.add(vmoperatorGroup, "virtualmachinesetresourcepolicies", namespace, name)
+}
+
+// AddEncryptionClass adds an EncryptionClass
+func (c *DependencyCollector) AddEncryptionClass(namespace, name string) bool {
+	return c.add(encryptionGroup, "encryptionclasses", namespace, name)
+}
+
+// AddVirtualMachineService adds a VirtualMachineService
+func (c *DependencyCollector) AddVirtualMachineService(namespace, name string) bool {
+	return c.add(vmoperatorGroup, "virtualmachineservices", namespace, name)
+}
+
+// Items returns the collected resource identifiers in the order they were first added
+func (c *DependencyCollector) Items() []veleroplugin.ResourceIdentifier {
+	return c.items
+}
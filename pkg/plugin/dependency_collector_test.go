@@ -0,0 +1,67 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+func TestDependencyCollector(t *testing.T) {
+	identifier := func(group, resource, namespace, name string) veleroplugin.ResourceIdentifier {
+		return veleroplugin.ResourceIdentifier{GroupResource: schema.GroupResource{Group: group, Resource: resource}, Namespace: namespace, Name: name}
+	}
+
+	deps := NewDependencyCollector()
+	assert.True(t, deps.AddVirtualMachine(testNamespace, "vm-1"))
+	assert.True(t, deps.AddSecret(testNamespace, "cloud-config"))
+	assert.True(t, deps.AddPVC(testNamespace, "data"))
+	assert.True(t, deps.AddImage("", "ubuntu-22.04"))
+	assert.True(t, deps.AddImage(testNamespace, "ubuntu-22.04"))
+	assert.True(t, deps.AddClass(testNamespace, "best-effort-small"))
+	assert.True(t, deps.AddStorageClass("vsan-gold"))
+
+	// Duplicates and empty names are dropped, the same name of another kind or namespace is kept
+	assert.False(t, deps.AddSecret(testNamespace, "cloud-config"))
+	assert.False(t, deps.AddPVC(testNamespace, ""))
+	assert.True(t, deps.AddConfigMap(testNamespace, "cloud-config"))
+	assert.True(t, deps.AddSecret("other-ns", "cloud-config"))
+	assert.False(t, deps.Add(identifier("", "persistentvolumeclaims", testNamespace, "data"), identifier("", "secrets", testNamespace, "")))
+	assert.True(t, deps.Add(identifier("", "persistentvolumeclaims", testNamespace, "data"), identifier("", "persistentvolumeclaims", testNamespace, "logs")))
+
+	// Items are returned in the order they were first added
+	assert.Equal(t, []veleroplugin.ResourceIdentifier{
+		identifier(vmoperatorGroup, "virtualmachines", testNamespace, "vm-1"),
+		identifier("", "secrets", testNamespace, "cloud-config"),
+		identifier("", "persistentvolumeclaims", testNamespace, "data"),
+		identifier(vmoperatorGroup, "clustervirtualmachineimages", "", "ubuntu-22.04"),
+		identifier(vmoperatorGroup, "virtualmachineimages", testNamespace, "ubuntu-22.04"),
+		identifier(vmoperatorGroup, "virtualmachineclasses", testNamespace, "best-effort-small"),
+		identifier("storage.k8s.io", "storageclasses", "", "vsan-gold"),
+		identifier("", "configmaps", testNamespace, "cloud-config"),
+		identifier("", "secrets", "other-ns", "cloud-config"),
+		identifier("", "persistentvolumeclaims", testNamespace, "logs"),
+	}, deps.Items())
+}
+
+func TestDependencyCollectorEmpty(t *testing.T) {
+	assert.Empty(t, NewDependencyCollector().Items())
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements Velero delete item action for VirtualMachineGroup resources.
+// On request, it removes the markers the restore plugins set from the groups restored from a
+// deleted backup.
+package plugin
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// removeMarkersOnBackupDeletionConfigKey is the vmgroup-restore plugin config key that, when set
+// to "true", removes the restore markers of the groups restored from a backup when it is deleted.
+// The markers are an audit trail of the restored workloads, so they are kept by default.
+const removeMarkersOnBackupDeletionConfigKey = "removeMarkersOnBackupDeletion"
+
+// VMGroupDeleteItemAction is a delete item action plugin for VirtualMachineGroup
+type VMGroupDeleteItemAction struct {
+	log             logrus.FieldLogger
+	client          client.Client
+	configMapClient corev1client.ConfigMapInterface
+}
+
+// NewVMGroupDeleteItemAction creates a new VMGroupDeleteItemAction
+func NewVMGroupDeleteItemAction(log logrus.FieldLogger, restConfig *rest.Config, configMapClient corev1client.ConfigMapInterface) (*VMGroupDeleteItemAction, error) {
+	c, err := newClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewVMGroupDeleteItemActionWithClient(log, c, configMapClient), nil
+}
+
+// NewVMGroupDeleteItemActionWithClient creates a new VMGroupDeleteItemAction with the given client
+func NewVMGroupDeleteItemActionWithClient(log logrus.FieldLogger, c client.Client, configMapClient corev1client.ConfigMapInterface) *VMGroupDeleteItemAction {
+	return &VMGroupDeleteItemAction{
+		log:             log,
+		client:          c,
+		configMapClient: configMapClient,
+	}
+}
+
+// AppliesTo returns the resources this plugin applies to
+func (p *VMGroupDeleteItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
+	return veleroplugin.ResourceSelector{
+		IncludedResources: []string{virtualMachineGroupsResource},
+	}, nil
+}
+
+// Execute performs the delete action
+// Deleting a backup leaves restored workloads as they are unless removeMarkersOnBackupDeletion is
+// set. Then it removes the restoredFromBackupAnnotation naming the deleted backup, and the restoreLabel set with
+// it, from the live VirtualMachineGroup restored from the group of the backup, under its backed up
+// name or the name the vm-restore plugin config renames it to. Groups that are gone or were
+// restored from another backup are left as they are, so running it again is a no-op.
+// Groups are only looked up in their backed up namespace: the input carries the backup but not the
+// restores made from it, so the namespace mapping of a restore cannot be resolved here.
+func (p *VMGroupDeleteItemAction) Execute(input *veleroplugin.DeleteItemActionExecuteInput) error {
+	obj := input.Item.UnstructuredContent()
+	namespace, _, _ := unstructured.NestedString(obj, "metadata", "namespace")
+	name, _, _ := unstructured.NestedString(obj, "metadata", "name")
+	apiVersion, _, _ := unstructured.NestedString(obj, "apiVersion")
+
+	log := p.log.WithFields(logrus.Fields{
+		"action":    VMGroupDeletePluginName,
+		"backup":    input.Backup.Name,
+		"namespace": namespace,
+		"group":     name,
+	})
+
+	config, err := getRestoreConfig(p.configMapClient, VMGroupRestorePluginName, log)
+	if err != nil {
+		return err
+	}
+	removeMarkers, err := getBool(config, removeMarkersOnBackupDeletionConfigKey, false)
+	if err != nil || !removeMarkers {
+		return err
+	}
+	log.Info("Cleaning up VirtualMachineGroup restored from deleted backup")
+
+	annotation, err := restoredFromBackupAnnotation(config)
+	if err != nil || annotation == "" {
+		return err
+	}
+	labelKey, labelValue, err := restoreLabel(config)
+	if err != nil {
+		return err
+	}
+
+	vmRestoreConfig, err := getRestoreConfig(p.configMapClient, VMRestorePluginName, log)
+	if err != nil {
+		return errors.Wrap(err, "failed to get vm-restore plugin config")
+	}
+	restoredName, err := restoredGroupName(name, vmRestoreConfig)
+	if err != nil {
+		return err
+	}
+
+	names := []string{name}
+	if restoredName != name {
+		names = append(names, restoredName)
+	}
+	for _, groupName := range names {
+		key := client.ObjectKey{Namespace: namespace, Name: groupName}
+		if err := p.cleanUp(schema.FromAPIVersionAndKind(apiVersion, "VirtualMachineGroup"), key, input.Backup.Name, annotation, labelKey, labelValue, log); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanUp removes the annotation, and the label key=labelValue, from a VirtualMachineGroup whose
+// annotation names the backup
+// Only the metadata is read and patched, so it works whichever VM Operator version the cluster serves.
+// The Get and Patch share defaultGetTimeout so an unresponsive API server cannot stall the deletion.
+func (p *VMGroupDeleteItemAction) cleanUp(gvk schema.GroupVersionKind, key client.ObjectKey, backupName, annotation, labelKey, labelValue string, log logrus.FieldLogger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultGetTimeout)
+	defer cancel()
+
+	vmGroup := &metav1.PartialObjectMetadata{}
+	vmGroup.SetGroupVersionKind(gvk)
+	if err := p.client.Get(ctx, key, vmGroup); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Infof("VirtualMachineGroup %s does not exist - nothing to clean up", key)
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get VirtualMachineGroup %s", key)
+	}
+	if vmGroup.Annotations[annotation] != backupName {
+		return nil
+	}
+
+	original := vmGroup.DeepCopy()
+	log.WithField("annotation", annotation).Infof("Removing annotation from VirtualMachineGroup %s", key)
+	delete(vmGroup.Annotations, annotation)
+	if labelKey != "" && vmGroup.Labels[labelKey] == labelValue {
+		log.WithField("label", labelKey).Infof("Removing label from VirtualMachineGroup %s", key)
+		delete(vmGroup.Labels, labelKey)
+	}
+
+	if err := p.client.Patch(ctx, vmGroup, client.MergeFrom(original)); err != nil {
+		return errors.Wrapf(err, "failed to patch VirtualMachineGroup %s", key)
+	}
+	return nil
+}
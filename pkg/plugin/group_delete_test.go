@@ -0,0 +1,251 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"maps"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// restoredGroup returns a VirtualMachineGroup carrying the markers of a restore from backupName
+func restoredGroup(name, backupName string) *vmopv1.VirtualMachineGroup {
+	vmGroup := newVMGroup(name, "vm-1")
+	vmGroup.Labels = map[string]string{"restored-by": "velero-vmgroup-plugin", "app": "db"}
+	vmGroup.Annotations = map[string]string{defaultRestoredFromBackupAnnotation: backupName, "example.com/owner": "team-a"}
+	return vmGroup
+}
+
+// newTestGroupDeleteAction returns a VMGroupDeleteItemAction serving objs with the restore plugin
+// configs configs, and the number of patches it sends
+// removeMarkersOnBackupDeletion is enabled unless configs set it.
+func newTestGroupDeleteAction(t *testing.T, configs map[string]map[string]string, objs ...client.Object) (*VMGroupDeleteItemAction, client.Client, *atomic.Int32) {
+	t.Helper()
+
+	configs = withMarkerRemoval(configs)
+
+	var patches atomic.Int32
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches.Add(1)
+			return cl.Patch(ctx, obj, patch, opts...)
+		},
+	}, objs...)
+	log, _ := newTestLogger()
+	return NewVMGroupDeleteItemActionWithClient(log, c, newRestoreConfigMapClient(configs)), c, &patches
+}
+
+// withMarkerRemoval returns configs with removeMarkersOnBackupDeletion enabled in the vmgroup-restore
+// plugin config, unless it is set already
+func withMarkerRemoval(configs map[string]map[string]string) map[string]map[string]string {
+	withRemoval := make(map[string]map[string]string, len(configs)+1)
+	for name, config := range configs {
+		withRemoval[name] = maps.Clone(config)
+	}
+	groupConfig := withRemoval[VMGroupRestorePluginName]
+	if groupConfig == nil {
+		groupConfig = make(map[string]string)
+	}
+	if _, found := groupConfig[removeMarkersOnBackupDeletionConfigKey]; !found {
+		groupConfig[removeMarkersOnBackupDeletionConfigKey] = "true"
+	}
+	withRemoval[VMGroupRestorePluginName] = groupConfig
+	return withRemoval
+}
+
+// newDeleteInput returns the input of a delete item action deleting obj with the backup "backup-1"
+func newDeleteInput(t *testing.T, obj *vmopv1.VirtualMachineGroup) *veleroplugin.DeleteItemActionExecuteInput {
+	t.Helper()
+
+	return &veleroplugin.DeleteItemActionExecuteInput{
+		Item:   toUnstructured(t, obj),
+		Backup: &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}},
+	}
+}
+
+// liveGroup returns the VirtualMachineGroup name served by c
+func liveGroup(t *testing.T, c client.Client, name string) *vmopv1.VirtualMachineGroup {
+	t.Helper()
+
+	vmGroup := &vmopv1.VirtualMachineGroup{}
+	require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: testNamespace, Name: name}, vmGroup))
+	return vmGroup
+}
+
+func TestVMGroupDeleteRemovesMarkers(t *testing.T) {
+	action, c, patches := newTestGroupDeleteAction(t, nil, restoredGroup("group-1", "backup-1"))
+
+	// The second run finds nothing to clean up
+	for range 2 {
+		require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+	}
+
+	vmGroup := liveGroup(t, c, "group-1")
+	assert.Equal(t, map[string]string{"app": "db"}, vmGroup.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "team-a"}, vmGroup.Annotations)
+	assert.Equal(t, int32(1), patches.Load())
+}
+
+func TestVMGroupDeleteKeepsMarkersByDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs map[string]map[string]string
+	}{
+		{name: "not configured"},
+		{name: "disabled", configs: map[string]map[string]string{VMGroupRestorePluginName: {removeMarkersOnBackupDeletionConfigKey: "false"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			c := newInterceptedFakeClient(t, interceptor.Funcs{
+				Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					requests.Add(1)
+					return cl.Get(ctx, key, obj, opts...)
+				},
+			}, restoredGroup("group-1", "backup-1"))
+			log, _ := newTestLogger()
+			action := NewVMGroupDeleteItemActionWithClient(log, c, newRestoreConfigMapClient(tt.configs))
+
+			require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+			assert.Zero(t, requests.Load())
+
+			vmGroup := liveGroup(t, c, "group-1")
+			assert.Equal(t, restoredGroup("group-1", "backup-1").Labels, vmGroup.Labels)
+			assert.Equal(t, restoredGroup("group-1", "backup-1").Annotations, vmGroup.Annotations)
+		})
+	}
+}
+
+func TestVMGroupDeleteInvalidMarkerRemoval(t *testing.T) {
+	action, _, _ := newTestGroupDeleteAction(t, map[string]map[string]string{
+		VMGroupRestorePluginName: {removeMarkersOnBackupDeletionConfigKey: "sometimes"},
+	})
+	assert.ErrorContains(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))), removeMarkersOnBackupDeletionConfigKey)
+}
+
+func TestVMGroupDeleteConfiguredMarkers(t *testing.T) {
+	vmGroup := newVMGroup("group-1", "vm-1")
+	vmGroup.Labels = map[string]string{"restored-by": "velero-vmgroup-plugin", "example.com/restored": "yes"}
+	vmGroup.Annotations = map[string]string{defaultRestoredFromBackupAnnotation: "backup-1", "example.com/source-backup": "backup-1"}
+	action, c, _ := newTestGroupDeleteAction(t, map[string]map[string]string{
+		VMGroupRestorePluginName: {
+			restoredFromBackupAnnotationConfigKey: "example.com/source-backup",
+			restoreLabelConfigKey:                 "example.com/restored=yes",
+		},
+	}, vmGroup)
+
+	require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+
+	vmGroup = liveGroup(t, c, "group-1")
+	assert.Equal(t, map[string]string{"restored-by": "velero-vmgroup-plugin"}, vmGroup.Labels)
+	assert.Equal(t, map[string]string{defaultRestoredFromBackupAnnotation: "backup-1"}, vmGroup.Annotations)
+}
+
+func TestVMGroupDeleteKeepsChangedLabel(t *testing.T) {
+	vmGroup := restoredGroup("group-1", "backup-1")
+	vmGroup.Labels["restored-by"] = "someone-else"
+	action, c, _ := newTestGroupDeleteAction(t, nil, vmGroup)
+
+	require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+
+	vmGroup = liveGroup(t, c, "group-1")
+	assert.Equal(t, map[string]string{"restored-by": "someone-else", "app": "db"}, vmGroup.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "team-a"}, vmGroup.Annotations)
+}
+
+func TestVMGroupDeleteNothingToCleanUp(t *testing.T) {
+	tests := []struct {
+		name string
+		objs []client.Object
+	}{
+		{name: "group is gone"},
+		{name: "restored from another backup", objs: []client.Object{restoredGroup("group-1", "backup-2")}},
+		{name: "not restored", objs: []client.Object{newVMGroup("group-1", "vm-1")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _, patches := newTestGroupDeleteAction(t, nil, tt.objs...)
+
+			require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+			assert.Zero(t, patches.Load())
+		})
+	}
+}
+
+func TestVMGroupDeleteDisabledAnnotation(t *testing.T) {
+	action, c, patches := newTestGroupDeleteAction(t, map[string]map[string]string{
+		VMGroupRestorePluginName: {restoredFromBackupAnnotationConfigKey: ""},
+	}, restoredGroup("group-1", "backup-1"))
+
+	require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+	assert.Zero(t, patches.Load())
+	assert.Equal(t, "backup-1", liveGroup(t, c, "group-1").Annotations[defaultRestoredFromBackupAnnotation])
+}
+
+func TestVMGroupDeleteRenamedGroup(t *testing.T) {
+	action, c, _ := newTestGroupDeleteAction(t, map[string]map[string]string{
+		VMRestorePluginName: {groupNameSuffixConfigKey: "-staging"},
+	}, restoredGroup("group-1-staging", "backup-1"))
+
+	require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+
+	vmGroup := liveGroup(t, c, "group-1-staging")
+	assert.Equal(t, map[string]string{"app": "db"}, vmGroup.Labels)
+	assert.Equal(t, map[string]string{"example.com/owner": "team-a"}, vmGroup.Annotations)
+}
+
+func TestVMGroupDeleteGetError(t *testing.T) {
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			return assert.AnError
+		},
+	})
+	log, _ := newTestLogger()
+	action := NewVMGroupDeleteItemActionWithClient(log, c, newRestoreConfigMapClient(withMarkerRemoval(nil)))
+
+	err := action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1")))
+	assert.ErrorContains(t, err, "failed to get VirtualMachineGroup vm-ns/group-1")
+}
+
+func TestVMGroupDeleteGetTimeout(t *testing.T) {
+	var deadline time.Time
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			deadline, _ = ctx.Deadline()
+			return cl.Get(ctx, key, obj, opts...)
+		},
+	})
+	log, _ := newTestLogger()
+	action := NewVMGroupDeleteItemActionWithClient(log, c, newRestoreConfigMapClient(withMarkerRemoval(nil)))
+
+	require.NoError(t, action.Execute(newDeleteInput(t, newVMGroup("group-1", "vm-1"))))
+	assert.WithinDuration(t, time.Now().Add(defaultGetTimeout), deadline, time.Second)
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements Velero restore item action for VirtualMachineGroup resources.
+// It removes the source cluster's reconcile status so the group is re-evaluated from scratch.
+package plugin
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// restoredFromBackupAnnotationConfigKey is the plugin config key holding the annotation recording
+// the backup a VirtualMachineGroup was restored from, for auditing. An empty value disables it.
+const restoredFromBackupAnnotationConfigKey = "restoredFromBackupAnnotation"
+
+// defaultRestoredFromBackupAnnotation is used when restoredFromBackupAnnotation is not configured
+const defaultRestoredFromBackupAnnotation = "lubronzhan.io/restored-from-backup"
+
+// VMGroupRestoreItemAction is a restore item action plugin for VirtualMachineGroup
+type VMGroupRestoreItemAction struct {
+	log             logrus.FieldLogger
+	configMapClient corev1client.ConfigMapInterface
+}
+
+// NewVMGroupRestoreItemAction creates a new VMGroupRestoreItemAction
+func NewVMGroupRestoreItemAction(log logrus.FieldLogger, configMapClient corev1client.ConfigMapInterface) *VMGroupRestoreItemAction {
+	return &VMGroupRestoreItemAction{
+		log:             log,
+		configMapClient: configMapClient,
+	}
+}
+
+// AppliesTo returns the resources this plugin applies to
+func (p *VMGroupRestoreItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
+	return veleroplugin.ResourceSelector{
+		IncludedResources: []string{virtualMachineGroupsResource},
+	}, nil
+}
+
+// Execute performs the restore action
+// Removes the status block and server-assigned metadata carried over from the source cluster,
+// renames the group as configured with groupNameMapping/groupNameSuffix of the vm-restore plugin,
+// and annotates it with the name of the backup it is restored from
+func (p *VMGroupRestoreItemAction) Execute(input *veleroplugin.RestoreItemActionExecuteInput) (*veleroplugin.RestoreItemActionExecuteOutput, error) {
+	p.log.Infof("Executing VMGroupRestoreItemAction for restore %s", input.Restore.Name)
+
+	obj := input.Item.UnstructuredContent()
+
+	namespace, _, _ := unstructured.NestedString(obj, "metadata", "namespace")
+	groupName, _, _ := unstructured.NestedString(obj, "metadata", "name")
+
+	log := p.log.WithFields(logrus.Fields{
+		"action":    VMGroupRestorePluginName,
+		"restore":   input.Restore.Name,
+		"namespace": namespace,
+		"group":     groupName,
+	})
+	log.Info("Processing VirtualMachineGroup")
+
+	config, err := getRestoreConfig(p.configMapClient, VMGroupRestorePluginName, log)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove status - including the members' conditions - so the reconciler starts fresh
+	if _, found := obj["status"]; found {
+		log.Info("Removing status")
+		unstructured.RemoveNestedField(obj, "status")
+	}
+
+	// Remove server-assigned metadata left over from the source cluster
+	for _, field := range []string{"resourceVersion", "uid"} {
+		if _, found, _ := unstructured.NestedFieldNoCopy(obj, "metadata", field); found {
+			log.Infof("Removing metadata.%s", field)
+			unstructured.RemoveNestedField(obj, "metadata", field)
+		}
+	}
+
+	// Rename the group, its parent group and its nested groups the same way the VM restore plugin
+	// renames the groups of the VMs, so the restored groups and VMs reference each other
+	vmRestoreConfig, err := getRestoreConfig(p.configMapClient, VMRestorePluginName, log)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get vm-restore plugin config")
+	}
+	if err := p.renameGroups(obj, vmRestoreConfig, log); err != nil {
+		return nil, err
+	}
+
+	updatedItem := &unstructured.Unstructured{Object: obj}
+	if _, err := setRestoreLabel(updatedItem, config); err != nil {
+		return nil, err
+	}
+	if err := setRestoredFromBackupAnnotation(updatedItem, input.Restore.Spec.BackupName, config, log); err != nil {
+		return nil, err
+	}
+
+	return veleroplugin.NewRestoreItemActionExecuteOutput(updatedItem), nil
+}
+
+// renameGroups applies groupNameMapping and groupNameSuffix of the vm-restore plugin config to
+// metadata.name, spec.groupName and the VirtualMachineGroup members in spec.bootOrder
+func (p *VMGroupRestoreItemAction) renameGroups(obj map[string]interface{}, config map[string]string, log logrus.FieldLogger) error {
+	rename := func(fields ...string) error {
+		name, found, _ := unstructured.NestedString(obj, fields...)
+		if !found || name == "" {
+			return nil
+		}
+		newName, err := restoredGroupName(name, config)
+		if err != nil {
+			return err
+		}
+		if newName != name {
+			log.Infof("Changing %s from %s to %s", strings.Join(fields, "."), name, newName)
+			unstructured.SetNestedField(obj, newName, fields...)
+		}
+		return nil
+	}
+
+	if err := rename("metadata", "name"); err != nil {
+		return err
+	}
+	if err := rename("spec", "groupName"); err != nil {
+		return err
+	}
+
+	bootOrder, found, _ := unstructured.NestedSlice(obj, "spec", "bootOrder")
+	if !found {
+		return nil
+	}
+	for _, bootOrderGroup := range bootOrder {
+		bootOrderGroupMap, ok := bootOrderGroup.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		members, _, _ := unstructured.NestedSlice(bootOrderGroupMap, "members")
+		for _, member := range members {
+			memberMap, ok := member.(map[string]interface{})
+			if !ok || memberMap["kind"] != "VirtualMachineGroup" {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(memberMap, "name")
+			if name == "" {
+				continue
+			}
+			newName, err := restoredGroupName(name, config)
+			if err != nil {
+				return err
+			}
+			if newName != name {
+				log.Infof("Changing member VirtualMachineGroup from %s to %s", name, newName)
+				memberMap["name"] = newName
+			}
+		}
+		unstructured.SetNestedSlice(bootOrderGroupMap, members, "members")
+	}
+	unstructured.SetNestedSlice(obj, bootOrder, "spec", "bootOrder")
+	return nil
+}
+
+// restoredFromBackupAnnotation returns the annotation configured with restoredFromBackupAnnotation,
+// or "" when it is disabled
+func restoredFromBackupAnnotation(config map[string]string) (string, error) {
+	key, found := config[restoredFromBackupAnnotationConfigKey]
+	if !found {
+		key = defaultRestoredFromBackupAnnotation
+	}
+	if key = strings.TrimSpace(key); key == "" {
+		return "", nil
+	}
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return "", errors.Errorf("invalid %s config %q: %s", restoredFromBackupAnnotationConfigKey, key, strings.Join(errs, ", "))
+	}
+	return key, nil
+}
+
+// setRestoredFromBackupAnnotation sets the annotation configured with restoredFromBackupAnnotation
+// to the name of the backup a group is restored from
+func setRestoredFromBackupAnnotation(item *unstructured.Unstructured, backupName string, config map[string]string, log logrus.FieldLogger) error {
+	key, err := restoredFromBackupAnnotation(config)
+	if err != nil || key == "" || backupName == "" {
+		return err
+	}
+
+	log.WithField("annotation", key).Infof("Recording backup %s", backupName)
+	annotations := item.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = backupName
+	item.SetAnnotations(annotations)
+	return nil
+}
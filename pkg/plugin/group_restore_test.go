@@ -0,0 +1,115 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+)
+
+// newTestGroupRestoreAction returns a VMGroupRestoreItemAction with the plugin config config
+func newTestGroupRestoreAction(config map[string]string) *VMGroupRestoreItemAction {
+	log, _ := newTestLogger()
+	return NewVMGroupRestoreItemAction(log, newConfigMapClient(common.PluginKindRestoreItemAction, VMGroupRestorePluginName, config))
+}
+
+func TestVMGroupRestoreClearsStatus(t *testing.T) {
+	vmGroup := newVMGroup("group-1", "vm-1", "vm-2")
+	vmGroup.ResourceVersion = "12345"
+	vmGroup.UID = "5d1c5a4e-2f4b-4d6c-9c41-6c1f2b1a7e10"
+	vmGroup.Status = vmopv1.VirtualMachineGroupStatus{
+		Members: []vmopv1.VirtualMachineGroupMemberStatus{
+			{
+				Name:       "vm-1",
+				Kind:       "VirtualMachine",
+				Conditions: []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ready"}},
+			},
+		},
+		Conditions: []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ready"}},
+	}
+	input := newRestoreInput(t, vmGroup)
+	expectedSpec := input.Item.UnstructuredContent()["spec"]
+
+	output, err := newTestGroupRestoreAction(nil).Execute(input)
+	require.NoError(t, err)
+
+	obj := output.UpdatedItem.UnstructuredContent()
+	assert.NotContains(t, obj, "status")
+	assert.Equal(t, expectedSpec, obj["spec"])
+	for _, field := range []string{"resourceVersion", "uid"} {
+		_, found, _ := unstructured.NestedFieldNoCopy(obj, "metadata", field)
+		assert.False(t, found, "metadata.%s should be removed", field)
+	}
+	name, _, _ := unstructured.NestedString(obj, "metadata", "name")
+	assert.Equal(t, "group-1", name)
+}
+
+func TestVMGroupRestoreRestoredFromBackupAnnotation(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     map[string]string
+		backupName string
+		expected   map[string]string
+	}{
+		{
+			name:       "default annotation",
+			backupName: "backup-1",
+			expected:   map[string]string{defaultRestoredFromBackupAnnotation: "backup-1"},
+		},
+		{
+			name:       "configured annotation",
+			config:     map[string]string{restoredFromBackupAnnotationConfigKey: "example.com/source-backup"},
+			backupName: "backup-1",
+			expected:   map[string]string{"example.com/source-backup": "backup-1"},
+		},
+		{
+			name:       "disabled",
+			config:     map[string]string{restoredFromBackupAnnotationConfigKey: ""},
+			backupName: "backup-1",
+		},
+		{
+			name: "no backup name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := newRestoreInput(t, newVMGroup("group-1", "vm-1"))
+			input.Restore.Spec.BackupName = tt.backupName
+
+			output, err := newTestGroupRestoreAction(tt.config).Execute(input)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, output.UpdatedItem.(*unstructured.Unstructured).GetAnnotations())
+		})
+	}
+}
+
+func TestVMGroupRestoreInvalidRestoredFromBackupAnnotation(t *testing.T) {
+	input := newRestoreInput(t, newVMGroup("group-1", "vm-1"))
+	input.Restore.Spec.BackupName = "backup-1"
+
+	_, err := newTestGroupRestoreAction(map[string]string{restoredFromBackupAnnotationConfigKey: "not a key"}).Execute(input)
+	assert.ErrorContains(t, err, `invalid restoredFromBackupAnnotation config "not a key"`)
+}
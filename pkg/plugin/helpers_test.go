@@ -0,0 +1,168 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// testNamespace is the namespace of the objects in the tests
+const testNamespace = "vm-ns"
+
+// newTestLogger returns a logger that discards its output and a hook recording the entries
+func newTestLogger() (logrus.FieldLogger, *logrustest.Hook) {
+	logger, hook := logrustest.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	return logger, hook
+}
+
+// newTestScheme returns the scheme the plugin clients are created with
+func newTestScheme(t testing.TB) *runtime.Scheme {
+	t.Helper()
+
+	s, err := newScheme()
+	require.NoError(t, err)
+	return s
+}
+
+// newFakeClient returns a fake controller-runtime client serving objs
+func newFakeClient(t testing.TB, objs ...client.Object) client.Client {
+	t.Helper()
+	return fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(objs...).Build()
+}
+
+// newInterceptedFakeClient returns a fake controller-runtime client serving objs whose
+// requests go through funcs, e.g. to count them or inject errors
+func newInterceptedFakeClient(t testing.TB, funcs interceptor.Funcs, objs ...client.Object) client.Client {
+	t.Helper()
+	return fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(objs...).WithInterceptorFuncs(funcs).Build()
+}
+
+// newConfigMapClient returns a ConfigMap client serving the plugin config ConfigMap of the named plugin
+// No ConfigMap is served when data is nil.
+func newConfigMapClient(kind common.PluginKind, name string, data map[string]string) corev1client.ConfigMapInterface {
+	clientset := kubefake.NewSimpleClientset()
+	if data != nil {
+		_, _ = clientset.CoreV1().ConfigMaps("velero").Create(context.Background(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "velero",
+				Name:      "plugin-config",
+				Labels: map[string]string{
+					"velero.io/plugin-config": "",
+					name:                      string(kind),
+				},
+			},
+			Data: data,
+		}, metav1.CreateOptions{})
+	}
+	return clientset.CoreV1().ConfigMaps("velero")
+}
+
+// newRestoreConfigMapClient returns a ConfigMap client serving the plugin config ConfigMap of each
+// restore plugin in configs, for actions reading the config of another plugin
+func newRestoreConfigMapClient(configs map[string]map[string]string) corev1client.ConfigMapInterface {
+	clientset := kubefake.NewSimpleClientset()
+	for name, data := range configs {
+		_, _ = clientset.CoreV1().ConfigMaps("velero").Create(context.Background(), &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "velero",
+				Name:      strings.ReplaceAll(name, "/", "-"),
+				Labels: map[string]string{
+					"velero.io/plugin-config": "",
+					name:                      string(common.PluginKindRestoreItemAction),
+				},
+			},
+			Data: data,
+		}, metav1.CreateOptions{})
+	}
+	return clientset.CoreV1().ConfigMaps("velero")
+}
+
+// newVM returns a v1alpha5 VirtualMachine in the test namespace
+func newVM(name string) *vmopv1.VirtualMachine {
+	return &vmopv1.VirtualMachine{
+		TypeMeta:   metav1.TypeMeta{APIVersion: vmopv1.GroupVersion.String(), Kind: "VirtualMachine"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name},
+	}
+}
+
+// newVMGroup returns a v1alpha5 VirtualMachineGroup in the test namespace booting the named VMs
+func newVMGroup(name string, vmNames ...string) *vmopv1.VirtualMachineGroup {
+	vmGroup := &vmopv1.VirtualMachineGroup{
+		TypeMeta:   metav1.TypeMeta{APIVersion: vmopv1.GroupVersion.String(), Kind: "VirtualMachineGroup"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name},
+	}
+	if len(vmNames) > 0 {
+		bootOrderGroup := vmopv1.VirtualMachineGroupBootOrderGroup{}
+		for _, vmName := range vmNames {
+			bootOrderGroup.Members = append(bootOrderGroup.Members, vmopv1.GroupMember{Name: vmName, Kind: "VirtualMachine"})
+		}
+		vmGroup.Spec.BootOrder = []vmopv1.VirtualMachineGroupBootOrderGroup{bootOrderGroup}
+	}
+	return vmGroup
+}
+
+// toUnstructured converts a typed object to the unstructured item a plugin receives
+func toUnstructured(t testing.TB, obj runtime.Object) *unstructured.Unstructured {
+	t.Helper()
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	require.NoError(t, err)
+	return &unstructured.Unstructured{Object: content}
+}
+
+// newRestoreInput returns the input of a restore item action restoring obj in the restore "restore-1"
+func newRestoreInput(t testing.TB, obj runtime.Object) *veleroplugin.RestoreItemActionExecuteInput {
+	t.Helper()
+
+	return &veleroplugin.RestoreItemActionExecuteInput{
+		Item:           toUnstructured(t, obj),
+		ItemFromBackup: toUnstructured(t, obj),
+		Restore:        &velerov1.Restore{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "restore-1"}},
+	}
+}
+
+// namesOf returns the names of the identifiers of a resource, in order
+func namesOf(items []veleroplugin.ResourceIdentifier, resource string) []string {
+	var names []string
+	for _, item := range items {
+		if item.Resource == resource {
+			names = append(names, item.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements Velero restore item action for VirtualMachineImage resources.
+// It removes the source cluster's provider-specific status and provider reference.
+package plugin
+
+import (
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// VMImageRestoreItemAction is a restore item action plugin for VirtualMachineImage and ClusterVirtualMachineImage
+type VMImageRestoreItemAction struct {
+	log             logrus.FieldLogger
+	configMapClient corev1client.ConfigMapInterface
+}
+
+// NewVMImageRestoreItemAction creates a new VMImageRestoreItemAction
+func NewVMImageRestoreItemAction(log logrus.FieldLogger, configMapClient corev1client.ConfigMapInterface) *VMImageRestoreItemAction {
+	return &VMImageRestoreItemAction{
+		log:             log,
+		configMapClient: configMapClient,
+	}
+}
+
+// AppliesTo returns the resources this plugin applies to
+func (p *VMImageRestoreItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
+	return veleroplugin.ResourceSelector{
+		IncludedResources: []string{virtualMachineImagesResource, clusterVirtualMachineImagesResource},
+	}, nil
+}
+
+// Execute performs the restore action
+// The status of an image and its spec.providerRef describe the content library item it was
+// synced from on the source cluster. Both are removed, along with the server-assigned metadata,
+// so the image does not carry stale provider state into the target cluster.
+func (p *VMImageRestoreItemAction) Execute(input *veleroplugin.RestoreItemActionExecuteInput) (*veleroplugin.RestoreItemActionExecuteOutput, error) {
+	p.log.Infof("Executing VMImageRestoreItemAction for restore %s", input.Restore.Name)
+
+	obj := input.Item.UnstructuredContent()
+
+	kind, _, _ := unstructured.NestedString(obj, "kind")
+	namespace, _, _ := unstructured.NestedString(obj, "metadata", "namespace")
+	imageName, _, _ := unstructured.NestedString(obj, "metadata", "name")
+
+	log := p.log.WithFields(logrus.Fields{
+		"action":    VMImageRestorePluginName,
+		"restore":   input.Restore.Name,
+		"kind":      kind,
+		"namespace": namespace,
+		"image":     imageName,
+	})
+	log.Infof("Processing %s", kind)
+
+	config, err := getRestoreConfig(p.configMapClient, VMImageRestorePluginName, log)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, found := obj["status"]; found {
+		log.Info("Removing status")
+		unstructured.RemoveNestedField(obj, "status")
+	}
+
+	if _, found, _ := unstructured.NestedFieldNoCopy(obj, "spec", "providerRef"); found {
+		log.Info("Removing spec.providerRef")
+		unstructured.RemoveNestedField(obj, "spec", "providerRef")
+	}
+
+	// Remove server-assigned metadata left over from the source cluster
+	for _, field := range []string{"resourceVersion", "uid"} {
+		if _, found, _ := unstructured.NestedFieldNoCopy(obj, "metadata", field); found {
+			log.Infof("Removing metadata.%s", field)
+			unstructured.RemoveNestedField(obj, "metadata", field)
+		}
+	}
+
+	updatedItem := &unstructured.Unstructured{Object: obj}
+	if _, err := setRestoreLabel(updatedItem, config); err != nil {
+		return nil, err
+	}
+
+	return veleroplugin.NewRestoreItemActionExecuteOutput(updatedItem), nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	vmopv1common "github.com/vmware-tanzu/vm-operator/api/v1alpha5/common"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+)
+
+// newTestVMImageRestoreAction returns a VMImageRestoreItemAction with the plugin config config
+func newTestVMImageRestoreAction(config map[string]string) *VMImageRestoreItemAction {
+	log, _ := newTestLogger()
+	return NewVMImageRestoreItemAction(log, newConfigMapClient(common.PluginKindRestoreItemAction, VMImageRestorePluginName, config))
+}
+
+// newVMImage returns a v1alpha5 VirtualMachineImage in the test namespace synced from a content library item
+func newVMImage(name string) *vmopv1.VirtualMachineImage {
+	return &vmopv1.VirtualMachineImage{
+		TypeMeta: metav1.TypeMeta{APIVersion: vmopv1.GroupVersion.String(), Kind: "VirtualMachineImage"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       testNamespace,
+			Name:            name,
+			ResourceVersion: "12345",
+			UID:             "0b7c1d3e-4f5a-4b6c-8d7e-9f0a1b2c3d4e",
+		},
+		Spec: vmopv1.VirtualMachineImageSpec{
+			ProviderRef: &vmopv1common.LocalObjectRef{
+				APIVersion: "imageregistry.vmware.com/v1alpha1",
+				Kind:       "ContentLibraryItem",
+				Name:       "clitem-1",
+			},
+		},
+		Status: vmopv1.VirtualMachineImageStatus{
+			Name:                   name,
+			Firmware:               "efi",
+			ProviderContentVersion: "3",
+			Conditions:             []metav1.Condition{{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Ready"}},
+		},
+	}
+}
+
+// newClusterVMImage returns a cluster-scoped v1alpha5 ClusterVirtualMachineImage synced from a content library item
+func newClusterVMImage(name string) *vmopv1.ClusterVirtualMachineImage {
+	image := newVMImage(name)
+	return &vmopv1.ClusterVirtualMachineImage{
+		TypeMeta: metav1.TypeMeta{APIVersion: vmopv1.GroupVersion.String(), Kind: "ClusterVirtualMachineImage"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			ResourceVersion: image.ResourceVersion,
+			UID:             image.UID,
+		},
+		Spec:   image.Spec,
+		Status: image.Status,
+	}
+}
+
+func TestVMImageRestoreClearsStatus(t *testing.T) {
+	image := newVMImage("photon-5")
+	image.Labels = map[string]string{"os": "photon"}
+	clusterImage := newClusterVMImage("photon-5")
+	clusterImage.Labels = map[string]string{"os": "photon"}
+
+	for _, obj := range []runtime.Object{image, clusterImage} {
+		t.Run(obj.GetObjectKind().GroupVersionKind().Kind, func(t *testing.T) {
+			output, err := newTestVMImageRestoreAction(nil).Execute(newRestoreInput(t, obj))
+			require.NoError(t, err)
+
+			item := output.UpdatedItem.UnstructuredContent()
+			_, found := item["status"]
+			assert.False(t, found, "status should be removed")
+			_, found, _ = unstructured.NestedFieldNoCopy(item, "spec", "providerRef")
+			assert.False(t, found, "spec.providerRef should be removed")
+			_, found, _ = unstructured.NestedFieldNoCopy(item, "metadata", "resourceVersion")
+			assert.False(t, found, "metadata.resourceVersion should be removed")
+			_, found, _ = unstructured.NestedFieldNoCopy(item, "metadata", "uid")
+			assert.False(t, found, "metadata.uid should be removed")
+
+			name, _, _ := unstructured.NestedString(item, "metadata", "name")
+			assert.Equal(t, "photon-5", name)
+			label, _, _ := unstructured.NestedString(item, "metadata", "labels", "os")
+			assert.Equal(t, "photon", label)
+		})
+	}
+}
+
+func TestVMImageRestorePreservesSpec(t *testing.T) {
+	input := newRestoreInput(t, newVMImage("photon-5"))
+	// Fields the plugin does not know about, e.g. from another API version, are kept
+	require.NoError(t, unstructured.SetNestedField(input.Item.UnstructuredContent(), "OVF", "spec", "type"))
+
+	output, err := newTestVMImageRestoreAction(nil).Execute(input)
+	require.NoError(t, err)
+
+	spec, found, _ := unstructured.NestedMap(output.UpdatedItem.UnstructuredContent(), "spec")
+	require.True(t, found, "spec should be kept")
+	assert.Equal(t, map[string]interface{}{"type": "OVF"}, spec)
+}
+
+func TestVMImageRestoreWithoutStatus(t *testing.T) {
+	image := newVMImage("photon-5")
+	image.Spec = vmopv1.VirtualMachineImageSpec{}
+	image.Status = vmopv1.VirtualMachineImageStatus{}
+
+	output, err := newTestVMImageRestoreAction(nil).Execute(newRestoreInput(t, image))
+	require.NoError(t, err)
+
+	_, found, _ := unstructured.NestedFieldNoCopy(output.UpdatedItem.UnstructuredContent(), "spec", "providerRef")
+	assert.False(t, found)
+}
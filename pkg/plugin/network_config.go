@@ -0,0 +1,182 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// networkSpecFromStatusConfig converts status.network.config into the layout of spec.network
+// The status keeps IP settings under interfaces[].ip and DNS settings under dns, while the
+// spec expects them directly on each interface and on spec.network respectively
+func networkSpecFromStatusConfig(statusConfig map[string]interface{}) map[string]interface{} {
+	networkSpec := map[string]interface{}{}
+
+	for _, field := range []string{"hostName", "domainName"} {
+		if value, found, _ := unstructured.NestedString(statusConfig, "dns", field); found && value != "" {
+			networkSpec[field] = value
+		}
+	}
+	copyStringSlice(statusConfig, networkSpec, []string{"dns", "nameservers"}, "nameservers")
+	copyStringSlice(statusConfig, networkSpec, []string{"dns", "searchDomains"}, "searchDomains")
+
+	statusInterfaces, _, _ := unstructured.NestedSlice(statusConfig, "interfaces")
+
+	var specInterfaces []interface{}
+	for _, statusInterface := range statusInterfaces {
+		iface, ok := statusInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		specInterfaces = append(specInterfaces, interfaceSpecFromStatusConfig(iface))
+	}
+	if len(specInterfaces) > 0 {
+		networkSpec["interfaces"] = specInterfaces
+	}
+
+	return networkSpec
+}
+
+// interfaceSpecFromStatusConfig converts one status.network.config.interfaces entry
+// into a spec.network.interfaces entry
+func interfaceSpecFromStatusConfig(statusInterface map[string]interface{}) map[string]interface{} {
+	specInterface := map[string]interface{}{}
+
+	if name, found, _ := unstructured.NestedString(statusInterface, "name"); found {
+		specInterface["name"] = name
+	}
+
+	copyStringSlice(statusInterface, specInterface, []string{"ip", "addresses"}, "addresses")
+	for _, field := range []string{"gateway4", "gateway6"} {
+		if value, found, _ := unstructured.NestedString(statusInterface, "ip", field); found && value != "" {
+			specInterface[field] = value
+		}
+	}
+	if enabled, found, _ := unstructured.NestedBool(statusInterface, "ip", "dhcp", "ip4", "enabled"); found && enabled {
+		specInterface["dhcp4"] = true
+	}
+	if enabled, found, _ := unstructured.NestedBool(statusInterface, "ip", "dhcp", "ip6", "enabled"); found && enabled {
+		specInterface["dhcp6"] = true
+	}
+
+	copyStringSlice(statusInterface, specInterface, []string{"dns", "nameservers"}, "nameservers")
+	copyStringSlice(statusInterface, specInterface, []string{"dns", "searchDomains"}, "searchDomains")
+
+	return specInterface
+}
+
+// copyStringSlice copies the non-empty string slice found at path in src to key in dst
+func copyStringSlice(src, dst map[string]interface{}, path []string, key string) {
+	values, found, _ := unstructured.NestedStringSlice(src, path...)
+	if !found || len(values) == 0 {
+		return
+	}
+
+	copied := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		copied = append(copied, value)
+	}
+	dst[key] = copied
+}
+
+// dnsOverridesFromConfig returns the DNS fields of spec.network that dnsServers and searchDomains
+// override, mapped to their new values. A key set to an empty value clears its field, and a key
+// that is not set keeps the DNS settings of the source cluster.
+func dnsOverridesFromConfig(config map[string]string) (map[string][]string, error) {
+	overrides := map[string][]string{}
+	if value, found := config[dnsServersConfigKey]; found {
+		nameservers := parseList(value)
+		for _, nameserver := range nameservers {
+			if net.ParseIP(nameserver) == nil {
+				return nil, errors.Errorf("invalid %s config: %q is not an IP address", dnsServersConfigKey, nameserver)
+			}
+		}
+		overrides["nameservers"] = nameservers
+	}
+	if value, found := config[searchDomainsConfigKey]; found {
+		overrides["searchDomains"] = parseList(value)
+	}
+	return overrides, nil
+}
+
+// overrideDNS replaces the DNS fields of networkSpec according to overrides
+// The fields of the interfaces are removed, so the interfaces do not keep the DNS settings of the
+// source cluster over the replaced ones.
+func overrideDNS(networkSpec map[string]interface{}, overrides map[string][]string, log logrus.FieldLogger) {
+	for field, values := range overrides {
+		interfaces, _, _ := unstructured.NestedSlice(networkSpec, "interfaces")
+		for _, iface := range interfaces {
+			if ifaceSpec, ok := iface.(map[string]interface{}); ok {
+				delete(ifaceSpec, field)
+			}
+		}
+		if len(interfaces) > 0 {
+			networkSpec["interfaces"] = interfaces
+		}
+
+		if len(values) == 0 {
+			log.WithField("field", field).Info("Clearing the DNS settings of the source cluster")
+			delete(networkSpec, field)
+			continue
+		}
+		log.WithField("field", field).Infof("Replacing the DNS settings of the source cluster with %v", values)
+		copied := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			copied = append(copied, value)
+		}
+		networkSpec[field] = copied
+	}
+}
+
+// defaultStatusNetworkConfigPath is where every VM Operator API version since v1alpha2 keeps the
+// network config of a VM. v1alpha1 has no equivalent.
+const defaultStatusNetworkConfigPath = "status.network.config"
+
+// statusNetworkConfigPaths returns the dotted paths network config is looked up at, in order: the
+// default path, then those of the statusNetworkConfigPaths config for VMs backed up with a
+// different layout
+func statusNetworkConfigPaths(config map[string]string) ([]string, error) {
+	paths := []string{defaultStatusNetworkConfigPath}
+	for _, path := range parseList(config[statusNetworkConfigPathsConfigKey]) {
+		if !strings.HasPrefix(path, "status.") || slices.Contains(strings.Split(path, "."), "") {
+			return nil, errors.Errorf("invalid %s config: %q is not a dotted path under status", statusNetworkConfigPathsConfigKey, path)
+		}
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// statusNetworkConfig returns the network config at the first of paths holding an object, and the
+// path it was found at
+func statusNetworkConfig(obj map[string]interface{}, paths []string) (map[string]interface{}, string, bool) {
+	for _, path := range paths {
+		config, found, err := unstructured.NestedMap(obj, strings.Split(path, ".")...)
+		if found && err == nil {
+			return config, path, true
+		}
+	}
+	return nil, "", false
+}
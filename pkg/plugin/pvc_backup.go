@@ -0,0 +1,212 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements Velero backup item action for PVC resources.
+// It records the VirtualMachineGroup of the VM a PVC is attached to.
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// PVCBackupItemAction is a backup item action plugin for PersistentVolumeClaims
+type PVCBackupItemAction struct {
+	log    logrus.FieldLogger
+	client client.Client
+	// claimIndexes holds, per backup run, the claimIndex of each namespace, so the VMs of a
+	// namespace are listed once rather than once per PVC
+	claimIndexes *backupCache
+}
+
+// claimIndexes holds the claimIndex of each namespace a backup listed the VMs of
+// A namespace whose VMs could not be listed maps to nil.
+type claimIndexes struct {
+	mu         sync.Mutex
+	namespaces map[string]claimIndex
+}
+
+// claimIndex maps the PVCs of a namespace to the VM of a group mounting them
+type claimIndex map[string]*vmopv1.VirtualMachine
+
+// NewPVCBackupItemAction creates a new PVCBackupItemAction
+func NewPVCBackupItemAction(log logrus.FieldLogger, restConfig *rest.Config) (*PVCBackupItemAction, error) {
+	c, err := newClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPVCBackupItemActionWithClient(log, c), nil
+}
+
+// NewPVCBackupItemActionWithClient creates a new PVCBackupItemAction using the given client
+func NewPVCBackupItemActionWithClient(log logrus.FieldLogger, c client.Client) *PVCBackupItemAction {
+	return &PVCBackupItemAction{
+		log:          log,
+		client:       c,
+		claimIndexes: newBackupCache(),
+	}
+}
+
+// AppliesTo returns the resources this plugin applies to
+func (p *PVCBackupItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
+	return veleroplugin.ResourceSelector{
+		IncludedResources: []string{"persistentvolumeclaims"},
+	}, nil
+}
+
+// Execute performs the backup action
+// Annotates the backed up PVC with the VirtualMachineGroup of the VM mounting it, so
+// PVCRestoreItemAction restores that group before the PVC. PVCs not mounted by a VM
+// of a group are backed up unchanged, as are all PVCs of backups excluding VirtualMachineGroups
+// and of namespaces whose VMs cannot be listed, e.g. on clusters without VM Operator.
+func (p *PVCBackupItemAction) Execute(item runtime.Unstructured, backup *velerov1.Backup) (runtime.Unstructured, []veleroplugin.ResourceIdentifier, error) {
+	pvc := &unstructured.Unstructured{Object: item.UnstructuredContent()}
+
+	log := p.log.WithFields(logrus.Fields{
+		"action":    PVCBackupPluginName,
+		"backup":    backup.Name,
+		"namespace": pvc.GetNamespace(),
+		"pvc":       pvc.GetName(),
+	})
+
+	if !includesVMGroups(backup) {
+		return item, nil, nil
+	}
+
+	index := p.claimIndex(backup, pvc.GetNamespace(), log)
+	if index == nil {
+		return item, nil, nil
+	}
+
+	if vm, found := index[pvc.GetName()]; found {
+		log.WithFields(logrus.Fields{"vm": vm.Name, "group": vm.Spec.GroupName}).Info("PVC is attached to a VirtualMachine of a VirtualMachineGroup")
+		annotations := pvc.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[vmGroupAnnotation] = vm.Spec.GroupName
+		pvc.SetAnnotations(annotations)
+		return pvc, nil, nil
+	}
+
+	// A PVC restored by an earlier version of the plugin may still carry the group of its source VM
+	if _, found := pvc.GetAnnotations()[vmGroupAnnotation]; found {
+		log.Infof("Removing stale annotation %s", vmGroupAnnotation)
+		annotations := pvc.GetAnnotations()
+		delete(annotations, vmGroupAnnotation)
+		pvc.SetAnnotations(annotations)
+		return pvc, nil, nil
+	}
+
+	return item, nil, nil
+}
+
+// claimIndex returns the claimIndex of a namespace, listing its VMs on the first use in a backup
+// It returns nil when the VMs cannot be listed, which is logged once per backup, as a warning
+// unless VM Operator is not installed or the plugin may not list VMs.
+func (p *PVCBackupItemAction) claimIndex(backup *velerov1.Backup, namespace string, log logrus.FieldLogger) claimIndex {
+	indexes := p.claimIndexes.get(backup.UID, func() any {
+		return &claimIndexes{namespaces: make(map[string]claimIndex)}
+	}).(*claimIndexes)
+
+	indexes.mu.Lock()
+	defer indexes.mu.Unlock()
+
+	if index, found := indexes.namespaces[namespace]; found {
+		return index
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultGetTimeout)
+	defer cancel()
+
+	vmList := &vmopv1.VirtualMachineList{}
+	if err := p.client.List(ctx, vmList, client.InNamespace(namespace)); err != nil {
+		// Clusters without VM Operator and plugins not allowed to list VMs have no groups to
+		// record, which is expected and must not turn into a backup warning for every namespace
+		entry := log.WithError(err)
+		message := fmt.Sprintf("Failed to list VirtualMachines in namespace %s - backing up its PVCs without their VirtualMachineGroup", namespace)
+		switch {
+		case meta.IsNoMatchError(err):
+			entry.Debug(message)
+		case apierrors.IsForbidden(err):
+			entry.Info(message)
+		default:
+			entry.Warn(message)
+		}
+		indexes.namespaces[namespace] = nil
+		return nil
+	}
+
+	index := make(claimIndex)
+	for i := range vmList.Items {
+		vm := &vmList.Items[i]
+		if vm.Spec.GroupName == "" {
+			continue
+		}
+		for _, volume := range vm.Spec.Volumes {
+			if volume.PersistentVolumeClaim == nil {
+				continue
+			}
+			// The first VM listed wins when VMs of several groups mount the same claim
+			if _, found := index[volume.PersistentVolumeClaim.ClaimName]; !found {
+				index[volume.PersistentVolumeClaim.ClaimName] = vm
+			}
+		}
+	}
+	indexes.namespaces[namespace] = index
+	return index
+}
+
+// includesVMGroups reports whether a backup may include VirtualMachineGroups
+// Only then can PVCRestoreItemAction restore the group of a PVC first, so the PVCs of other
+// backups are left alone without listing the VMs of their namespace.
+func includesVMGroups(backup *velerov1.Backup) bool {
+	included := backup.Spec.IncludedResources
+	if len(backup.Spec.IncludedNamespaceScopedResources) > 0 {
+		included = backup.Spec.IncludedNamespaceScopedResources
+	}
+	if len(included) > 0 && !matchesVMGroups(included) {
+		return false
+	}
+	return !matchesVMGroups(backup.Spec.ExcludedResources) && !matchesVMGroups(backup.Spec.ExcludedNamespaceScopedResources)
+}
+
+// matchesVMGroups reports whether a resource filter of a backup names VirtualMachineGroups
+func matchesVMGroups(resources []string) bool {
+	for _, resource := range resources {
+		switch strings.ToLower(strings.TrimSpace(resource)) {
+		case "*", "virtualmachinegroups", virtualMachineGroupsResource:
+			return true
+		}
+	}
+	return false
+}
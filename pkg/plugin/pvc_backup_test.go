@@ -0,0 +1,207 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+)
+
+// mountingVM returns a VM of the group groupName mounting the named claim
+func mountingVM(name, groupName, claimName string) *vmopv1.VirtualMachine {
+	vm := newVM(name)
+	vm.Spec.GroupName = groupName
+	vm.Spec.Volumes = []vmopv1.VirtualMachineVolume{{
+		Name: "disk",
+		VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+			PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{},
+		},
+	}}
+	vm.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = claimName
+	return vm
+}
+
+func TestPVCBackupAnnotatesGroup(t *testing.T) {
+	tests := []struct {
+		name        string
+		objs        []client.Object
+		annotations map[string]string
+		expected    map[string]string
+	}{
+		{
+			name:     "mounted by a VM of a group",
+			objs:     []client.Object{mountingVM("vm-1", "group-1", "data")},
+			expected: map[string]string{vmGroupAnnotation: "group-1"},
+		},
+		{
+			name: "mounted by a VM without a group",
+			objs: []client.Object{mountingVM("vm-1", "", "data")},
+		},
+		{
+			name: "not mounted",
+			objs: []client.Object{mountingVM("vm-1", "group-1", "other")},
+		},
+		{
+			name:        "stale annotation of a restored PVC",
+			annotations: map[string]string{vmGroupAnnotation: "group-1", "keep.example.com/note": "keep"},
+			expected:    map[string]string{"keep.example.com/note": "keep"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, _ := newTestLogger()
+			action := NewPVCBackupItemActionWithClient(log, newFakeClient(t, tt.objs...))
+
+			pvc := newPVC("data")
+			pvc.Annotations = tt.annotations
+
+			item, additionalItems, err := action.Execute(toUnstructured(t, pvc), &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+			require.NoError(t, err)
+			assert.Empty(t, additionalItems)
+
+			backedUp := &unstructured.Unstructured{Object: item.UnstructuredContent()}
+			assert.Equal(t, tt.expected, backedUp.GetAnnotations())
+		})
+	}
+}
+
+func TestPVCBackupListsVMsOncePerBackup(t *testing.T) {
+	counter := &requestCounter{}
+	log, _ := newTestLogger()
+	action := NewPVCBackupItemActionWithClient(log, newInterceptedFakeClient(t, counter.funcs(),
+		mountingVM("vm-1", "group-1", "data-1"), mountingVM("vm-2", "group-2", "data-2")))
+
+	for _, uid := range []types.UID{"backup-uid-1", "backup-uid-2"} {
+		backup := &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1", UID: uid}}
+		for i, claimName := range []string{"data-1", "data-2"} {
+			item, _, err := action.Execute(toUnstructured(t, newPVC(claimName)), backup)
+			require.NoError(t, err)
+
+			backedUp := &unstructured.Unstructured{Object: item.UnstructuredContent()}
+			assert.Equal(t, fmt.Sprintf("group-%d", i+1), backedUp.GetAnnotations()[vmGroupAnnotation])
+		}
+	}
+	assert.Equal(t, int32(2), counter.vmLists.Load())
+}
+
+func TestPVCBackupListError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedLevel logrus.Level
+	}{
+		{
+			name:          "VM Operator not installed",
+			err:           &meta.NoKindMatchError{GroupKind: vmopv1.GroupVersion.WithKind("VirtualMachine").GroupKind()},
+			expectedLevel: logrus.DebugLevel,
+		},
+		{
+			name:          "forbidden",
+			err:           apierrors.NewForbidden(vmopv1.GroupVersion.WithResource("virtualmachines").GroupResource(), "", errors.New("no RBAC")),
+			expectedLevel: logrus.InfoLevel,
+		},
+		{
+			name:          "unexpected error",
+			err:           errors.New("connection refused"),
+			expectedLevel: logrus.WarnLevel,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lists atomic.Int32
+			log, hook := newTestLogger()
+			action := NewPVCBackupItemActionWithClient(log, newInterceptedFakeClient(t, interceptor.Funcs{
+				List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+					lists.Add(1)
+					return tt.err
+				},
+			}))
+			backup := &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1", UID: "backup-uid-1"}}
+
+			for range 2 {
+				pvc := newPVC("data")
+				pvc.Annotations = map[string]string{vmGroupAnnotation: "group-1"}
+				item := toUnstructured(t, pvc)
+
+				backedUp, additionalItems, err := action.Execute(item, backup)
+				require.NoError(t, err)
+				assert.Empty(t, additionalItems)
+				assert.Same(t, item, backedUp)
+			}
+			assert.Equal(t, int32(1), lists.Load())
+
+			entry := entryWithMessage(t, hook, "Failed to list VirtualMachines in namespace vm-ns - backing up its PVCs without their VirtualMachineGroup")
+			assert.Equal(t, tt.expectedLevel, entry.Level)
+		})
+	}
+}
+
+func TestPVCBackupExcludedGroups(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     velerov1.BackupSpec
+		expected map[string]string
+	}{
+		{name: "all resources", expected: map[string]string{vmGroupAnnotation: "group-1"}},
+		{
+			name:     "groups included",
+			spec:     velerov1.BackupSpec{IncludedResources: []string{"persistentvolumeclaims", "virtualmachinegroups.vmoperator.vmware.com"}},
+			expected: map[string]string{vmGroupAnnotation: "group-1"},
+		},
+		{name: "groups not included", spec: velerov1.BackupSpec{IncludedResources: []string{"persistentvolumeclaims"}}},
+		{name: "groups excluded", spec: velerov1.BackupSpec{ExcludedResources: []string{"VirtualMachineGroups"}}},
+		{name: "groups not included as namespace-scoped resources", spec: velerov1.BackupSpec{IncludedNamespaceScopedResources: []string{"persistentvolumeclaims"}}},
+		{name: "groups excluded as namespace-scoped resources", spec: velerov1.BackupSpec{ExcludedNamespaceScopedResources: []string{"virtualmachinegroups"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &requestCounter{}
+			log, _ := newTestLogger()
+			action := NewPVCBackupItemActionWithClient(log, newInterceptedFakeClient(t, counter.funcs(), mountingVM("vm-1", "group-1", "data")))
+
+			backup := &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}, Spec: tt.spec}
+			item, _, err := action.Execute(toUnstructured(t, newPVC("data")), backup)
+			require.NoError(t, err)
+
+			backedUp := &unstructured.Unstructured{Object: item.UnstructuredContent()}
+			assert.Equal(t, tt.expected, backedUp.GetAnnotations())
+			if tt.expected == nil {
+				assert.Zero(t, counter.vmLists.Load())
+			}
+		})
+	}
+}
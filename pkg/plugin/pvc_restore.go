@@ -15,34 +15,113 @@ limitations under the License.
 */
 
 // Package plugin implements Velero restore item action for PVC resources.
-// It removes volume health annotations that shouldn't be restored.
+// It removes cluster-specific annotations and labels that shouldn't be restored.
 package plugin
 
 import (
-	"strings"
+	"context"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	riav2 "github.com/vmware-tanzu/velero/pkg/plugin/velero/restoreitemaction/v2"
 )
 
+// removeAnnotationsConfigKey is the plugin config key holding a comma-separated list
+// of annotation keys to remove from restored PVCs. Entries ending in "*" match by prefix.
+const removeAnnotationsConfigKey = "removeAnnotations"
+
+// defaultPVCAnnotationsToRemove are removed when removeAnnotations is not configured
+var defaultPVCAnnotationsToRemove = []string{"volumehealth.storage.kubernetes.io/health"}
+
+// storageClassMappingConfigKey is the plugin config key holding a comma-separated list
+// of "old:new" storage class names used to rewrite spec.storageClassName
+const storageClassMappingConfigKey = "storageClassMapping"
+
+// accessModeMappingConfigKey is the plugin config key holding a comma-separated list of
+// "old:new" access modes used to rewrite spec.accessModes, e.g. "ReadWriteMany:ReadWriteOnce"
+// for target clusters whose storage does not support the backed up mode
+const accessModeMappingConfigKey = "accessModeMapping"
+
+// validAccessModes are the access modes accessModeMapping accepts
+var validAccessModes = map[corev1.PersistentVolumeAccessMode]struct{}{
+	corev1.ReadWriteOnce:    {},
+	corev1.ReadOnlyMany:     {},
+	corev1.ReadWriteMany:    {},
+	corev1.ReadWriteOncePod: {},
+}
+
+// clearDataSourceConfigKey is the plugin config key controlling whether spec.dataSource and
+// spec.dataSourceRef are removed from restored PVCs. They usually reference clone sources of the
+// source cluster, which keep the PVC from binding. VolumeSnapshot sources are kept as Velero's CSI
+// snapshot restore provisions the PVC from them.
+const clearDataSourceConfigKey = "clearDataSource"
+
+// volumeSnapshotGroup is the API group of CSI VolumeSnapshots
+const volumeSnapshotGroup = "snapshot.storage.k8s.io"
+
+// clearVolumeNameConfigKey is the plugin config key controlling whether spec.volumeName is
+// removed from restored PVCs so they bind to a freshly provisioned volume. It is off by default
+// as restores that also restore the PV rely on the PVC keeping its volume name.
+const clearVolumeNameConfigKey = "clearVolumeName"
+
+// clusterSpecificPVCAnnotations are always removed from restored PVCs as they
+// reference entities of the source cluster that can stall binding
+var clusterSpecificPVCAnnotations = []string{
+	"volume.kubernetes.io/selected-node",
+	"cns.vmware.com/*",
+}
+
+// clusterSpecificPVCLabels are always removed from restored PVCs
+var clusterSpecificPVCLabels = []string{
+	"cns.vmware.com/*",
+}
+
+// vmGroupAnnotation associates a PVC with the VirtualMachineGroup of the VM it is attached to.
+// PVCBackupItemAction sets it on backed up PVCs, and annotated PVCs are restored after that
+// group the same way the VMs of the group are.
+const vmGroupAnnotation = "lubronzhan.io/vmgroup"
+
 // PVCRestoreItemAction is a restore item action plugin for PersistentVolumeClaims
 type PVCRestoreItemAction struct {
-	log logrus.FieldLogger
+	log             logrus.FieldLogger
+	client          client.Client
+	configMapClient corev1client.ConfigMapInterface
 }
 
 // NewPVCRestoreItemAction creates a new PVCRestoreItemAction
-func NewPVCRestoreItemAction(log logrus.FieldLogger) *PVCRestoreItemAction {
+func NewPVCRestoreItemAction(log logrus.FieldLogger, restConfig *rest.Config, configMapClient corev1client.ConfigMapInterface) (*PVCRestoreItemAction, error) {
+	c, err := newClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPVCRestoreItemActionWithClient(log, c, configMapClient), nil
+}
+
+// NewPVCRestoreItemActionWithClient creates a new PVCRestoreItemAction using the given client
+func NewPVCRestoreItemActionWithClient(log logrus.FieldLogger, c client.Client, configMapClient corev1client.ConfigMapInterface) *PVCRestoreItemAction {
 	return &PVCRestoreItemAction{
-		log: log,
+		log:             log,
+		client:          c,
+		configMapClient: configMapClient,
 	}
 }
 
+// Name returns the name of this plugin
+func (p *PVCRestoreItemAction) Name() string {
+	return PVCRestorePluginName
+}
+
 // AppliesTo returns the resources this plugin applies to
 func (p *PVCRestoreItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
 	return veleroplugin.ResourceSelector{
@@ -51,7 +130,7 @@ func (p *PVCRestoreItemAction) AppliesTo() (veleroplugin.ResourceSelector, error
 }
 
 // Execute performs the restore action
-// Removes volume health annotations that shouldn't be restored
+// Removes cluster-specific annotations that shouldn't be restored
 func (p *PVCRestoreItemAction) Execute(input *veleroplugin.RestoreItemActionExecuteInput) (*veleroplugin.RestoreItemActionExecuteOutput, error) {
 	p.log.Info("Executing PVCRestoreItemAction")
 
@@ -61,30 +140,201 @@ func (p *PVCRestoreItemAction) Execute(input *veleroplugin.RestoreItemActionExec
 		return nil, errors.Wrap(err, "failed to convert item to PersistentVolumeClaim")
 	}
 
-	p.log.Infof("Processing PVC %s/%s", pvc.Namespace, pvc.Name)
+	log := p.log.WithFields(logrus.Fields{
+		"action":    PVCRestorePluginName,
+		"restore":   input.Restore.Name,
+		"namespace": pvc.Namespace,
+		"pvc":       pvc.Name,
+	})
+	log.Info("Processing PVC")
+
+	config, err := getRestoreConfig(p.configMapClient, PVCRestorePluginName, log)
+	if err != nil {
+		return nil, err
+	}
+
+	annotationsToRemove := defaultPVCAnnotationsToRemove
+	if value, found := config[removeAnnotationsConfigKey]; found {
+		annotationsToRemove = parseList(value)
+	}
 
 	if pvc.Annotations != nil {
-		// Remove volume health annotation
-		if _, exists := pvc.Annotations["volumehealth.storage.kubernetes.io/health"]; exists {
-			p.log.Infof("Removing volumehealth annotation from PVC %s/%s", pvc.Namespace, pvc.Name)
-			delete(pvc.Annotations, "volumehealth.storage.kubernetes.io/health")
-		}
 		for key := range pvc.Annotations {
-			// Remove annotation key with prefix cns.vmware.com/usedby-vm-
-			if strings.HasPrefix(key, "cns.vmware.com/usedby-vm-") {
-				p.log.Infof("Removing annotation %s from PVC %s/%s", key, pvc.Namespace, pvc.Name)
+			// Remove configured annotations - volume health by default
+			if matchesAnyKey(key, annotationsToRemove) {
+				log.WithField("annotation", key).Info("Removing annotation")
 				delete(pvc.Annotations, key)
+				continue
+			}
+			// Remove annotations pointing at source cluster entities - CNS volumes, VMs and nodes
+			if matchesAnyKey(key, clusterSpecificPVCAnnotations) {
+				log.WithField("annotation", key).Info("Removing annotation")
+				delete(pvc.Annotations, key)
+			}
+		}
+	}
+
+	// The group annotation only orders the restore, so it is not kept on the restored PVC
+	vmGroupName := pvc.Annotations[vmGroupAnnotation]
+	delete(pvc.Annotations, vmGroupAnnotation)
+
+	for key := range pvc.Labels {
+		if matchesAnyKey(key, clusterSpecificPVCLabels) {
+			log.WithField("label", key).Info("Removing label")
+			delete(pvc.Labels, key)
+		}
+	}
+
+	// Remap the storage class to one that exists in the target cluster
+	if value, found := config[storageClassMappingConfigKey]; found {
+		storageClassMapping, err := parseMapping(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s config", storageClassMappingConfigKey)
+		}
+		if pvc.Spec.StorageClassName != nil {
+			if newStorageClass, mapped := storageClassMapping[*pvc.Spec.StorageClassName]; mapped {
+				log.Infof("Changing storage class from %s to %s", *pvc.Spec.StorageClassName, newStorageClass)
+				pvc.Spec.StorageClassName = &newStorageClass
 			}
 		}
 	}
 
+	// Remap the access modes to ones the storage of the target cluster supports
+	if value, found := config[accessModeMappingConfigKey]; found {
+		accessModeMapping, err := parseAccessModeMapping(value)
+		if err != nil {
+			return nil, err
+		}
+		pvc.Spec.AccessModes = remapAccessModes(pvc.Spec.AccessModes, accessModeMapping, log)
+	}
+
+	// Remove data sources of the source cluster so the PVC can bind
+	clearDataSource, err := getBool(config, clearDataSourceConfigKey, true)
+	if err != nil {
+		return nil, err
+	}
+	if clearDataSource {
+		if source := pvc.Spec.DataSource; source != nil && !isVolumeSnapshot(source.APIGroup, source.Kind) {
+			log.Infof("Removing spec.dataSource %s/%s", source.Kind, source.Name)
+			pvc.Spec.DataSource = nil
+		}
+		if source := pvc.Spec.DataSourceRef; source != nil && !isVolumeSnapshot(source.APIGroup, source.Kind) {
+			log.Infof("Removing spec.dataSourceRef %s/%s", source.Kind, source.Name)
+			pvc.Spec.DataSourceRef = nil
+		}
+	}
+
+	// Let the PVC bind to a new volume instead of the PV of the source cluster
+	clearVolumeName, err := getBool(config, clearVolumeNameConfigKey, false)
+	if err != nil {
+		return nil, err
+	}
+	if clearVolumeName && pvc.Spec.VolumeName != "" {
+		log.Infof("Removing spec.volumeName %s", pvc.Spec.VolumeName)
+		pvc.Spec.VolumeName = ""
+		// The bind annotations refer to the removed volume and would keep the PVC from binding
+		delete(pvc.Annotations, "pv.kubernetes.io/bind-completed")
+		delete(pvc.Annotations, "pv.kubernetes.io/bound-by-controller")
+	}
+
 	// Convert back to unstructured
 	unstructuredPVC, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pvc)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to convert PVC to unstructured")
 	}
 
-	return &veleroplugin.RestoreItemActionExecuteOutput{
-		UpdatedItem: &unstructured.Unstructured{Object: unstructuredPVC},
-	}, nil
+	updatedItem := &unstructured.Unstructured{Object: unstructuredPVC}
+	if err := clearManagedFields(updatedItem, config, log); err != nil {
+		return nil, err
+	}
+	if _, err := setRestoreLabel(updatedItem, config); err != nil {
+		return nil, err
+	}
+
+	output := veleroplugin.NewRestoreItemActionExecuteOutput(updatedItem)
+
+	// Restore the owning VirtualMachineGroup first when the PVC is associated with one
+	// The group is looked up under the namespace and name of the backup, the same way as for VMs.
+	if vmGroupName != "" {
+		log.WithField("group", vmGroupName).Info("PVC belongs to VirtualMachineGroup")
+
+		vmRestoreConfig, err := getRestoreConfig(p.configMapClient, VMRestorePluginName, log)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get vm-restore plugin config")
+		}
+
+		output.AdditionalItems = []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(pvc.Namespace, vmGroupName)}
+		output.WaitForAdditionalItems = true
+		output.AdditionalItemsReadyTimeout = waitForGroupTimeout(vmRestoreConfig, log)
+	}
+
+	return output, nil
+}
+
+// parseAccessModeMapping parses the accessModeMapping config and validates its access modes
+func parseAccessModeMapping(value string) (map[corev1.PersistentVolumeAccessMode]corev1.PersistentVolumeAccessMode, error) {
+	mapping, err := parseMapping(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid %s config", accessModeMappingConfigKey)
+	}
+
+	accessModeMapping := make(map[corev1.PersistentVolumeAccessMode]corev1.PersistentVolumeAccessMode, len(mapping))
+	for from, to := range mapping {
+		for _, mode := range []string{from, to} {
+			if _, valid := validAccessModes[corev1.PersistentVolumeAccessMode(mode)]; !valid {
+				return nil, errors.Errorf("invalid %s config: unknown access mode %q", accessModeMappingConfigKey, mode)
+			}
+		}
+		accessModeMapping[corev1.PersistentVolumeAccessMode(from)] = corev1.PersistentVolumeAccessMode(to)
+	}
+	return accessModeMapping, nil
+}
+
+// remapAccessModes rewrites access modes according to accessModeMapping, leaving unmapped ones unchanged
+// Modes mapped onto one another are only listed once.
+func remapAccessModes(accessModes []corev1.PersistentVolumeAccessMode, accessModeMapping map[corev1.PersistentVolumeAccessMode]corev1.PersistentVolumeAccessMode, log logrus.FieldLogger) []corev1.PersistentVolumeAccessMode {
+	if len(accessModes) == 0 {
+		return accessModes
+	}
+
+	remapped := make([]corev1.PersistentVolumeAccessMode, 0, len(accessModes))
+	seen := make(map[corev1.PersistentVolumeAccessMode]struct{}, len(accessModes))
+	for _, mode := range accessModes {
+		if newMode, mapped := accessModeMapping[mode]; mapped {
+			log.Infof("Changing access mode from %s to %s", mode, newMode)
+			mode = newMode
+		}
+		if _, exists := seen[mode]; exists {
+			continue
+		}
+		seen[mode] = struct{}{}
+		remapped = append(remapped, mode)
+	}
+	return remapped
+}
+
+// Progress is not supported as the plugin starts no asynchronous operations
+func (p *PVCRestoreItemAction) Progress(operationID string, restore *velerov1.Restore) (veleroplugin.OperationProgress, error) {
+	return veleroplugin.OperationProgress{}, riav2.AsyncOperationsNotSupportedError()
+}
+
+// Cancel is not supported as the plugin starts no asynchronous operations
+func (p *PVCRestoreItemAction) Cancel(operationID string, restore *velerov1.Restore) error {
+	return riav2.AsyncOperationsNotSupportedError()
+}
+
+// AreAdditionalItemsReady reports whether the restored VirtualMachineGroup of a PVC has been reconciled
+// The group is renamed according to the vm-restore plugin config, so it is read from there.
+func (p *PVCRestoreItemAction) AreAdditionalItemsReady(additionalItems []veleroplugin.ResourceIdentifier, restore *velerov1.Restore) (bool, error) {
+	config, err := getRestoreConfig(p.configMapClient, VMRestorePluginName, p.log)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get vm-restore plugin config")
+	}
+
+	return areGroupsReady(context.Background(), p.client, p.log, additionalItems, restore, config)
+}
+
+// isVolumeSnapshot reports whether a PVC data source is a CSI VolumeSnapshot
+func isVolumeSnapshot(apiGroup *string, kind string) bool {
+	return apiGroup != nil && *apiGroup == volumeSnapshotGroup && kind == "VolumeSnapshot"
 }
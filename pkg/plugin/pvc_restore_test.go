@@ -0,0 +1,419 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// newPVC returns a PVC in the test namespace
+func newPVC(name string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name},
+	}
+}
+
+// executePVCRestore runs the PVC restore action with the plugin config config and returns
+// the output and the restored PVC
+func executePVCRestore(t *testing.T, config map[string]string, pvc *corev1.PersistentVolumeClaim) (*veleroplugin.RestoreItemActionExecuteOutput, *corev1.PersistentVolumeClaim) {
+	t.Helper()
+
+	log, _ := newTestLogger()
+	action := NewPVCRestoreItemActionWithClient(log, newFakeClient(t), newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName, config))
+
+	output, err := action.Execute(newRestoreInput(t, pvc))
+	require.NoError(t, err)
+
+	restored := &corev1.PersistentVolumeClaim{}
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(output.UpdatedItem.UnstructuredContent(), restored))
+	return output, restored
+}
+
+func TestPVCRestoreRemoveAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		"volumehealth.storage.kubernetes.io/health": "accessible",
+		"csi.example.com/volume-id":                 "vol-1",
+		"csi.example.com/node":                      "node-1",
+		"backup.example.com/owner":                  "team-a",
+		"keep.example.com/note":                     "keep",
+	}
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected map[string]string
+	}{
+		{
+			name:   "default removes volume health",
+			config: nil,
+			expected: map[string]string{
+				"csi.example.com/volume-id": "vol-1",
+				"csi.example.com/node":      "node-1",
+				"backup.example.com/owner":  "team-a",
+				"keep.example.com/note":     "keep",
+			},
+		},
+		{
+			name:   "multiple keys",
+			config: map[string]string{removeAnnotationsConfigKey: "backup.example.com/owner, csi.example.com/node"},
+			expected: map[string]string{
+				"volumehealth.storage.kubernetes.io/health": "accessible",
+				"csi.example.com/volume-id":                 "vol-1",
+				"keep.example.com/note":                     "keep",
+			},
+		},
+		{
+			name:   "wildcard",
+			config: map[string]string{removeAnnotationsConfigKey: "csi.example.com/*,volumehealth.storage.kubernetes.io/health"},
+			expected: map[string]string{
+				"backup.example.com/owner": "team-a",
+				"keep.example.com/note":    "keep",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pvc := newPVC("pvc-1")
+			pvc.Annotations = map[string]string{}
+			for key, value := range annotations {
+				pvc.Annotations[key] = value
+			}
+
+			_, restored := executePVCRestore(t, tc.config, pvc)
+
+			assert.Equal(t, tc.expected, restored.Annotations)
+		})
+	}
+}
+
+func TestPVCRestoreRemovesCNSMetadata(t *testing.T) {
+	pvc := newPVC("pvc-1")
+	pvc.Annotations = map[string]string{
+		"cns.vmware.com/pvc-protection":            "true",
+		"cns.vmware.com/volume-id":                 "vol-1",
+		"volume.kubernetes.io/selected-node":       "node-1",
+		"volume.kubernetes.io/storage-provisioner": "csi.vsphere.vmware.com",
+		"app.example.com/tier":                     "db",
+	}
+	pvc.Labels = map[string]string{
+		"cns.vmware.com/managed": "true",
+		"app":                    "db",
+	}
+
+	_, restored := executePVCRestore(t, nil, pvc)
+
+	assert.Equal(t, map[string]string{
+		"volume.kubernetes.io/storage-provisioner": "csi.vsphere.vmware.com",
+		"app.example.com/tier":                     "db",
+	}, restored.Annotations)
+	assert.Equal(t, map[string]string{
+		"app":         "db",
+		"restored-by": "velero-vmgroup-plugin",
+	}, restored.Labels)
+
+	// Restoring the already stripped PVC again changes nothing
+	_, restoredAgain := executePVCRestore(t, nil, restored)
+	assert.Equal(t, restored.Annotations, restoredAgain.Annotations)
+	assert.Equal(t, restored.Labels, restoredAgain.Labels)
+}
+
+func TestPVCRestoreStorageClassMapping(t *testing.T) {
+	storageClass := func(name string) *string { return &name }
+
+	tests := []struct {
+		name         string
+		config       map[string]string
+		storageClass *string
+		expected     *string
+	}{
+		{
+			name:         "matched",
+			config:       map[string]string{storageClassMappingConfigKey: "gold:vsan-gold,silver:vsan-silver"},
+			storageClass: storageClass("silver"),
+			expected:     storageClass("vsan-silver"),
+		},
+		{
+			name:         "unmatched",
+			config:       map[string]string{storageClassMappingConfigKey: "gold:vsan-gold"},
+			storageClass: storageClass("bronze"),
+			expected:     storageClass("bronze"),
+		},
+		{
+			name:         "empty mapping",
+			config:       map[string]string{storageClassMappingConfigKey: ""},
+			storageClass: storageClass("gold"),
+			expected:     storageClass("gold"),
+		},
+		{
+			name:         "no storage class",
+			config:       map[string]string{storageClassMappingConfigKey: "gold:vsan-gold"},
+			storageClass: nil,
+			expected:     nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pvc := newPVC("pvc-1")
+			pvc.Spec.StorageClassName = tc.storageClass
+
+			_, restored := executePVCRestore(t, tc.config, pvc)
+
+			assert.Equal(t, tc.expected, restored.Spec.StorageClassName)
+		})
+	}
+}
+
+func TestPVCRestoreInvalidStorageClassMapping(t *testing.T) {
+	log, _ := newTestLogger()
+	action := NewPVCRestoreItemActionWithClient(log, newFakeClient(t), newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName,
+		map[string]string{storageClassMappingConfigKey: "gold"}))
+
+	_, err := action.Execute(newRestoreInput(t, newPVC("pvc-1")))
+	assert.ErrorContains(t, err, "invalid storageClassMapping config")
+}
+
+func TestPVCRestoreAccessModeMapping(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      map[string]string
+		accessModes []corev1.PersistentVolumeAccessMode
+		expected    []corev1.PersistentVolumeAccessMode
+	}{
+		{
+			name:        "remapped",
+			config:      map[string]string{accessModeMappingConfigKey: "ReadWriteMany:ReadWriteOnce"},
+			accessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			expected:    []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		},
+		{
+			name:        "merged",
+			config:      map[string]string{accessModeMappingConfigKey: "ReadWriteMany:ReadWriteOnce"},
+			accessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadWriteMany, corev1.ReadOnlyMany},
+			expected:    []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce, corev1.ReadOnlyMany},
+		},
+		{
+			name:        "unmapped",
+			config:      map[string]string{accessModeMappingConfigKey: "ReadWriteMany:ReadWriteOnce"},
+			accessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+			expected:    []corev1.PersistentVolumeAccessMode{corev1.ReadOnlyMany},
+		},
+		{
+			name:        "not configured",
+			accessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+			expected:    []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pvc := newPVC("pvc-1")
+			pvc.Spec.AccessModes = tc.accessModes
+
+			_, restored := executePVCRestore(t, tc.config, pvc)
+
+			assert.Equal(t, tc.expected, restored.Spec.AccessModes)
+		})
+	}
+}
+
+func TestPVCRestoreInvalidAccessModeMapping(t *testing.T) {
+	for value, expectedErr := range map[string]string{
+		"ReadWriteMany":               "invalid accessModeMapping config",
+		"ReadWriteMany:ReadWriteOnly": `invalid accessModeMapping config: unknown access mode "ReadWriteOnly"`,
+		"RWX:ReadWriteOnce":           `invalid accessModeMapping config: unknown access mode "RWX"`,
+	} {
+		t.Run(value, func(t *testing.T) {
+			log, _ := newTestLogger()
+			action := NewPVCRestoreItemActionWithClient(log, newFakeClient(t), newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName,
+				map[string]string{accessModeMappingConfigKey: value}))
+
+			_, err := action.Execute(newRestoreInput(t, newPVC("pvc-1")))
+			assert.ErrorContains(t, err, expectedErr)
+		})
+	}
+}
+
+func TestPVCRestoreWaitsForVMGroup(t *testing.T) {
+	t.Run("annotated", func(t *testing.T) {
+		pvc := newPVC("data")
+		pvc.Annotations = map[string]string{vmGroupAnnotation: "group-1"}
+
+		output, restored := executePVCRestore(t, nil, pvc)
+		assert.Equal(t, []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")}, output.AdditionalItems)
+		assert.True(t, output.WaitForAdditionalItems)
+		assert.Equal(t, defaultWaitForGroupTimeout, output.AdditionalItemsReadyTimeout)
+		assert.NotContains(t, restored.Annotations, vmGroupAnnotation)
+	})
+
+	t.Run("not annotated", func(t *testing.T) {
+		output, _ := executePVCRestore(t, nil, newPVC("data"))
+		assert.Empty(t, output.AdditionalItems)
+		assert.False(t, output.WaitForAdditionalItems)
+	})
+}
+
+func TestPVCRestoreAreAdditionalItemsReady(t *testing.T) {
+	reconciled := reconciledVMGroup("group-1", metav1.ConditionFalse)
+	pending := newVMGroup("group-1")
+
+	tests := []struct {
+		name     string
+		group    *vmopv1.VirtualMachineGroup
+		expected bool
+	}{
+		{name: "group not restored", expected: true},
+		{name: "group not reconciled yet", group: pending, expected: false},
+		{name: "group reconciled", group: reconciled, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClient(t)
+			if tt.group != nil {
+				c = newFakeClient(t, tt.group)
+			}
+
+			log, _ := newTestLogger()
+			action := NewPVCRestoreItemActionWithClient(log, c, newConfigMapClient(common.PluginKindRestoreItemAction, VMRestorePluginName, nil))
+
+			ready, err := action.AreAdditionalItemsReady(
+				[]veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")},
+				newRestoreInput(t, newPVC("data")).Restore,
+			)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ready)
+		})
+	}
+}
+
+func TestPVCRestoreAreAdditionalItemsReadyRenamedGroup(t *testing.T) {
+	log, _ := newTestLogger()
+	action := NewPVCRestoreItemActionWithClient(log, newFakeClient(t, reconciledVMGroup("group-1-staging", metav1.ConditionTrue)),
+		newConfigMapClient(common.PluginKindRestoreItemAction, VMRestorePluginName, map[string]string{"GroupNameSuffix": "-staging"}))
+
+	ready, err := action.AreAdditionalItemsReady(
+		[]veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")},
+		newRestoreInput(t, newPVC("data")).Restore,
+	)
+	require.NoError(t, err)
+	assert.True(t, ready)
+}
+
+func TestPVCRestoreClearDataSource(t *testing.T) {
+	snapshotGroup := volumeSnapshotGroup
+	clone := &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "source"}
+	snapshot := &corev1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"}
+	cloneRef := &corev1.TypedObjectReference{Kind: "PersistentVolumeClaim", Name: "source"}
+	snapshotRef := &corev1.TypedObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"}
+
+	tests := []struct {
+		name                  string
+		config                map[string]string
+		dataSource            *corev1.TypedLocalObjectReference
+		dataSourceRef         *corev1.TypedObjectReference
+		expectedDataSource    *corev1.TypedLocalObjectReference
+		expectedDataSourceRef *corev1.TypedObjectReference
+	}{
+		{name: "clone dataSource", dataSource: clone},
+		{name: "clone dataSourceRef", dataSourceRef: cloneRef},
+		{
+			name:                  "VolumeSnapshot sources are kept",
+			dataSource:            snapshot,
+			dataSourceRef:         snapshotRef,
+			expectedDataSource:    snapshot,
+			expectedDataSourceRef: snapshotRef,
+		},
+		{
+			name:                  "disabled",
+			config:                map[string]string{clearDataSourceConfigKey: "false"},
+			dataSource:            clone,
+			dataSourceRef:         cloneRef,
+			expectedDataSource:    clone,
+			expectedDataSourceRef: cloneRef,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pvc := newPVC("data")
+			pvc.Spec.VolumeName = "pv-1"
+			pvc.Spec.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+			pvc.Spec.DataSource = tt.dataSource
+			pvc.Spec.DataSourceRef = tt.dataSourceRef
+
+			_, restored := executePVCRestore(t, tt.config, pvc)
+
+			assert.Equal(t, tt.expectedDataSource, restored.Spec.DataSource)
+			assert.Equal(t, tt.expectedDataSourceRef, restored.Spec.DataSourceRef)
+			assert.Equal(t, "pv-1", restored.Spec.VolumeName)
+			assert.Equal(t, []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}, restored.Spec.AccessModes)
+		})
+	}
+}
+
+func TestPVCRestoreClearVolumeName(t *testing.T) {
+	bindAnnotations := map[string]string{
+		"pv.kubernetes.io/bind-completed":      "yes",
+		"pv.kubernetes.io/bound-by-controller": "yes",
+	}
+
+	tests := []struct {
+		name                string
+		config              map[string]string
+		expectedVolumeName  string
+		expectedAnnotations map[string]string
+	}{
+		{name: "preserved by default", expectedVolumeName: "pv-1", expectedAnnotations: bindAnnotations},
+		{name: "cleared", config: map[string]string{clearVolumeNameConfigKey: "true"}, expectedVolumeName: "", expectedAnnotations: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pvc := newPVC("data")
+			pvc.Spec.VolumeName = "pv-1"
+			pvc.Annotations = maps.Clone(bindAnnotations)
+
+			_, restored := executePVCRestore(t, tt.config, pvc)
+
+			assert.Equal(t, tt.expectedVolumeName, restored.Spec.VolumeName)
+			assert.Equal(t, tt.expectedAnnotations, restored.Annotations)
+		})
+	}
+}
+
+func TestPVCRestoreInvalidClearVolumeName(t *testing.T) {
+	log, _ := newTestLogger()
+	action := NewPVCRestoreItemActionWithClient(log, newFakeClient(t), newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName,
+		map[string]string{clearVolumeNameConfigKey: "sometimes"}))
+
+	_, err := action.Execute(newRestoreInput(t, newPVC("data")))
+	assert.ErrorContains(t, err, clearVolumeNameConfigKey)
+}
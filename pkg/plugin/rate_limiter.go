@@ -0,0 +1,98 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"math"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/flowcontrol"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// apiQPSConfigKey and apiBurstConfigKey are the plugin config keys holding how many Gets and
+// Lists per second the plugin sends to the API server, and how many it may send at once
+const (
+	apiQPSConfigKey   = "apiQPS"
+	apiBurstConfigKey = "apiBurst"
+)
+
+// newRateLimiter returns the rate limiter configured by apiQPS and apiBurst, or nil when apiQPS
+// is not set. apiQPS may be fractional, e.g. 0.5 for a request every two seconds. apiBurst
+// defaults to apiQPS rounded up.
+func newRateLimiter(config map[string]string) (flowcontrol.RateLimiter, error) {
+	qps, err := getFloat(config, apiQPSConfigKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	if qps < 0 || math.IsNaN(qps) || math.IsInf(qps, 0) {
+		return nil, errors.Errorf("invalid %s config %g, must be a non-negative number", apiQPSConfigKey, qps)
+	}
+	if qps == 0 {
+		return nil, nil
+	}
+
+	burst, err := getInt(config, apiBurstConfigKey, int(math.Ceil(qps)))
+	if err != nil {
+		return nil, err
+	}
+	if burst < 1 {
+		return nil, errors.Errorf("invalid %s config %d, must be at least 1", apiBurstConfigKey, burst)
+	}
+
+	return flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst), nil
+}
+
+// rateLimitedClient throttles the Gets and Lists of a client with a rate limiter shared by all
+// concurrent requests. Other requests, e.g. the SelfSubjectAccessReviews of the permission
+// check, are sent right away.
+// A request waits for the limiter with its own context, so the wait counts against its getTimeout
+// and ends with the context's error once the deadline has passed.
+type rateLimitedClient struct {
+	client.Client
+	limiter flowcontrol.RateLimiter
+}
+
+// Get waits for the rate limiter and gets an object
+func (c *rateLimitedClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+// List waits for the rate limiter and lists objects
+func (c *rateLimitedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+// wait waits for the rate limiter until the request's context is done
+// The limiter fails right away when the deadline would pass before the request's turn, which is
+// reported as the exceeded deadline, like a request the API server did not answer in time.
+func (c *rateLimitedClient) wait(ctx context.Context) error {
+	if err := c.limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return errors.Wrap(context.DeadlineExceeded, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        map[string]string
+		expectedQPS   float32
+		expectedErr   string
+		expectLimiter bool
+	}{
+		{name: "disabled by default"},
+		{name: "disabled", config: map[string]string{apiQPSConfigKey: "0"}},
+		{name: "qps", config: map[string]string{apiQPSConfigKey: "20"}, expectedQPS: 20, expectLimiter: true},
+		{name: "fractional qps", config: map[string]string{apiQPSConfigKey: "0.5"}, expectedQPS: 0.5, expectLimiter: true},
+		{name: "qps and burst", config: map[string]string{apiQPSConfigKey: "20", apiBurstConfigKey: "50"}, expectedQPS: 20, expectLimiter: true},
+		{name: "invalid qps", config: map[string]string{apiQPSConfigKey: "fast"}, expectedErr: "invalid apiQPS config"},
+		{name: "negative qps", config: map[string]string{apiQPSConfigKey: "-1"}, expectedErr: "invalid apiQPS config -1"},
+		{name: "not a number", config: map[string]string{apiQPSConfigKey: "NaN"}, expectedErr: "invalid apiQPS config NaN"},
+		{name: "invalid burst", config: map[string]string{apiQPSConfigKey: "20", apiBurstConfigKey: "0"}, expectedErr: "invalid apiBurst config 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := newRateLimiter(tt.config)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			if !tt.expectLimiter {
+				assert.Nil(t, limiter)
+				return
+			}
+			require.NotNil(t, limiter)
+			assert.Equal(t, tt.expectedQPS, limiter.QPS())
+		})
+	}
+}
+
+func TestRateLimitedClient(t *testing.T) {
+	var requests atomic.Int32
+	countRequests := interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			requests.Add(1)
+			return c.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			requests.Add(1)
+			return c.List(ctx, list, opts...)
+		},
+	}
+
+	limiter, err := newRateLimiter(map[string]string{apiQPSConfigKey: "100", apiBurstConfigKey: "5"})
+	require.NoError(t, err)
+
+	c := &rateLimitedClient{Client: newInterceptedFakeClient(t, countRequests, newVM("vm-1")), limiter: limiter}
+
+	// The burst is served right away, the other requests at 100 per second
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		if i%2 == 0 {
+			require.NoError(t, c.Get(context.Background(), client.ObjectKey{Namespace: testNamespace, Name: "vm-1"}, &vmopv1.VirtualMachine{}))
+		} else {
+			require.NoError(t, c.List(context.Background(), &vmopv1.VirtualMachineList{}))
+		}
+	}
+
+	assert.Equal(t, int32(25), requests.Load())
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestRateLimitedClientContext(t *testing.T) {
+	var requests atomic.Int32
+	countRequests := interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			requests.Add(1)
+			return c.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			requests.Add(1)
+			return c.List(ctx, list, opts...)
+		},
+	}
+
+	// A request every 100 seconds, the first of which is taken right away
+	limiter, err := newRateLimiter(map[string]string{apiQPSConfigKey: "0.01", apiBurstConfigKey: "1"})
+	require.NoError(t, err)
+	c := &rateLimitedClient{Client: newInterceptedFakeClient(t, countRequests, newVM("vm-1")), limiter: limiter}
+	require.NoError(t, c.List(context.Background(), &vmopv1.VirtualMachineList{}))
+
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := c.Get(ctx, client.ObjectKey{Namespace: testNamespace, Name: "vm-1"}, &vmopv1.VirtualMachine{})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := c.List(ctx, &vmopv1.VirtualMachineList{})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/utils/lru"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+)
+
+// configKind is the type of the value of a plugin config key
+type configKind int
+
+const (
+	// configString values are validated where they are used, if at all
+	configString configKind = iota
+	configBool
+	configInt
+	// configMapping values are comma-separated "from:to" pairs
+	configMapping
+	// configList values are comma-separated entries
+	configList
+)
+
+// commonRestoreConfigKinds are the config keys every restore plugin reads
+var commonRestoreConfigKinds = map[string]configKind{
+	restoreLabelConfigKey: configString,
+}
+
+// restoreConfigKinds are the config keys of each restore plugin, on top of commonRestoreConfigKinds
+var restoreConfigKinds = map[string]map[string]configKind{
+	VMRestorePluginName: {
+		preserveInstanceUUIDConfigKey:     configBool,
+		dnsServersConfigKey:               configList,
+		searchDomainsConfigKey:            configList,
+		statusNetworkConfigPathsConfigKey: configList,
+		// Invalid timeouts fall back to the default, so they are not validated up front
+		waitForGroupTimeoutConfigKey: configString,
+		vmClassMappingConfigKey:      configMapping,
+		vmImageMappingConfigKey:      configMapping,
+		maxHardwareVersionConfigKey:  configInt,
+		removeAnnotationsConfigKey:   configList,
+		forceFirstBootConfigKey:      configBool,
+		restorePowerStateConfigKey:   configString,
+		clearStatusConfigKey:         configBool,
+		clearManagedFieldsConfigKey:  configBool,
+		secretMappingConfigKey:       configMapping,
+		groupNameMappingConfigKey:    configMapping,
+		groupNameSuffixConfigKey:     configString,
+	},
+	PVCRestorePluginName: {
+		removeAnnotationsConfigKey:   configList,
+		storageClassMappingConfigKey: configMapping,
+		accessModeMappingConfigKey:   configMapping,
+		clearDataSourceConfigKey:     configBool,
+		clearVolumeNameConfigKey:     configBool,
+		clearManagedFieldsConfigKey:  configBool,
+	},
+	VMGroupRestorePluginName: {
+		restoredFromBackupAnnotationConfigKey:  configString,
+		removeMarkersOnBackupDeletionConfigKey: configBool,
+	},
+	SecretRestorePluginName:  {},
+	VMImageRestorePluginName: {},
+}
+
+// getRestoreConfig returns the validated config of the named restore plugin
+// Keys differing from a known key only in case are read as the known key. Other unknown keys are
+// likely typos that would silently do nothing, so they are logged as warnings, once for each
+// version of the ConfigMap. Malformed values of known keys are returned as errors before any of
+// them is applied.
+func getRestoreConfig(client corev1client.ConfigMapInterface, name string, log logrus.FieldLogger) (map[string]string, error) {
+	configMap, err := getPluginConfigMap(client, common.PluginKindRestoreItemAction, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get plugin config")
+	}
+	config := map[string]string{}
+	if configMap != nil && configMap.Data != nil {
+		config = configMap.Data
+	}
+
+	kinds := maps.Clone(commonRestoreConfigKinds)
+	maps.Copy(kinds, restoreConfigKinds[name])
+	return normalizeConfig(config, kinds, configWarnf(configMap, log))
+}
+
+// maxWarnedConfigs is how many ConfigMap versions warnedConfigs remembers
+const maxWarnedConfigs = 64
+
+// warnedConfigs holds the ConfigMap versions whose config keys were already warned about. The
+// config is read on every restored item and every AreAdditionalItemsReady poll, and by other
+// plugins reading it, so the same warnings would otherwise be repeated for each read.
+var warnedConfigs = lru.New(maxWarnedConfigs)
+
+// configWarnf returns the function logging the config key warnings of configMap
+// Only the first read of a ConfigMap version logs them at Warn level, later reads log them at
+// Debug level. ConfigMaps without a UID cannot be told apart, so every read of them warns.
+func configWarnf(configMap *corev1.ConfigMap, log logrus.FieldLogger) func(format string, args ...interface{}) {
+	if configMap == nil || configMap.UID == "" {
+		return log.Warnf
+	}
+
+	version := string(configMap.UID) + "/" + configMap.ResourceVersion
+	if _, warned := warnedConfigs.Get(version); warned {
+		return log.Debugf
+	}
+	warnedConfigs.Add(version, struct{}{})
+	return log.Warnf
+}
+
+// normalizeConfig validates the values of the known keys of config and returns it with the keys
+// differing from a known key only in case renamed to the known key. The ignored and renamed keys
+// are reported through warnf.
+func normalizeConfig(config map[string]string, kinds map[string]configKind, warnf func(format string, args ...interface{})) (map[string]string, error) {
+	normalized := make(map[string]string, len(config))
+	for _, key := range slices.Sorted(maps.Keys(config)) {
+		value := config[key]
+		if _, known := kinds[key]; !known {
+			knownKey := foldedConfigKey(key, kinds)
+			if knownKey == "" {
+				warnf("Ignoring unknown config key %q", key)
+				continue
+			}
+			if _, set := config[knownKey]; set {
+				warnf("Ignoring config key %q, %q is set", key, knownKey)
+				continue
+			}
+			warnf("Reading config key %q as %q", key, knownKey)
+			key = knownKey
+		}
+		normalized[key] = value
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(normalized)) {
+		if err := validateConfigValue(normalized, key, kinds[key]); err != nil {
+			return nil, err
+		}
+	}
+	return normalized, nil
+}
+
+// foldedConfigKey returns the known key equal to key under case folding, or "" if there is none
+func foldedConfigKey(key string, kinds map[string]configKind) string {
+	for knownKey := range kinds {
+		if strings.EqualFold(key, knownKey) {
+			return knownKey
+		}
+	}
+	return ""
+}
+
+// validateConfigValue returns an error when the value of key does not parse as kind
+func validateConfigValue(config map[string]string, key string, kind configKind) error {
+	var err error
+	switch kind {
+	case configBool:
+		_, err = getBool(config, key, false)
+	case configInt:
+		_, err = getInt(config, key, 0)
+	case configMapping:
+		if _, mappingErr := parseMapping(config[key]); mappingErr != nil {
+			err = errors.Wrapf(mappingErr, "invalid %s config", key)
+		}
+	}
+	return err
+}
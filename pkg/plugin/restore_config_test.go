@@ -0,0 +1,215 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+)
+
+func TestGetRestoreConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		plugin           string
+		config           map[string]string
+		expected         map[string]string
+		expectedWarnings []string
+	}{
+		{
+			name:     "no config",
+			plugin:   VMRestorePluginName,
+			expected: map[string]string{},
+		},
+		{
+			name:   "valid config",
+			plugin: VMRestorePluginName,
+			config: map[string]string{
+				preserveInstanceUUIDConfigKey: " true ",
+				maxHardwareVersionConfigKey:   "19",
+				vmClassMappingConfigKey:       "small:medium, large:xlarge",
+				removeAnnotationsConfigKey:    "example.com/*",
+				restoreLabelConfigKey:         "restored=true",
+				// Invalid timeouts fall back to the default
+				waitForGroupTimeoutConfigKey: "soon",
+			},
+			expected: map[string]string{
+				preserveInstanceUUIDConfigKey: " true ",
+				maxHardwareVersionConfigKey:   "19",
+				vmClassMappingConfigKey:       "small:medium, large:xlarge",
+				removeAnnotationsConfigKey:    "example.com/*",
+				restoreLabelConfigKey:         "restored=true",
+				waitForGroupTimeoutConfigKey:  "soon",
+			},
+		},
+		{
+			name:             "unknown key",
+			plugin:           VMRestorePluginName,
+			config:           map[string]string{"preserveInstanceUUIDs": "true", clearStatusConfigKey: "false"},
+			expected:         map[string]string{clearStatusConfigKey: "false"},
+			expectedWarnings: []string{`Ignoring unknown config key "preserveInstanceUUIDs"`},
+		},
+		{
+			name:             "key of another restore plugin",
+			plugin:           VMGroupRestorePluginName,
+			config:           map[string]string{groupNameMappingConfigKey: "group-1:group-2"},
+			expected:         map[string]string{},
+			expectedWarnings: []string{`Ignoring unknown config key "groupNameMapping"`},
+		},
+		{
+			name:             "key in another case",
+			plugin:           PVCRestorePluginName,
+			config:           map[string]string{"StorageClassMapping": "a:b"},
+			expected:         map[string]string{storageClassMappingConfigKey: "a:b"},
+			expectedWarnings: []string{`Reading config key "StorageClassMapping" as "storageClassMapping"`},
+		},
+		{
+			name:             "key in another case next to the known key",
+			plugin:           PVCRestorePluginName,
+			config:           map[string]string{"storageclassmapping": "a:c", storageClassMappingConfigKey: "a:b"},
+			expected:         map[string]string{storageClassMappingConfigKey: "a:b"},
+			expectedWarnings: []string{`Ignoring config key "storageclassmapping", "storageClassMapping" is set`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, hook := newTestLogger()
+			configMapClient := newConfigMapClient(common.PluginKindRestoreItemAction, tt.plugin, tt.config)
+
+			config, err := getRestoreConfig(configMapClient, tt.plugin, log)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, config)
+			assert.Equal(t, tt.expectedWarnings, warnings(hook))
+		})
+	}
+}
+
+func TestGetRestoreConfigMalformedValues(t *testing.T) {
+	tests := []struct {
+		name          string
+		plugin        string
+		config        map[string]string
+		expectedError string
+	}{
+		{
+			name:          "bool",
+			plugin:        VMRestorePluginName,
+			config:        map[string]string{clearStatusConfigKey: "sometimes"},
+			expectedError: "invalid clearStatus config",
+		},
+		{
+			name:          "int",
+			plugin:        VMRestorePluginName,
+			config:        map[string]string{maxHardwareVersionConfigKey: "latest"},
+			expectedError: "invalid maxHardwareVersion config",
+		},
+		{
+			name:          "mapping",
+			plugin:        PVCRestorePluginName,
+			config:        map[string]string{storageClassMappingConfigKey: "a:b,c"},
+			expectedError: `invalid storageClassMapping config: invalid mapping entry "c", expected from:to`,
+		},
+		{
+			name:          "key in another case",
+			plugin:        PVCRestorePluginName,
+			config:        map[string]string{"clearVolumename": "maybe"},
+			expectedError: "invalid clearVolumeName config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, _ := newTestLogger()
+			configMapClient := newConfigMapClient(common.PluginKindRestoreItemAction, tt.plugin, tt.config)
+
+			_, err := getRestoreConfig(configMapClient, tt.plugin, log)
+			assert.ErrorContains(t, err, tt.expectedError)
+		})
+	}
+}
+
+// TestGetRestoreConfigWarnsOnce covers that the config key warnings are logged once for each
+// version of the ConfigMap, not on every read of it
+func TestGetRestoreConfigWarnsOnce(t *testing.T) {
+	configMaps := kubefake.NewSimpleClientset().CoreV1().ConfigMaps("velero")
+	configMap, err := configMaps.Create(context.Background(), &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "velero",
+			Name:            "plugin-config",
+			UID:             "warn-once-config",
+			ResourceVersion: "1",
+			Labels: map[string]string{
+				"velero.io/plugin-config": "",
+				VMRestorePluginName:       string(common.PluginKindRestoreItemAction),
+			},
+		},
+		Data: map[string]string{"restorePowerStat": "PoweredOff"},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	log, hook := newTestLogger()
+	for range 3 {
+		_, err := getRestoreConfig(configMaps, VMRestorePluginName, log)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{`Ignoring unknown config key "restorePowerStat"`}, warnings(hook))
+	assert.Equal(t, logrus.DebugLevel, hook.LastEntry().Level)
+
+	hook.Reset()
+	configMap.ResourceVersion = "2"
+	configMap.Data = map[string]string{"restorePowerStat": "PoweredOn"}
+	_, err = configMaps.Update(context.Background(), configMap, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	_, err = getRestoreConfig(configMaps, VMRestorePluginName, log)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`Ignoring unknown config key "restorePowerStat"`}, warnings(hook))
+}
+
+// TestRestoreConfigMalformedValueNotApplied covers that a malformed value fails the restore of an
+// item before the settings of the other keys are applied to it
+func TestRestoreConfigMalformedValueNotApplied(t *testing.T) {
+	action, _ := newTestVMRestoreAction(t, map[string]string{
+		preserveInstanceUUIDConfigKey: "true",
+		vmClassMappingConfigKey:       "small",
+	})
+
+	output, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	assert.ErrorContains(t, err, "invalid vmClassMapping config")
+	assert.Nil(t, output)
+}
+
+func TestVMRestoreUnknownConfigKey(t *testing.T) {
+	action, hook := newTestVMRestoreAction(t, map[string]string{"restorePowerStat": "PoweredOff"})
+
+	vm := newVM("vm-1")
+	vm.Spec.PowerState = "PoweredOn"
+	output, err := action.Execute(newRestoreInput(t, vm))
+	require.NoError(t, err)
+
+	assert.Equal(t, "PoweredOn", nestedString(output.UpdatedItem.UnstructuredContent(), "spec", "powerState"))
+	entryWithMessage(t, hook, `Ignoring unknown config key "restorePowerStat"`)
+}
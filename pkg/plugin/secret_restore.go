@@ -0,0 +1,117 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements Velero restore item action for VM bootstrap Secrets.
+// It removes owner references to the source cluster's VirtualMachines.
+package plugin
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// SecretRestoreItemAction is a restore item action plugin for VM bootstrap Secrets
+type SecretRestoreItemAction struct {
+	log             logrus.FieldLogger
+	configMapClient corev1client.ConfigMapInterface
+}
+
+// NewSecretRestoreItemAction creates a new SecretRestoreItemAction
+func NewSecretRestoreItemAction(log logrus.FieldLogger, configMapClient corev1client.ConfigMapInterface) *SecretRestoreItemAction {
+	return &SecretRestoreItemAction{
+		log:             log,
+		configMapClient: configMapClient,
+	}
+}
+
+// AppliesTo returns the resources this plugin applies to
+func (p *SecretRestoreItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
+	return veleroplugin.ResourceSelector{
+		IncludedResources: []string{"secrets"},
+	}, nil
+}
+
+// Execute performs the restore action
+// Secrets owned by a VirtualMachine are bootstrap secrets. Their owner references point at
+// the UID of the source cluster's VM, which would break garbage collection once the new VM
+// is created, so they are removed along with the server-assigned metadata.
+func (p *SecretRestoreItemAction) Execute(input *veleroplugin.RestoreItemActionExecuteInput) (*veleroplugin.RestoreItemActionExecuteOutput, error) {
+	// Convert unstructured to Secret
+	secret := &corev1.Secret{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(input.Item.UnstructuredContent(), secret); err != nil {
+		return nil, errors.Wrap(err, "failed to convert item to Secret")
+	}
+
+	log := p.log.WithFields(logrus.Fields{
+		"action":    SecretRestorePluginName,
+		"restore":   input.Restore.Name,
+		"namespace": secret.Namespace,
+		"secret":    secret.Name,
+	})
+
+	var ownerReferences []metav1.OwnerReference
+	for _, ownerReference := range secret.OwnerReferences {
+		if isVirtualMachineOwner(ownerReference) {
+			log.WithField("vm", ownerReference.Name).Info("Removing owner reference to VirtualMachine")
+			continue
+		}
+		ownerReferences = append(ownerReferences, ownerReference)
+	}
+
+	// Leave secrets unrelated to VMs untouched
+	if len(ownerReferences) == len(secret.OwnerReferences) {
+		return veleroplugin.NewRestoreItemActionExecuteOutput(input.Item), nil
+	}
+
+	log.Info("Processing bootstrap Secret")
+
+	config, err := getRestoreConfig(p.configMapClient, SecretRestorePluginName, log)
+	if err != nil {
+		return nil, err
+	}
+
+	secret.OwnerReferences = ownerReferences
+	secret.ResourceVersion = ""
+	secret.UID = ""
+
+	// Convert back to unstructured
+	unstructuredSecret, err := runtime.DefaultUnstructuredConverter.ToUnstructured(secret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert Secret to unstructured")
+	}
+
+	updatedItem := &unstructured.Unstructured{Object: unstructuredSecret}
+	if _, err := setRestoreLabel(updatedItem, config); err != nil {
+		return nil, err
+	}
+
+	return veleroplugin.NewRestoreItemActionExecuteOutput(updatedItem), nil
+}
+
+// isVirtualMachineOwner reports whether an owner reference points at a VM Operator VirtualMachine
+func isVirtualMachineOwner(ownerReference metav1.OwnerReference) bool {
+	return ownerReference.Kind == "VirtualMachine" && strings.HasPrefix(ownerReference.APIVersion, vmoperatorGroup+"/")
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// newSecret returns a Secret in the test namespace owned by ownerReferences
+func newSecret(name string, ownerReferences ...metav1.OwnerReference) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       testNamespace,
+			Name:            name,
+			ResourceVersion: "4711",
+			UID:             "0a6f0a64-6e3e-4c8e-9d0b-2c1a0f0e5b11",
+			OwnerReferences: ownerReferences,
+		},
+	}
+}
+
+// executeSecretRestore runs the secret restore action and returns the output and the restored secret
+func executeSecretRestore(t *testing.T, secret *corev1.Secret) (*veleroplugin.RestoreItemActionExecuteOutput, *corev1.Secret) {
+	t.Helper()
+
+	log, _ := newTestLogger()
+	action := NewSecretRestoreItemAction(log, newConfigMapClient(common.PluginKindRestoreItemAction, SecretRestorePluginName, nil))
+
+	output, err := action.Execute(newRestoreInput(t, secret))
+	require.NoError(t, err)
+
+	restored := &corev1.Secret{}
+	require.NoError(t, runtime.DefaultUnstructuredConverter.FromUnstructured(output.UpdatedItem.UnstructuredContent(), restored))
+	return output, restored
+}
+
+var (
+	vmOwnerReference = metav1.OwnerReference{
+		APIVersion: "vmoperator.vmware.com/v1alpha5",
+		Kind:       "VirtualMachine",
+		Name:       "vm-1",
+		UID:        "3c0b8b55-8d8a-4a36-8d47-1d5e7e0d2f21",
+	}
+	configMapOwnerReference = metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Name:       "config",
+		UID:        "9e0c7a51-4a43-4bb1-a6d9-6b3c3a5e8f30",
+	}
+)
+
+func TestSecretRestoreRemovesVMOwnerReference(t *testing.T) {
+	_, restored := executeSecretRestore(t, newSecret("cloud-config", vmOwnerReference, configMapOwnerReference))
+
+	assert.Equal(t, []metav1.OwnerReference{configMapOwnerReference}, restored.OwnerReferences)
+	assert.Empty(t, restored.ResourceVersion)
+	assert.Empty(t, restored.UID)
+}
+
+func TestSecretRestoreLeavesUnrelatedSecret(t *testing.T) {
+	secret := newSecret("app-secret", configMapOwnerReference)
+
+	output, restored := executeSecretRestore(t, secret)
+
+	assert.Equal(t, []metav1.OwnerReference{configMapOwnerReference}, restored.OwnerReferences)
+	assert.Equal(t, "4711", restored.ResourceVersion)
+	assert.NotContains(t, restored.Labels, "restored-by")
+	assert.False(t, output.SkipRestore)
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements Velero backup item action for VirtualMachine resources.
+// It adds the VirtualMachineGroup of a VM to the backup so the whole group is backed up with it.
+package plugin
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// VMBackupItemAction is a backup item action plugin for VirtualMachine
+type VMBackupItemAction struct {
+	log logrus.FieldLogger
+}
+
+// NewVMBackupItemAction creates a new VMBackupItemAction
+func NewVMBackupItemAction(log logrus.FieldLogger) *VMBackupItemAction {
+	return &VMBackupItemAction{log: log}
+}
+
+// AppliesTo returns the resources this plugin applies to
+func (p *VMBackupItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
+	return veleroplugin.ResourceSelector{
+		IncludedResources: []string{virtualMachinesResource},
+	}, nil
+}
+
+// Execute performs the backup action
+// Adds the VirtualMachineGroup named in spec.groupName as an additional item. The members of
+// the group are added by VMGroupBackupItemAction; they are not expanded here, and Velero
+// backs up every item once, so VMs of a group do not add their group again.
+func (p *VMBackupItemAction) Execute(item runtime.Unstructured, backup *velerov1.Backup) (runtime.Unstructured, []veleroplugin.ResourceIdentifier, error) {
+	vm := &vmopv1.VirtualMachine{}
+	if err := fromUnstructured(item.UnstructuredContent(), vm); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to convert item to VirtualMachine")
+	}
+
+	if vm.Spec.GroupName == "" {
+		return item, nil, nil
+	}
+
+	p.log.WithFields(logrus.Fields{
+		"action":    VMBackupPluginName,
+		"backup":    backup.Name,
+		"namespace": vm.Namespace,
+		"vm":        vm.Name,
+		"group":     vm.Spec.GroupName,
+	}).Info("Adding the VirtualMachineGroup of the VirtualMachine to backup")
+	return item, []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(vm.Namespace, vm.Spec.GroupName)}, nil
+}
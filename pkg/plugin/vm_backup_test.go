@@ -0,0 +1,63 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+func TestVMBackupAddsGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		groupName string
+		expected  []veleroplugin.ResourceIdentifier
+	}{
+		{name: "no group", groupName: "", expected: nil},
+		{
+			name:      "group",
+			groupName: "group-1",
+			expected: []veleroplugin.ResourceIdentifier{{
+				GroupResource: schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "virtualmachinegroups"},
+				Namespace:     testNamespace,
+				Name:          "group-1",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, _ := newTestLogger()
+			action := NewVMBackupItemAction(log)
+			item := toUnstructured(t, withGroupName(withPVCVolumes(newVM("vm-1"), "data"), tt.groupName))
+
+			updatedItem, additionalItems, err := action.Execute(item, &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+			require.NoError(t, err)
+
+			assert.Equal(t, item, updatedItem)
+			// Only the group is added; its members are expanded by the group action
+			assert.Equal(t, tt.expected, additionalItems)
+		})
+	}
+}
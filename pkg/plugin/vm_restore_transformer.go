@@ -0,0 +1,194 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// VMRestoreTransformerInput is passed to each VMRestoreTransformer of a VM restore
+type VMRestoreTransformerInput struct {
+	// RestoreInput is the input of the restore item action
+	RestoreInput *veleroplugin.RestoreItemActionExecuteInput
+	// Config is the config of the vm-restore plugin
+	Config map[string]string
+	// Log is the logger of the VM being restored
+	Log logrus.FieldLogger
+}
+
+// VMRestoreTransformer mutates a VirtualMachine before it is restored
+type VMRestoreTransformer interface {
+	// Name identifies the transformer in logs and errors
+	Name() string
+	// Transform mutates the unstructured VM in place and reports whether it changed it
+	Transform(obj map[string]interface{}, input *VMRestoreTransformerInput) (bool, error)
+}
+
+// DefaultVMRestoreTransformers returns the built-in transformers of VMRestoreItemAction in the order they run
+func DefaultVMRestoreTransformers() []VMRestoreTransformer {
+	return []VMRestoreTransformer{
+		instanceUUIDTransformer{},
+		annotationsTransformer{},
+		networkTransformer{},
+		hardwareVersionTransformer{},
+	}
+}
+
+// instanceUUIDTransformer removes spec.instanceUUID, which is cluster-specific and will be regenerated
+// unless the restore is configured to keep it, e.g. for same-cluster migrations
+type instanceUUIDTransformer struct{}
+
+func (instanceUUIDTransformer) Name() string {
+	return "instanceUUID"
+}
+
+func (instanceUUIDTransformer) Transform(obj map[string]interface{}, input *VMRestoreTransformerInput) (bool, error) {
+	preserveInstanceUUID, err := getBool(input.Config, preserveInstanceUUIDConfigKey, false)
+	if err != nil {
+		return false, err
+	}
+	instanceUUID, found, _ := unstructured.NestedString(obj, "spec", "instanceUUID")
+	if !found || instanceUUID == "" {
+		return false, nil
+	}
+	if preserveInstanceUUID {
+		input.Log.Infof("Preserving instanceUUID %s", instanceUUID)
+		return false, nil
+	}
+	input.Log.Info("Removing instanceUUID")
+	unstructured.SetNestedField(obj, "", "spec", "instanceUUID")
+	return true, nil
+}
+
+// annotationsTransformer removes the configured annotations - by default first-boot-done, so the VM goes
+// through first boot again unless forceFirstBoot is disabled for workloads that only want their data restored
+type annotationsTransformer struct{}
+
+func (annotationsTransformer) Name() string {
+	return "annotations"
+}
+
+func (annotationsTransformer) Transform(obj map[string]interface{}, input *VMRestoreTransformerInput) (bool, error) {
+	log := input.Log
+	annotationsToRemove := defaultVMAnnotationsToRemove
+	if value, found := input.Config[removeAnnotationsConfigKey]; found {
+		annotationsToRemove = parseList(value)
+	}
+	forceFirstBoot, err := getBool(input.Config, forceFirstBootConfigKey, true)
+	if err != nil {
+		return false, err
+	}
+
+	modified := false
+	annotations, found, err := unstructured.NestedStringMap(obj, "metadata", "annotations")
+	if err != nil {
+		// Annotations with non-string values are malformed, and the VM could neither be converted nor
+		// created with them. Recover them from the raw map, so they are still cleaned up.
+		log.WithError(err).Warn("VM has malformed annotations, converting their values to strings")
+		annotations, found, err = recoverAnnotations(obj)
+		if err != nil {
+			return false, err
+		}
+		unstructured.SetNestedStringMap(obj, annotations, "metadata", "annotations")
+		modified = true
+	}
+	if !found {
+		return modified, nil
+	}
+
+	removed := false
+	for key := range annotations {
+		if key == vmopv1.FirstBootDoneAnnotation && !forceFirstBoot {
+			log.WithField("annotation", key).Info("Keeping annotation as forceFirstBoot is disabled")
+			continue
+		}
+		if matchesAnyKey(key, annotationsToRemove) {
+			log.WithField("annotation", key).Info("Removing annotation")
+			delete(annotations, key)
+			removed = true
+		}
+	}
+	if removed {
+		unstructured.SetNestedStringMap(obj, annotations, "metadata", "annotations")
+	}
+	return modified || removed, nil
+}
+
+// networkTransformer injects the network configuration from status.network.config to spec.network,
+// and records the preserved IPs on the VM for validation after the restore
+type networkTransformer struct{}
+
+func (networkTransformer) Name() string {
+	return "network"
+}
+
+func (networkTransformer) Transform(obj map[string]interface{}, input *VMRestoreTransformerInput) (bool, error) {
+	configPaths, err := statusNetworkConfigPaths(input.Config)
+	if err != nil {
+		return false, err
+	}
+	dnsOverrides, err := dnsOverridesFromConfig(input.Config)
+	if err != nil {
+		return false, err
+	}
+	preservedIP, injected := injectNetworkConfigFromStatus(obj, configPaths, dnsOverrides, input.Log)
+	if injected && preservedIP != "" {
+		unstructured.SetNestedField(obj, preservedIP, "metadata", "annotations", preservedIPAnnotation)
+	}
+	return injected, nil
+}
+
+// hardwareVersionTransformer lowers spec.minHardwareVersion to maxHardwareVersion, so VMs backed up
+// on a newer cluster can be reconciled by a target cluster supporting older hardware versions only
+type hardwareVersionTransformer struct{}
+
+func (hardwareVersionTransformer) Name() string {
+	return "hardwareVersion"
+}
+
+func (hardwareVersionTransformer) Transform(obj map[string]interface{}, input *VMRestoreTransformerInput) (bool, error) {
+	maxHardwareVersion, err := getInt(input.Config, maxHardwareVersionConfigKey, 0)
+	if err != nil {
+		return false, err
+	}
+	if maxHardwareVersion == 0 {
+		return false, nil
+	}
+	if maxHardwareVersion < minSupportedHardwareVersion {
+		return false, errors.Errorf("invalid %s config %d, must be at least %d", maxHardwareVersionConfigKey, maxHardwareVersion, minSupportedHardwareVersion)
+	}
+
+	minHardwareVersion, found, err := unstructured.NestedInt64(obj, "spec", "minHardwareVersion")
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read spec.minHardwareVersion")
+	}
+	if !found || minHardwareVersion <= int64(maxHardwareVersion) {
+		return false, nil
+	}
+	input.Log.WithFields(logrus.Fields{
+		"minHardwareVersion": minHardwareVersion,
+		"maxHardwareVersion": maxHardwareVersion,
+	}).Info("Lowering spec.minHardwareVersion to maxHardwareVersion")
+	unstructured.SetNestedField(obj, int64(maxHardwareVersion), "spec", "minHardwareVersion")
+	return true, nil
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// recordingTransformer sets the label name to value and records its name in order
+type recordingTransformer struct {
+	name  string
+	value string
+	order *[]string
+	err   error
+}
+
+func (r recordingTransformer) Name() string {
+	return r.name
+}
+
+func (r recordingTransformer) Transform(obj map[string]interface{}, input *VMRestoreTransformerInput) (bool, error) {
+	*r.order = append(*r.order, r.name)
+	if r.err != nil {
+		return false, r.err
+	}
+	if input.RestoreInput == nil || input.Log == nil {
+		return false, errors.New("incomplete transformer input")
+	}
+	return true, unstructured.SetNestedField(obj, r.value, "metadata", "labels", "transformed")
+}
+
+func TestDefaultVMRestoreTransformers(t *testing.T) {
+	var names []string
+	for _, transformer := range DefaultVMRestoreTransformers() {
+		names = append(names, transformer.Name())
+	}
+	assert.Equal(t, []string{"instanceUUID", "annotations", "network", "hardwareVersion"}, names)
+}
+
+func TestVMRestoreCustomTransformers(t *testing.T) {
+	var order []string
+	action, _ := newTestVMRestoreAction(t, nil)
+	action.SetTransformers(append(DefaultVMRestoreTransformers(),
+		recordingTransformer{name: "first", value: "first", order: &order},
+		recordingTransformer{name: "second", value: "second", order: &order},
+	)...)
+
+	vm := newVM("vm-1")
+	vm.Spec.InstanceUUID = "50123456-789a-bcde-f012-3456789abcde"
+	output, err := action.Execute(newRestoreInput(t, vm))
+	require.NoError(t, err)
+
+	obj := output.UpdatedItem.UnstructuredContent()
+	assert.Equal(t, []string{"first", "second"}, order)
+	// The later transformer wins, and the built-in ones still ran
+	assert.Equal(t, "second", nestedString(obj, "metadata", "labels", "transformed"))
+	assert.Empty(t, nestedString(obj, "spec", "instanceUUID"))
+}
+
+func TestVMRestoreWithoutDefaultTransformers(t *testing.T) {
+	var order []string
+	action, _ := newTestVMRestoreAction(t, nil)
+	action.SetTransformers(recordingTransformer{name: "only", value: "only", order: &order})
+
+	vm := newVM("vm-1")
+	vm.Spec.InstanceUUID = "50123456-789a-bcde-f012-3456789abcde"
+	output, err := action.Execute(newRestoreInput(t, vm))
+	require.NoError(t, err)
+
+	obj := output.UpdatedItem.UnstructuredContent()
+	assert.Equal(t, []string{"only"}, order)
+	assert.Equal(t, "only", nestedString(obj, "metadata", "labels", "transformed"))
+	assert.Equal(t, "50123456-789a-bcde-f012-3456789abcde", nestedString(obj, "spec", "instanceUUID"))
+}
+
+func TestVMRestoreTransformerError(t *testing.T) {
+	var order []string
+	action, _ := newTestVMRestoreAction(t, nil)
+	action.SetTransformers(
+		recordingTransformer{name: "failing", order: &order, err: errors.New("boom")},
+		recordingTransformer{name: "skipped", order: &order},
+	)
+
+	_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	assert.ErrorContains(t, err, "VM restore transformer failing failed: boom")
+	assert.Equal(t, []string{"failing"}, order)
+}
+
+func TestVMRestoreMaxHardwareVersion(t *testing.T) {
+	tests := []struct {
+		name               string
+		config             map[string]string
+		minHardwareVersion int32
+		expected           int64
+	}{
+		{
+			name:               "clamped",
+			config:             map[string]string{maxHardwareVersionConfigKey: "19"},
+			minHardwareVersion: 21,
+			expected:           19,
+		},
+		{
+			name:               "below the ceiling",
+			config:             map[string]string{maxHardwareVersionConfigKey: "19"},
+			minHardwareVersion: 17,
+			expected:           17,
+		},
+		{
+			name:               "at the ceiling",
+			config:             map[string]string{maxHardwareVersionConfigKey: "19"},
+			minHardwareVersion: 19,
+			expected:           19,
+		},
+		{
+			name:               "not configured",
+			minHardwareVersion: 21,
+			expected:           21,
+		},
+		{
+			name:   "absent field",
+			config: map[string]string{maxHardwareVersionConfigKey: "19"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.MinHardwareVersion = tc.minHardwareVersion
+
+			_, obj := executeVMRestore(t, tc.config, vm)
+
+			minHardwareVersion, found, err := unstructured.NestedInt64(obj, "spec", "minHardwareVersion")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected != 0, found)
+			assert.Equal(t, tc.expected, minHardwareVersion)
+		})
+	}
+}
+
+func TestVMRestoreInvalidMaxHardwareVersion(t *testing.T) {
+	for _, value := range []string{"latest", "-1", "12"} {
+		t.Run(value, func(t *testing.T) {
+			action, _ := newTestVMRestoreAction(t, map[string]string{maxHardwareVersionConfigKey: value})
+
+			_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+			assert.ErrorContains(t, err, "invalid maxHardwareVersion config")
+		})
+	}
+}
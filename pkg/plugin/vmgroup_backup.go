@@ -0,0 +1,1464 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package plugin implements Velero backup item action for VirtualMachineGroup resources.
+// It adds the member VirtualMachines and their dependencies to the backup.
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	vmopv1common "github.com/vmware-tanzu/vm-operator/api/v1alpha5/common"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	"github.com/vmware-tanzu/velero/pkg/util/collections"
+)
+
+// memberListThreshold is the number of group members at which the member
+// VirtualMachines are fetched with a single List instead of a Get per member
+const memberListThreshold = 5
+
+// groupLabelSelectorConfigKey is the plugin config key holding a label selector
+// a VirtualMachineGroup must match to have its members backed up
+const groupLabelSelectorConfigKey = "groupLabelSelector"
+
+// getRetryAttemptsConfigKey and getRetryBackoffConfigKey are the plugin config keys holding
+// how often a member VirtualMachine Get is attempted and the initial delay between attempts
+const (
+	getRetryAttemptsConfigKey = "getRetryAttempts"
+	getRetryBackoffConfigKey  = "getRetryBackoff"
+)
+
+// Defaults used when getRetryAttempts and getRetryBackoff are not set
+const (
+	defaultGetRetryAttempts = 3
+	defaultGetRetryBackoff  = 500 * time.Millisecond
+)
+
+// getTimeoutConfigKey is the plugin config key holding how long a single API request made
+// while resolving the members of a VirtualMachineGroup may take
+const getTimeoutConfigKey = "getTimeout"
+
+// defaultGetTimeout is used when getTimeout is not set
+const defaultGetTimeout = 30 * time.Second
+
+// concurrencyConfigKey is the plugin config key holding how many member VirtualMachines
+// are resolved in parallel
+const concurrencyConfigKey = "concurrency"
+
+// defaultConcurrency is used when concurrency is not set
+const defaultConcurrency = 4
+
+// failOnMissingMemberConfigKey is the plugin config key that fails the backup of a
+// VirtualMachineGroup when set to "true" and one of its members cannot be resolved
+const failOnMissingMemberConfigKey = "failOnMissingMember"
+
+// verifyPVCsConfigKey is the plugin config key that, when set to "true", checks that the
+// PVCs of the member VirtualMachines exist and warns about missing ones
+const verifyPVCsConfigKey = "verifyPVCs"
+
+// verifySecretsConfigKey is the plugin config key that, when set to "true", checks that the
+// bootstrap secrets of the member VirtualMachines exist and warns about missing ones
+const verifySecretsConfigKey = "verifySecrets"
+
+// excludeDependencyKindsConfigKey is the plugin config key holding a comma-separated list
+// of dependency resources, e.g. "secrets,storageclasses", that are not added to the backup
+const excludeDependencyKindsConfigKey = "excludeDependencyKinds"
+
+// excludableDependencyKinds are the dependency resources excludeDependencyKinds accepts
+// The member VMs, nested groups and PVCs are always backed up.
+var excludableDependencyKinds = map[string]struct{}{
+	"secrets":                           {},
+	"configmaps":                        {},
+	"virtualmachineimages":              {},
+	"clustervirtualmachineimages":       {},
+	"virtualmachineclasses":             {},
+	"storageclasses":                    {},
+	"volumesnapshots":                   {},
+	"virtualmachinesetresourcepolicies": {},
+	"encryptionclasses":                 {},
+}
+
+// extraBackupAnnotation lists extra resources of the namespace of a VirtualMachineGroup to back
+// up with it as comma-separated "<resource>/<name>" entries, e.g. "configmaps/my-cm,secrets/my-secret"
+// Resources outside the core group are qualified with their group, e.g. "deployments.apps/web".
+const extraBackupAnnotation = "lubronzhan.io/extra-backup"
+
+// includeStatusMembersConfigKey is the plugin config key that, unless set to "false", also backs up
+// the members VM Operator linked to a VirtualMachineGroup in status.members, e.g. selector-matched
+// VMs missing from spec.bootOrder
+const includeStatusMembersConfigKey = "includeStatusMembers"
+
+// defaultNamespaceConfigKey is the plugin config key holding the namespace the members of a
+// VirtualMachineGroup without metadata.namespace are looked up in. Such groups are skipped when it is not set.
+const defaultNamespaceConfigKey = "defaultNamespace"
+
+// backupServicesConfigKey is the plugin config key that, when set to "true", also backs up the
+// VirtualMachineServices whose selector matches a member VirtualMachine
+const backupServicesConfigKey = "backupServices"
+
+// maxAdditionalItemsConfigKey is the plugin config key capping the number of additional items
+// of a VirtualMachineGroup; failOnMaxAdditionalItemsConfigKey fails the item instead of truncating
+const (
+	maxAdditionalItemsConfigKey       = "maxAdditionalItems"
+	failOnMaxAdditionalItemsConfigKey = "failOnMaxAdditionalItems"
+)
+
+// defaultMaxAdditionalItems is used when maxAdditionalItems is not set
+const defaultMaxAdditionalItems = 10000
+
+// rbacPreflightConfigKey is the plugin config key that disables the startup check of the
+// plugin's permissions when set to "false"
+const rbacPreflightConfigKey = "rbacPreflight"
+
+// dryRunConfigKey is the plugin config key that, when set to "true", makes the plugin only log
+// and return the dependencies it can resolve from the group itself, without any API calls
+const dryRunConfigKey = "dryRun"
+
+// dependencyCounts tallies the additional items of a VirtualMachineGroup backup by type
+type dependencyCounts struct {
+	members           int
+	groups            int
+	secrets           int
+	configMaps        int
+	pvcs              int
+	images            int
+	classes           int
+	storageClasses    int
+	snapshots         int
+	policies          int
+	encryptionClasses int
+	services          int
+}
+
+// countDependencies counts the additional items by their resource
+func countDependencies(items []veleroplugin.ResourceIdentifier) dependencyCounts {
+	var counts dependencyCounts
+	for _, item := range items {
+		switch item.Resource {
+		case "virtualmachines":
+			counts.members++
+		case "virtualmachinegroups":
+			counts.groups++
+		case "secrets":
+			counts.secrets++
+		case "configmaps":
+			counts.configMaps++
+		case "persistentvolumeclaims":
+			counts.pvcs++
+		case "virtualmachineimages", "clustervirtualmachineimages":
+			counts.images++
+		case "virtualmachineclasses":
+			counts.classes++
+		case "storageclasses":
+			counts.storageClasses++
+		case "volumesnapshots":
+			counts.snapshots++
+		case "virtualmachinesetresourcepolicies":
+			counts.policies++
+		case "encryptionclasses":
+			counts.encryptionClasses++
+		case "virtualmachineservices":
+			counts.services++
+		}
+	}
+	return counts
+}
+
+// fields returns the counts as log fields so log processors can parse them
+func (c dependencyCounts) fields() logrus.Fields {
+	return logrus.Fields{
+		"members":           c.members,
+		"groups":            c.groups,
+		"secrets":           c.secrets,
+		"configMaps":        c.configMaps,
+		"pvcs":              c.pvcs,
+		"images":            c.images,
+		"classes":           c.classes,
+		"storageClasses":    c.storageClasses,
+		"snapshots":         c.snapshots,
+		"policies":          c.policies,
+		"encryptionClasses": c.encryptionClasses,
+		"services":          c.services,
+	}
+}
+
+// String formats the counts as a single summary, e.g. "members=5 groups=0 secrets=3 pvcs=8 ..."
+func (c dependencyCounts) String() string {
+	return fmt.Sprintf("members=%d groups=%d secrets=%d configMaps=%d pvcs=%d images=%d classes=%d storageClasses=%d snapshots=%d policies=%d encryptionClasses=%d services=%d",
+		c.members, c.groups, c.secrets, c.configMaps, c.pvcs, c.images, c.classes, c.storageClasses, c.snapshots, c.policies, c.encryptionClasses, c.services)
+}
+
+// VMGroupBackupItemAction is a backup item action plugin for VirtualMachineGroup
+type VMGroupBackupItemAction struct {
+	log             logrus.FieldLogger
+	client          client.Client
+	configMapClient corev1client.ConfigMapInterface
+	// expanded holds, per backup run, the groups whose members were expanded, so a group
+	// triggered more than once in a backup run is only expanded once. The DependencyCollector
+	// of an Execute call only dedupes the items of that call, so it cannot tell that a previous
+	// call already resolved the members.
+	expanded *backupCache
+}
+
+// NewVMGroupBackupItemAction creates a new VMGroupBackupItemAction
+// The client uses restConfig unless the plugin config points at a kubeconfig and context
+func NewVMGroupBackupItemAction(log logrus.FieldLogger, restConfig *rest.Config, configMapClient corev1client.ConfigMapInterface) (*VMGroupBackupItemAction, error) {
+	config, err := getPluginConfig(configMapClient, common.PluginKindBackupItemAction, VMGroupBackupPluginName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get plugin config")
+	}
+
+	restConfig, err = restConfigFromPluginConfig(config, restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// The limiter is shared by all the backups the plugin serves, so it is configured once
+	limiter, err := newRateLimiter(config)
+	if err != nil {
+		return nil, err
+	}
+	if limiter != nil {
+		c = &rateLimitedClient{Client: c, limiter: limiter}
+	}
+
+	action := NewVMGroupBackupItemActionWithClient(log, c, configMapClient)
+
+	rbacPreflight, err := getBool(config, rbacPreflightConfigKey, true)
+	if err != nil {
+		return nil, err
+	}
+	if rbacPreflight {
+		action.checkPermissions()
+	}
+
+	return action, nil
+}
+
+// requiredPermission is an API permission the backup plugin needs
+type requiredPermission struct {
+	group    string
+	resource string
+	verb     string
+}
+
+// requiredPermissions are the permissions the backup plugin needs to resolve the dependencies of a group
+var requiredPermissions = []requiredPermission{
+	{group: vmoperatorGroup, resource: "virtualmachinegroups", verb: "get"},
+	{group: vmoperatorGroup, resource: "virtualmachinegroups", verb: "list"},
+	{group: vmoperatorGroup, resource: "virtualmachines", verb: "get"},
+	{group: vmoperatorGroup, resource: "virtualmachines", verb: "list"},
+	{group: vmoperatorGroup, resource: "virtualmachineimages", verb: "get"},
+	{group: "", resource: "persistentvolumeclaims", verb: "get"},
+	// Only needed with verifySecrets and backupServices
+	{group: "", resource: "secrets", verb: "list"},
+	{group: vmoperatorGroup, resource: "virtualmachineservices", verb: "list"},
+}
+
+// checkPermissions logs a warning listing the required permissions the plugin lacks
+// It asks the API server with a SelfSubjectAccessReview per permission and never fails.
+// All reviews share defaultGetTimeout so an unresponsive API server cannot block the plugin startup.
+func (p *VMGroupBackupItemAction) checkPermissions() {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultGetTimeout)
+	defer cancel()
+
+	var missing []string
+	for _, permission := range requiredPermissions {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Group:    permission.group,
+					Resource: permission.resource,
+					Verb:     permission.verb,
+				},
+			},
+		}
+		if err := p.client.Create(ctx, review); err != nil {
+			p.log.Warnf("Failed to check permission to %s %s: %v", permission.verb, permission.resource, err)
+			continue
+		}
+		if !review.Status.Allowed {
+			missing = append(missing, fmt.Sprintf("%s %s", permission.verb, schema.GroupResource{Group: permission.group, Resource: permission.resource}))
+		}
+	}
+
+	if len(missing) > 0 {
+		p.log.Warnf("The vmgroup-backup plugin lacks permissions to: %s - dependencies of VirtualMachineGroups will be missing from backups", strings.Join(missing, ", "))
+	}
+}
+
+// NewVMGroupBackupItemActionWithClient creates a new VMGroupBackupItemAction using the given client,
+// e.g. a fake client from sigs.k8s.io/controller-runtime/pkg/client/fake
+// The client must know the VM Operator types.
+func NewVMGroupBackupItemActionWithClient(log logrus.FieldLogger, c client.Client, configMapClient corev1client.ConfigMapInterface) *VMGroupBackupItemAction {
+	return &VMGroupBackupItemAction{
+		log:             log,
+		client:          c,
+		configMapClient: configMapClient,
+		expanded:        newBackupCache(),
+	}
+}
+
+// AppliesTo returns the resources this plugin applies to
+func (p *VMGroupBackupItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
+	return veleroplugin.ResourceSelector{
+		IncludedResources: []string{virtualMachineGroupsResource},
+	}, nil
+}
+
+// Execute performs the backup action
+// This plugin adds the following resources as additional items:
+// 1. The VirtualMachines listed in spec.bootOrder[].members or status.members, or otherwise
+// the VirtualMachines naming the group in their spec.groupName
+// 2. Nested VirtualMachineGroup members and their VirtualMachines
+// 3. The bootstrap secrets and ConfigMaps referenced by those VirtualMachines
+// 4. The PVCs attached to those VirtualMachines
+// 5. The VirtualMachineImages or ClusterVirtualMachineImages those VirtualMachines were deployed from
+// 6. The VirtualMachineClasses of those VirtualMachines
+// 7. The StorageClasses of the PVCs attached to those VirtualMachines
+// 8. The VirtualMachineSetResourcePolicies of those VirtualMachines
+// 9. The VirtualMachineServices selecting those VirtualMachines, when backupServices is enabled
+// 10. The resources listed in the group's lubronzhan.io/extra-backup annotation
+func (p *VMGroupBackupItemAction) Execute(item runtime.Unstructured, backup *velerov1.Backup) (_ runtime.Unstructured, _ []veleroplugin.ResourceIdentifier, err error) {
+	p.log.Infof("Executing VMGroupBackupItemAction for backup %s", backup.Name)
+
+	// Convert unstructured to VirtualMachineGroup
+	vmGroup := &vmopv1.VirtualMachineGroup{}
+	if err := fromUnstructured(item.UnstructuredContent(), vmGroup); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to convert item to VirtualMachineGroup")
+	}
+
+	log := p.log.WithFields(logrus.Fields{
+		"action":    VMGroupBackupPluginName,
+		"backup":    backup.Name,
+		"namespace": vmGroup.Namespace,
+		"group":     vmGroup.Name,
+	})
+	log.Info("Processing VirtualMachineGroup")
+
+	config, err := getPluginConfig(p.configMapClient, common.PluginKindBackupItemAction, VMGroupBackupPluginName)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get plugin config")
+	}
+
+	// VirtualMachineGroups are namespaced, so an item without a namespace was submitted improperly.
+	// Its dependencies would be identified without a namespace, which Velero cannot resolve.
+	if vmGroup.Namespace == "" {
+		defaultNamespace := strings.TrimSpace(config[defaultNamespaceConfigKey])
+		if defaultNamespace == "" {
+			log.Warnf("VirtualMachineGroup %s has no namespace and %s is not configured - skipping its members", vmGroup.Name, defaultNamespaceConfigKey)
+			return item, nil, nil
+		}
+		log.Errorf("VirtualMachineGroup %s has no namespace - looking up its members in the %s %s", vmGroup.Name, defaultNamespaceConfigKey, defaultNamespace)
+		vmGroup.Namespace = defaultNamespace
+		log = log.WithField("namespace", defaultNamespace)
+	}
+
+	// Only process the groups that opted in when a selector is configured
+	if value := config[groupLabelSelectorConfigKey]; value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid %s config", groupLabelSelectorConfigKey)
+		}
+		if !selector.Matches(labels.Set(vmGroup.Labels)) {
+			log.Infof("VirtualMachineGroup does not match %s %q - skipping its members", groupLabelSelectorConfigKey, value)
+			return item, nil, nil
+		}
+	}
+
+	extraItems := p.extraBackupItems(vmGroup, log)
+
+	includeStatusMembers, err := getBool(config, includeStatusMembersConfigKey, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dryRun, err := getBool(config, dryRunConfigKey, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if dryRun {
+		additionalItems := p.filterByBackupNamespaces(append(planAdditionalItems(vmGroup, includeStatusMembers), extraItems...), backup, log)
+		for _, additionalItem := range additionalItems {
+			log.Infof("Dry run: would add %s %s/%s to backup", additionalItem.GroupResource, additionalItem.Namespace, additionalItem.Name)
+		}
+		return item, additionalItems, nil
+	}
+
+	backoff, err := getRetryBackoff(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	failOnMissingMember, err := getBool(config, failOnMissingMemberConfigKey, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifyPVCs, err := getBool(config, verifyPVCsConfigKey, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verifySecrets, err := getBool(config, verifySecretsConfigKey, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	getTimeout, err := getDuration(config, getTimeoutConfigKey, defaultGetTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	if getTimeout <= 0 {
+		return nil, nil, errors.Errorf("invalid %s config %s, must be positive", getTimeoutConfigKey, getTimeout)
+	}
+
+	ctx := context.Background()
+	opts := resolveOptions{backoff: backoff, verifyPVCs: verifyPVCs, getTimeout: getTimeout, includeStatusMembers: includeStatusMembers, log: log}
+
+	excludedKinds := p.excludedDependencyKinds(config, log)
+	// The resources of the extra-backup annotation are requested explicitly, so they are backed up
+	// even when their kind is excluded as a dependency
+	for _, extraItem := range extraItems {
+		if _, excluded := excludedKinds[extraItem.Resource]; excluded {
+			log.WithFields(logrus.Fields{"resource": extraItem.Resource, "name": extraItem.Name}).Infof("Backing up extra resource from %s although %s excludes %s", extraBackupAnnotation, excludeDependencyKindsConfigKey, extraItem.Resource)
+		}
+	}
+
+	maxAdditionalItems, err := getInt(config, maxAdditionalItemsConfigKey, defaultMaxAdditionalItems)
+	if err != nil {
+		return nil, nil, err
+	}
+	if maxAdditionalItems < 1 {
+		return nil, nil, errors.Errorf("invalid %s config %d, must be at least 1", maxAdditionalItemsConfigKey, maxAdditionalItems)
+	}
+
+	failOnMaxAdditionalItems, err := getBool(config, failOnMaxAdditionalItemsConfigKey, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backupServices, err := getBool(config, backupServicesConfigKey, false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The VM backup action adds the group of each member VM, so the group may be triggered more
+	// than once, and each trigger would resolve every member again
+	expanded := p.expanded.get(backup.UID, func() any { return &sync.Map{} }).(*sync.Map)
+	groupKey := vmGroup.Namespace + "/" + vmGroup.Name
+	if _, loaded := expanded.LoadOrStore(groupKey, struct{}{}); loaded {
+		log.Info("VirtualMachineGroup was already expanded in this backup - skipping its members")
+		return item, nil, nil
+	}
+	// A failed expansion is retried by the next trigger
+	defer func() {
+		if err != nil {
+			expanded.Delete(groupKey)
+		}
+	}()
+
+	visited := map[string]struct{}{vmGroup.Name: {}}
+	listedVMs := map[string]*vmopv1.VirtualMachine{}
+	memberNames, nestedGroupNames, memberErrs := p.resolveMembers(ctx, vmGroup, visited, []string{vmGroup.Name}, listedVMs, opts)
+	if len(memberNames) == 0 && len(nestedGroupNames) == 0 && len(memberErrs) == 0 {
+		log.Warnf("VirtualMachineGroup %s/%s has no members - no members to back up", vmGroup.Namespace, vmGroup.Name)
+		if len(extraItems) == 0 {
+			return item, nil, nil
+		}
+		return item, p.filterByBackupNamespaces(extraItems, backup, log), nil
+	}
+
+	// Large groups are served by a single List to avoid a round-trip per member, unless the
+	// members were found by their spec.groupName, which already listed the VirtualMachines
+	if len(memberNames) >= memberListThreshold && len(listedVMs) == 0 {
+		vms, err := p.listVirtualMachines(ctx, vmGroup.Namespace, opts)
+		if err != nil {
+			log.Warnf("Failed to list VirtualMachines, falling back to individual Gets: %v", err)
+		} else {
+			listedVMs = vms
+		}
+	}
+
+	deps := NewDependencyCollector()
+
+	for _, groupName := range nestedGroupNames {
+		log.WithField("nestedGroup", groupName).Info("Adding nested VirtualMachineGroup to backup")
+		deps.AddVirtualMachineGroup(vmGroup.Namespace, groupName)
+	}
+
+	concurrency, err := getInt(config, concurrencyConfigKey, defaultConcurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	if concurrency < 1 {
+		return nil, nil, errors.Errorf("invalid %s config %d, must be at least 1", concurrencyConfigKey, concurrency)
+	}
+
+	// Members are resolved by a bounded pool of workers. Every worker writes to the
+	// slot of its member, so merging in member order keeps the result deterministic.
+	results := make([]memberResult, len(memberNames))
+	workers := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, memberName := range memberNames {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			results[i] = p.resolveMember(ctx, vmGroup.Namespace, memberName, listedVMs[memberName], opts)
+		}()
+	}
+	wg.Wait()
+
+	var memberVMs []*vmopv1.VirtualMachine
+	for _, result := range results {
+		if result.err != nil {
+			memberErrs = append(memberErrs, result.err)
+			continue
+		}
+		memberVMs = append(memberVMs, result.vm)
+		deps.Add(result.items...)
+	}
+
+	if backupServices {
+		if err := p.extractServicesOfVMs(ctx, vmGroup.Namespace, memberVMs, opts, deps); err != nil {
+			log.Warnf("VirtualMachineGroup %s/%s: failed to list VirtualMachineServices: %v - its services were not backed up", vmGroup.Namespace, vmGroup.Name, err)
+		}
+	}
+
+	if verifySecrets {
+		if err := p.verifySecrets(ctx, vmGroup.Namespace, deps.Items(), opts, log); err != nil {
+			log.Warnf("VirtualMachineGroup %s/%s: failed to list secrets: %v - its bootstrap secrets were not verified", vmGroup.Namespace, vmGroup.Name, err)
+		}
+	}
+
+	if aggregate := utilerrors.NewAggregate(memberErrs); aggregate != nil {
+		if failOnMissingMember {
+			return nil, nil, errors.Wrapf(aggregate, "failed to resolve %d members of VirtualMachineGroup %s/%s", len(aggregate.Errors()), vmGroup.Namespace, vmGroup.Name)
+		}
+
+		// Velero records warning level entries of the backup log as backup warnings, so unresolved
+		// members show up in "velero backup describe". The warnings carry no log fields, so the
+		// group is named in the message.
+		for _, err := range aggregate.Errors() {
+			log.Warnf("VirtualMachineGroup %s/%s: %v - its dependencies were not backed up", vmGroup.Namespace, vmGroup.Name, err)
+		}
+	}
+
+	// Only the discovered dependencies are subject to excludeDependencyKinds
+	included := NewDependencyCollector()
+	included.Add(filterExcludedKinds(deps.Items(), excludedKinds)...)
+	included.Add(extraItems...)
+
+	additionalItems := p.filterByBackupNamespaces(included.Items(), backup, log)
+
+	// Guard the backup against runaway expansion, e.g. of a misconfigured group
+	if len(additionalItems) > maxAdditionalItems {
+		if failOnMaxAdditionalItems {
+			return nil, nil, errors.Errorf("VirtualMachineGroup %s/%s has %d additional items, more than the maximum of %d", vmGroup.Namespace, vmGroup.Name, len(additionalItems), maxAdditionalItems)
+		}
+		log.Warnf("VirtualMachineGroup %s/%s has %d additional items, more than the maximum of %d - only the first %d are backed up", vmGroup.Namespace, vmGroup.Name, len(additionalItems), maxAdditionalItems, maxAdditionalItems)
+		additionalItems = additionalItems[:maxAdditionalItems]
+	}
+
+	counts := countDependencies(additionalItems)
+	log.WithFields(counts.fields()).Infof("Adding %d additional items to backup - %s", len(additionalItems), counts)
+
+	return item, additionalItems, nil
+}
+
+// groupMembers returns the members of a VirtualMachineGroup declared in spec.bootOrder,
+// merged with the members VM Operator linked to the group in status.members unless
+// includeStatusMembers is false. A member listed in both places is only returned once.
+func groupMembers(vmGroup *vmopv1.VirtualMachineGroup, includeStatusMembers bool) []vmopv1.GroupMember {
+	var members []vmopv1.GroupMember
+	seen := make(map[vmopv1.GroupMember]struct{})
+	addMember := func(member vmopv1.GroupMember) {
+		if member.Name == "" {
+			return
+		}
+		// Kind is optional and defaults to VirtualMachine
+		if member.Kind == "" {
+			member.Kind = "VirtualMachine"
+		}
+		if _, exists := seen[member]; exists {
+			return
+		}
+		seen[member] = struct{}{}
+		members = append(members, member)
+	}
+
+	for _, bootOrderGroup := range vmGroup.Spec.BootOrder {
+		for _, member := range bootOrderGroup.Members {
+			addMember(member)
+		}
+	}
+	if includeStatusMembers {
+		for _, member := range vmGroup.Status.Members {
+			addMember(vmopv1.GroupMember{Name: member.Name, Kind: member.Kind})
+		}
+	}
+
+	return members
+}
+
+// planAdditionalItems returns the direct members of a VirtualMachineGroup as additional items
+// It only uses the group itself, so neither nested groups nor the dependencies of the VMs are expanded
+func planAdditionalItems(vmGroup *vmopv1.VirtualMachineGroup, includeStatusMembers bool) []veleroplugin.ResourceIdentifier {
+	deps := NewDependencyCollector()
+	for _, member := range groupMembers(vmGroup, includeStatusMembers) {
+		if member.Kind == "VirtualMachineGroup" {
+			deps.AddVirtualMachineGroup(vmGroup.Namespace, member.Name)
+		} else {
+			deps.AddVirtualMachine(vmGroup.Namespace, member.Name)
+		}
+	}
+	return deps.Items()
+}
+
+// extraBackupItems returns the resources listed in the extraBackupAnnotation of a VirtualMachineGroup
+// as additional items in the group's namespace. Malformed entries are skipped with a warning.
+func (p *VMGroupBackupItemAction) extraBackupItems(vmGroup *vmopv1.VirtualMachineGroup, log logrus.FieldLogger) []veleroplugin.ResourceIdentifier {
+	value, found := vmGroup.Annotations[extraBackupAnnotation]
+	if !found {
+		return nil
+	}
+
+	deps := NewDependencyCollector()
+	for _, entry := range parseList(value) {
+		resource, name, found := strings.Cut(entry, "/")
+		if !found || len(validation.IsDNS1123Subdomain(resource)) > 0 || len(validation.IsDNS1123Subdomain(name)) > 0 {
+			log.Warnf("VirtualMachineGroup %s/%s: ignoring malformed %s entry %q, expected <resource>/<name>", vmGroup.Namespace, vmGroup.Name, extraBackupAnnotation, entry)
+			continue
+		}
+		if deps.Add(veleroplugin.ResourceIdentifier{
+			GroupResource: schema.ParseGroupResource(resource),
+			Namespace:     vmGroup.Namespace,
+			Name:          name,
+		}) {
+			log.WithFields(logrus.Fields{"resource": resource, "name": name}).Infof("Adding extra resource from %s", extraBackupAnnotation)
+		}
+	}
+	return deps.Items()
+}
+
+// maxGroupNestingDepth is how many levels of nested VirtualMachineGroups are expanded below the
+// backed up group, guarding the traversal against misconfigured clusters
+const maxGroupNestingDepth = 10
+
+// resolveOptions holds the plugin config used while resolving a member VirtualMachine
+type resolveOptions struct {
+	backoff              wait.Backoff
+	verifyPVCs           bool
+	getTimeout           time.Duration
+	includeStatusMembers bool
+	// log is the logger of the Execute call, carrying its action, backup and group fields
+	log logrus.FieldLogger
+}
+
+// requestContext returns the context of a single API request, bounded by getTimeout
+func (o resolveOptions) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, o.getTimeout)
+}
+
+// vmLog returns the logger for a member VirtualMachine and its dependencies, derived from the
+// Execute logger so the entries keep its action, backup and group fields
+func (o resolveOptions) vmLog(vm *vmopv1.VirtualMachine) logrus.FieldLogger {
+	return o.log.WithFields(logrus.Fields{"namespace": vm.Namespace, "vm": vm.Name})
+}
+
+// timeoutError replaces an error caused by an expired request context with one naming
+// the configured timeout, so a hung API server is told apart from other failures
+func (o resolveOptions) timeoutError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.Errorf("request timed out after %s, see the %s config", o.getTimeout, getTimeoutConfigKey)
+	}
+	return err
+}
+
+// memberResult holds a member VirtualMachine and its additional items, or the error resolving it
+type memberResult struct {
+	vm    *vmopv1.VirtualMachine
+	items []veleroplugin.ResourceIdentifier
+	err   error
+}
+
+// resolveMember returns a member VirtualMachine and its dependencies as additional items
+// vm is the already listed VirtualMachine, if any, otherwise it is fetched from the cluster.
+// The extract helpers add the dependencies to a collector and take the namespace of the
+// identifiers from the VM itself rather than from the group. Every namespaced reference of a
+// v1alpha5 VirtualMachine is local to the VM's namespace, so no reference carries a namespace
+// of its own. A panic resolving the member, e.g. on a field of a newer VM Operator, is returned
+// as its error, so the other members of the group are still backed up.
+func (p *VMGroupBackupItemAction) resolveMember(ctx context.Context, namespace, memberName string, vm *vmopv1.VirtualMachine, opts resolveOptions) (result memberResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			log := opts.log.WithFields(logrus.Fields{"namespace": namespace, "vm": memberName})
+			log.Errorf("Recovered from panic resolving member VirtualMachine: %v", r)
+			log.Debugf("Stack of the panic:\n%s", debug.Stack())
+			result = memberResult{err: errors.Errorf("panic resolving member VirtualMachine %s/%s: %v", namespace, memberName, r)}
+		}
+	}()
+
+	if vm == nil {
+		var err error
+		vm, err = p.getVirtualMachine(ctx, namespace, memberName, opts)
+		if err != nil {
+			return memberResult{err: errors.Wrapf(err, "failed to get member VirtualMachine %s/%s", namespace, memberName)}
+		}
+	}
+
+	log := opts.vmLog(vm)
+	log.Info("Adding VirtualMachine to backup")
+	deps := NewDependencyCollector()
+	deps.AddVirtualMachine(vm.Namespace, vm.Name)
+
+	extractSecretsFromVM(vm, deps, log)
+	extractConfigMapsFromVM(vm, deps, log)
+	pvcs := p.getPVCsOfVM(ctx, vm, opts)
+	p.extractPVCsFromVM(vm, pvcs, opts, deps, log)
+	p.extractImageFromVM(ctx, vm, opts, deps, log)
+	p.extractCdromImagesFromVM(vm, deps, log)
+	p.extractClassFromVM(vm, deps, log)
+	p.extractStorageClassesFromVM(vm, pvcs, opts, deps, log)
+	p.extractVolumeSnapshotsFromVM(vm, pvcs, deps, log)
+	p.extractResourcePolicyFromVM(vm, deps, log)
+	p.extractEncryptionClassFromVM(vm, deps, log)
+
+	return memberResult{vm: vm, items: deps.Items()}
+}
+
+// membersByGroupName returns the VirtualMachines and VirtualMachineGroups in the namespace of
+// a VirtualMachineGroup that join it through their spec.groupName. It is used for groups
+// that neither list their members in bootOrder nor have them linked in status yet.
+// The VirtualMachines are listed into listedVMs, unless it already holds them, so the members are
+// not listed again.
+func (p *VMGroupBackupItemAction) membersByGroupName(ctx context.Context, vmGroup *vmopv1.VirtualMachineGroup, listedVMs map[string]*vmopv1.VirtualMachine, opts resolveOptions) ([]vmopv1.GroupMember, error) {
+	var members []vmopv1.GroupMember
+
+	// Nested groups share the namespace, so the VirtualMachines are listed once for all of them
+	if len(listedVMs) == 0 {
+		vms, err := p.listVirtualMachines(ctx, vmGroup.Namespace, opts)
+		if err != nil {
+			return nil, err
+		}
+		maps.Copy(listedVMs, vms)
+	}
+	for _, name := range slices.Sorted(maps.Keys(listedVMs)) {
+		if listedVMs[name].Spec.GroupName == vmGroup.Name {
+			members = append(members, vmopv1.GroupMember{Name: name, Kind: "VirtualMachine"})
+		}
+	}
+
+	// The second List gets its own deadline so a slow first one does not shorten it
+	groupListCtx, cancelGroupList := opts.requestContext(ctx)
+	defer cancelGroupList()
+
+	vmGroupList := &vmopv1.VirtualMachineGroupList{}
+	if err := p.client.List(groupListCtx, vmGroupList, client.InNamespace(vmGroup.Namespace)); err != nil {
+		return nil, opts.timeoutError(err)
+	}
+	for _, nestedGroup := range vmGroupList.Items {
+		if nestedGroup.Spec.GroupName == vmGroup.Name {
+			members = append(members, vmopv1.GroupMember{Name: nestedGroup.Name, Kind: "VirtualMachineGroup"})
+		}
+	}
+
+	opts.log.WithFields(logrus.Fields{"namespace": vmGroup.Namespace, "group": vmGroup.Name}).Infof("VirtualMachineGroup lists no members - found %d members by their spec.groupName", len(members))
+	return members, nil
+}
+
+// resolveMembers walks the members of a VirtualMachineGroup and returns the
+// names of its VirtualMachine members and nested VirtualMachineGroups.
+// Nested groups are resolved recursively; visited holds the names of the groups
+// already walked so a group is never expanded twice, and path holds the groups from
+// the backed up one down to vmGroup to tell cycles apart from groups nested twice.
+// A cycle or nesting deeper than maxGroupNestingDepth is logged as a warning and not expanded further.
+// The VirtualMachines listed to find members by their spec.groupName are added to listedVMs.
+func (p *VMGroupBackupItemAction) resolveMembers(ctx context.Context, vmGroup *vmopv1.VirtualMachineGroup, visited map[string]struct{}, path []string, listedVMs map[string]*vmopv1.VirtualMachine, opts resolveOptions) ([]string, []string, []error) {
+	var vmNames, groupNames []string
+	var errs []error
+
+	members := groupMembers(vmGroup, opts.includeStatusMembers)
+	if len(members) == 0 {
+		linkedMembers, err := p.membersByGroupName(ctx, vmGroup, listedVMs, opts)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to find the members of VirtualMachineGroup %s/%s", vmGroup.Namespace, vmGroup.Name))
+		}
+		members = linkedMembers
+	}
+
+	for _, member := range members {
+		if member.Kind != "VirtualMachineGroup" {
+			vmNames = append(vmNames, member.Name)
+			continue
+		}
+
+		if slices.Contains(path, member.Name) {
+			opts.log.WithFields(logrus.Fields{"namespace": vmGroup.Namespace, "group": member.Name}).Warnf("VirtualMachineGroup %s/%s: cyclic member reference %s - not expanding it again",
+				vmGroup.Namespace, path[0], strings.Join(append(slices.Clone(path), member.Name), " -> "))
+			continue
+		}
+		if _, exists := visited[member.Name]; exists {
+			opts.log.WithFields(logrus.Fields{"namespace": vmGroup.Namespace, "group": member.Name}).Info("VirtualMachineGroup was already processed - skipping")
+			continue
+		}
+		visited[member.Name] = struct{}{}
+
+		nestedGroup, err := p.getVirtualMachineGroup(ctx, vmGroup.Namespace, member.Name, opts)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "failed to get member VirtualMachineGroup %s/%s", vmGroup.Namespace, member.Name))
+			continue
+		}
+		groupNames = append(groupNames, member.Name)
+
+		if len(path) >= maxGroupNestingDepth {
+			opts.log.WithFields(logrus.Fields{"namespace": vmGroup.Namespace, "group": member.Name}).Warnf("VirtualMachineGroup %s/%s: nested more than %d levels deep at %s - its members were not backed up",
+				vmGroup.Namespace, path[0], maxGroupNestingDepth, member.Name)
+			continue
+		}
+
+		nestedVMNames, nestedGroupNames, nestedErrs := p.resolveMembers(ctx, nestedGroup, visited, append(slices.Clone(path), member.Name), listedVMs, opts)
+		vmNames = append(vmNames, nestedVMNames...)
+		groupNames = append(groupNames, nestedGroupNames...)
+		errs = append(errs, nestedErrs...)
+	}
+
+	return vmNames, groupNames, errs
+}
+
+// getVirtualMachineGroup fetches a VirtualMachineGroup from the cluster
+func (p *VMGroupBackupItemAction) getVirtualMachineGroup(ctx context.Context, namespace, name string, opts resolveOptions) (*vmopv1.VirtualMachineGroup, error) {
+	getCtx, cancel := opts.requestContext(ctx)
+	defer cancel()
+
+	vmGroup := &vmopv1.VirtualMachineGroup{}
+	if err := p.client.Get(getCtx, client.ObjectKey{Namespace: namespace, Name: name}, vmGroup); err != nil {
+		return nil, opts.timeoutError(err)
+	}
+	return vmGroup, nil
+}
+
+// getVirtualMachine fetches a VirtualMachine from the cluster
+// Transient API errors are retried with exponential backoff, other errors like NotFound fail right away.
+// Every attempt is bounded by getTimeout; an attempt that times out is not retried.
+func (p *VMGroupBackupItemAction) getVirtualMachine(ctx context.Context, namespace, name string, opts resolveOptions) (*vmopv1.VirtualMachine, error) {
+	vm := &vmopv1.VirtualMachine{}
+	var lastErr error
+	err := wait.ExponentialBackoff(opts.backoff, func() (bool, error) {
+		getCtx, cancel := opts.requestContext(ctx)
+		defer cancel()
+
+		lastErr = p.client.Get(getCtx, client.ObjectKey{Namespace: namespace, Name: name}, vm)
+		if lastErr == nil {
+			return true, nil
+		}
+		if isTransientError(lastErr) {
+			opts.log.WithFields(logrus.Fields{"namespace": namespace, "vm": name}).Infof("Transient error getting VirtualMachine - retrying: %v", lastErr)
+			return false, nil
+		}
+		return false, opts.timeoutError(lastErr)
+	})
+	if wait.Interrupted(err) {
+		return nil, lastErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// getRetryBackoff returns the backoff for member VirtualMachine Gets from the plugin config
+func getRetryBackoff(config map[string]string) (wait.Backoff, error) {
+	attempts, err := getInt(config, getRetryAttemptsConfigKey, defaultGetRetryAttempts)
+	if err != nil {
+		return wait.Backoff{}, err
+	}
+	if attempts < 1 {
+		return wait.Backoff{}, errors.Errorf("invalid %s config %d, must be at least 1", getRetryAttemptsConfigKey, attempts)
+	}
+
+	duration, err := getDuration(config, getRetryBackoffConfigKey, defaultGetRetryBackoff)
+	if err != nil {
+		return wait.Backoff{}, err
+	}
+
+	return wait.Backoff{
+		Duration: duration,
+		Factor:   2,
+		Steps:    attempts,
+	}, nil
+}
+
+// isTransientError reports whether an API error is worth retrying
+func isTransientError(err error) bool {
+	return apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsConflict(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsUnexpectedServerError(err)
+}
+
+// extractServicesOfVMs adds the VirtualMachineServices in a namespace whose selector matches
+// the labels of any of the VirtualMachines
+// A service without a selector selects no VirtualMachine and is not added.
+func (p *VMGroupBackupItemAction) extractServicesOfVMs(ctx context.Context, namespace string, vms []*vmopv1.VirtualMachine, opts resolveOptions, deps *DependencyCollector) error {
+	listCtx, cancel := opts.requestContext(ctx)
+	defer cancel()
+
+	serviceList := &vmopv1.VirtualMachineServiceList{}
+	if err := p.client.List(listCtx, serviceList, client.InNamespace(namespace)); err != nil {
+		return opts.timeoutError(err)
+	}
+
+	matched := 0
+	for _, service := range serviceList.Items {
+		if len(service.Spec.Selector) == 0 {
+			continue
+		}
+		selector := labels.SelectorFromSet(service.Spec.Selector)
+		for _, vm := range vms {
+			if !selector.Matches(labels.Set(vm.Labels)) {
+				continue
+			}
+			matched++
+			if deps.AddVirtualMachineService(service.Namespace, service.Name) {
+				opts.vmLog(vm).WithField("service", service.Name).Info("Adding VirtualMachineService")
+			}
+			break
+		}
+	}
+
+	if matched == 0 {
+		opts.log.WithField("namespace", namespace).Infof("None of the %d VirtualMachineServices selects a member VirtualMachine", len(serviceList.Items))
+	}
+	return nil
+}
+
+// listVirtualMachines lists the VirtualMachines in a namespace, keyed by name
+func (p *VMGroupBackupItemAction) listVirtualMachines(ctx context.Context, namespace string, opts resolveOptions) (map[string]*vmopv1.VirtualMachine, error) {
+	listCtx, cancel := opts.requestContext(ctx)
+	defer cancel()
+
+	vmList := &vmopv1.VirtualMachineList{}
+	if err := p.client.List(listCtx, vmList, client.InNamespace(namespace)); err != nil {
+		return nil, opts.timeoutError(err)
+	}
+
+	vms := make(map[string]*vmopv1.VirtualMachine, len(vmList.Items))
+	for i := range vmList.Items {
+		vms[vmList.Items[i].Name] = &vmList.Items[i]
+	}
+	return vms, nil
+}
+
+// extractSecretsFromVM adds the bootstrap secrets referenced by a VirtualMachine
+// Secrets referenced more than once are only added once. spec.readinessProbe is not scanned, as
+// none of its TCPSocket, GuestHeartbeat and GuestInfo actions references a secret or ConfigMap,
+// and neither is spec.advanced, whose boot disk, provisioning and change block tracking settings
+// reference nothing. v1alpha5 has no extension references on VMs.
+// It is shared with VMRestoreItemAction, which restores the secrets with the VM.
+func extractSecretsFromVM(vm *vmopv1.VirtualMachine, deps *DependencyCollector, log logrus.FieldLogger) {
+	bootstrap := vm.Spec.Bootstrap
+	if bootstrap == nil {
+		return
+	}
+
+	addSecret := func(name string) {
+		if deps.AddSecret(vm.Namespace, name) {
+			log.WithField("secret", name).Info("Adding bootstrap Secret")
+		}
+	}
+
+	// CloudInit raw cloud-config, and the user passwords and write_files content of the inline
+	// cloud-config. SSH authorized keys are inline strings in v1alpha5 and need no secret.
+	if cloudInit := bootstrap.CloudInit; cloudInit != nil {
+		if cloudInit.RawCloudConfig != nil && !usesConfigMapTransport(vm) {
+			addSecret(cloudInit.RawCloudConfig.Name)
+		}
+		if cloudInit.CloudConfig != nil {
+			for _, user := range cloudInit.CloudConfig.Users {
+				if user.Passwd != nil {
+					addSecret(user.Passwd.Name)
+				}
+				if user.HashedPasswd != nil {
+					addSecret(user.HashedPasswd.Name)
+				}
+			}
+			for _, writeFile := range cloudInit.CloudConfig.WriteFiles {
+				addSecret(writeFileSecretName(writeFile.Content))
+			}
+		}
+	}
+
+	// LinuxPrep password and script text
+	if linuxPrep := bootstrap.LinuxPrep; linuxPrep != nil {
+		if linuxPrep.Password != nil {
+			addSecret(linuxPrep.Password.Name)
+		}
+		if linuxPrep.ScriptText != nil && linuxPrep.ScriptText.From != nil {
+			addSecret(linuxPrep.ScriptText.From.Name)
+		}
+	}
+
+	// Sysprep raw unattend data and the secrets referenced by inline sysprep
+	if sysprep := bootstrap.Sysprep; sysprep != nil {
+		if sysprep.RawSysprep != nil && !usesConfigMapTransport(vm) {
+			addSecret(sysprep.RawSysprep.Name)
+		}
+		if sysprep.Sysprep != nil {
+			if sysprep.Sysprep.GUIUnattended != nil && sysprep.Sysprep.GUIUnattended.Password != nil {
+				addSecret(sysprep.Sysprep.GUIUnattended.Password.Name)
+			}
+			if sysprep.Sysprep.Identification != nil && sysprep.Sysprep.Identification.DomainAdminPassword != nil {
+				addSecret(sysprep.Sysprep.Identification.DomainAdminPassword.Name)
+			}
+			if sysprep.Sysprep.UserData.ProductID != nil {
+				addSecret(sysprep.Sysprep.UserData.ProductID.Name)
+			}
+			if sysprep.Sysprep.ScriptText != nil && sysprep.Sysprep.ScriptText.From != nil {
+				addSecret(sysprep.Sysprep.ScriptText.From.Name)
+			}
+		}
+	}
+
+	// vAppConfig properties sourced from secrets and the raw properties secret
+	if vAppConfig := bootstrap.VAppConfig; vAppConfig != nil {
+		for _, property := range vAppConfig.Properties {
+			if property.Value.From != nil {
+				addSecret(property.Value.From.Name)
+			}
+		}
+		if !usesConfigMapTransport(vm) {
+			addSecret(vAppConfig.RawProperties)
+		}
+	}
+}
+
+// writeFileSecretName returns the name of the secret a cloud-config write_files entry sources its
+// content from. The content is either the file content itself or a {name, key} secret reference.
+func writeFileSecretName(content json.RawMessage) string {
+	var selector vmopv1common.SecretKeySelector
+	if err := json.Unmarshal(content, &selector); err != nil {
+		return ""
+	}
+	return selector.Name
+}
+
+// usesConfigMapTransport reports whether a VirtualMachine was created with the v1alpha1 API
+// and a ConfigMap metadata transport. The raw cloud-config, sysprep and vApp properties of
+// such a VM name a ConfigMap instead of a Secret.
+func usesConfigMapTransport(vm *vmopv1.VirtualMachine) bool {
+	_, found := vm.Annotations[vmopv1.V1alpha1ConfigMapTransportAnnotation]
+	return found
+}
+
+// verifySecrets warns about the secrets among items that do not exist in namespace
+// Members often share a bootstrap secret template under different names, so the secrets are
+// verified with a single List of the namespace's secret metadata instead of a Get per secret.
+// Secret data is not fetched.
+func (p *VMGroupBackupItemAction) verifySecrets(ctx context.Context, namespace string, items []veleroplugin.ResourceIdentifier, opts resolveOptions, log logrus.FieldLogger) error {
+	var referenced []string
+	for _, item := range items {
+		if item.GroupResource == (schema.GroupResource{Resource: "secrets"}) && item.Namespace == namespace {
+			referenced = append(referenced, item.Name)
+		}
+	}
+	if len(referenced) == 0 {
+		return nil
+	}
+
+	listCtx, cancel := opts.requestContext(ctx)
+	defer cancel()
+
+	secretList := &metav1.PartialObjectMetadataList{}
+	secretList.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("SecretList"))
+	if err := p.client.List(listCtx, secretList, client.InNamespace(namespace)); err != nil {
+		return opts.timeoutError(err)
+	}
+
+	existing := make(map[string]struct{}, len(secretList.Items))
+	for _, secret := range secretList.Items {
+		existing[secret.Name] = struct{}{}
+	}
+	for _, name := range referenced {
+		if _, found := existing[name]; !found {
+			log.WithField("secret", name).Warnf("Secret %s/%s does not exist - it will be missing from the backup", namespace, name)
+		}
+	}
+	return nil
+}
+
+// extractConfigMapsFromVM adds the bootstrap ConfigMaps referenced by a VirtualMachine
+// Only VMs using the v1alpha1 ConfigMap metadata transport reference ConfigMaps
+func extractConfigMapsFromVM(vm *vmopv1.VirtualMachine, deps *DependencyCollector, log logrus.FieldLogger) {
+	bootstrap := vm.Spec.Bootstrap
+	if bootstrap == nil || !usesConfigMapTransport(vm) {
+		return
+	}
+
+	var configMapNames []string
+	if bootstrap.CloudInit != nil && bootstrap.CloudInit.RawCloudConfig != nil {
+		configMapNames = append(configMapNames, bootstrap.CloudInit.RawCloudConfig.Name)
+	}
+	if bootstrap.Sysprep != nil && bootstrap.Sysprep.RawSysprep != nil {
+		configMapNames = append(configMapNames, bootstrap.Sysprep.RawSysprep.Name)
+	}
+	if bootstrap.VAppConfig != nil {
+		configMapNames = append(configMapNames, bootstrap.VAppConfig.RawProperties)
+	}
+
+	for _, configMapName := range configMapNames {
+		if deps.AddConfigMap(vm.Namespace, configMapName) {
+			log.WithField("configMap", configMapName).Info("Adding bootstrap ConfigMap")
+		}
+	}
+}
+
+// extractPVCsFromVM adds the PVCs attached to a VirtualMachine
+// In v1alpha5 a persistentVolumeClaim is the only volume source. Instance storage volumes
+// use it as well, with instanceVolumeClaim set and a claim name generated by VM Operator.
+// With verifyPVCs set, a claim missing from pvcs is reported as a backup warning naming the
+// VM and volume. The claim is still added, so the backup is not failed by it.
+func (p *VMGroupBackupItemAction) extractPVCsFromVM(vm *vmopv1.VirtualMachine, pvcs map[string]fetchedPVC, opts resolveOptions, deps *DependencyCollector, log logrus.FieldLogger) {
+	for _, volume := range vm.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		claimName := volume.PersistentVolumeClaim.ClaimName
+		if claimName == "" {
+			log.WithField("volume", volume.Name).Info("Volume has no claim name yet - skipping")
+			continue
+		}
+
+		// A claim mounted through several volumes is added, logged and verified once
+		if !deps.AddPVC(vm.Namespace, claimName) {
+			log.WithFields(logrus.Fields{"volume": volume.Name, "pvc": claimName}).Info("PVC was already added for another volume - skipping")
+			continue
+		}
+
+		if volume.PersistentVolumeClaim.InstanceVolumeClaim != nil {
+			log.WithField("pvc", claimName).Info("Adding instance storage PVC")
+		} else {
+			log.WithField("pvc", claimName).Info("Adding PVC")
+		}
+
+		if opts.verifyPVCs {
+			p.verifyPVC(vm, volume.Name, claimName, pvcs[claimName], log)
+		}
+	}
+}
+
+// verifyPVC warns when the PVC of a volume of a VirtualMachine does not exist
+func (p *VMGroupBackupItemAction) verifyPVC(vm *vmopv1.VirtualMachine, volumeName, claimName string, fetched fetchedPVC, log logrus.FieldLogger) {
+	if fetched.err == nil {
+		return
+	}
+	if apierrors.IsNotFound(fetched.err) {
+		log.WithFields(logrus.Fields{"volume": volumeName, "pvc": claimName}).Warnf("PVC %s/%s does not exist - it will be missing from the backup", vm.Namespace, claimName)
+	} else {
+		log.WithFields(logrus.Fields{"volume": volumeName, "pvc": claimName}).Warnf("Failed to verify PVC %s/%s: %v", vm.Namespace, claimName, fetched.err)
+	}
+}
+
+// extractStorageClassesFromVM adds the StorageClasses of the PVCs attached to a VirtualMachine
+// PVCs that could not be fetched or have no storage class are skipped. A failed fetch is only
+// warned about here when verifyPVCs has not reported it already.
+func (p *VMGroupBackupItemAction) extractStorageClassesFromVM(vm *vmopv1.VirtualMachine, pvcs map[string]fetchedPVC, opts resolveOptions, deps *DependencyCollector, log logrus.FieldLogger) {
+	reportedClaims := make(map[string]struct{})
+	for _, volume := range vm.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName == "" {
+			continue
+		}
+
+		claimName := volume.PersistentVolumeClaim.ClaimName
+		fetched := pvcs[claimName]
+		if fetched.err != nil {
+			if _, reported := reportedClaims[claimName]; !reported && !opts.verifyPVCs {
+				log.WithField("pvc", claimName).Warnf("Failed to get PVC %s/%s - its StorageClass was not backed up: %v", vm.Namespace, claimName, fetched.err)
+			}
+			reportedClaims[claimName] = struct{}{}
+			continue
+		}
+
+		pvc := fetched.pvc
+		if pvc == nil || pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+			continue
+		}
+
+		storageClassName := *pvc.Spec.StorageClassName
+		if deps.AddStorageClass(storageClassName) {
+			log.WithFields(logrus.Fields{"pvc": claimName, "storageClass": storageClassName}).Info("Adding StorageClass")
+		}
+	}
+}
+
+// extractVolumeSnapshotsFromVM adds the VolumeSnapshots the PVCs attached to a VirtualMachine
+// were provisioned from, so the snapshots are restored before the PVCs that reference them
+// PVCs that could not be fetched were already reported by extractStorageClassesFromVM.
+func (p *VMGroupBackupItemAction) extractVolumeSnapshotsFromVM(vm *vmopv1.VirtualMachine, pvcs map[string]fetchedPVC, deps *DependencyCollector, log logrus.FieldLogger) {
+	for _, volume := range vm.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName == "" {
+			continue
+		}
+
+		claimName := volume.PersistentVolumeClaim.ClaimName
+		pvc := pvcs[claimName].pvc
+		if pvc == nil {
+			continue
+		}
+
+		namespace, snapshotName := volumeSnapshotSourceOf(pvc)
+		if snapshotName == "" {
+			continue
+		}
+		if deps.AddVolumeSnapshot(namespace, snapshotName) {
+			log.WithFields(logrus.Fields{"pvc": claimName, "volumeSnapshot": snapshotName}).Info("Adding VolumeSnapshot")
+		}
+	}
+}
+
+// volumeSnapshotSourceOf returns the namespace and name of the VolumeSnapshot a PVC was
+// provisioned from, or an empty name when it was not. spec.dataSourceRef may name a snapshot
+// in another namespace, spec.dataSource only one in the PVC's namespace.
+func volumeSnapshotSourceOf(pvc *corev1.PersistentVolumeClaim) (string, string) {
+	if ref := pvc.Spec.DataSourceRef; ref != nil && isVolumeSnapshot(ref.APIGroup, ref.Kind) {
+		if ref.Namespace != nil && *ref.Namespace != "" {
+			return *ref.Namespace, ref.Name
+		}
+		return pvc.Namespace, ref.Name
+	}
+	if source := pvc.Spec.DataSource; source != nil && isVolumeSnapshot(source.APIGroup, source.Kind) {
+		return pvc.Namespace, source.Name
+	}
+	return "", ""
+}
+
+// fetchedPVC is a PVC attached to a VirtualMachine, or the error fetching it
+type fetchedPVC struct {
+	pvc *corev1.PersistentVolumeClaim
+	err error
+}
+
+// getPVCsOfVM fetches the PVCs attached to a VirtualMachine, keyed by claim name
+// Every claim is fetched once, however many volumes mount it, and serves both the
+// verification of the PVCs and the extraction of their StorageClasses.
+func (p *VMGroupBackupItemAction) getPVCsOfVM(ctx context.Context, vm *vmopv1.VirtualMachine, opts resolveOptions) map[string]fetchedPVC {
+	pvcs := make(map[string]fetchedPVC)
+	for _, volume := range vm.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName == "" {
+			continue
+		}
+
+		claimName := volume.PersistentVolumeClaim.ClaimName
+		if _, fetched := pvcs[claimName]; fetched {
+			continue
+		}
+		pvc, err := p.getPVC(ctx, vm.Namespace, claimName, opts)
+		pvcs[claimName] = fetchedPVC{pvc: pvc, err: err}
+	}
+	return pvcs
+}
+
+// getPVC fetches a PersistentVolumeClaim from the cluster
+func (p *VMGroupBackupItemAction) getPVC(ctx context.Context, namespace, name string, opts resolveOptions) (*corev1.PersistentVolumeClaim, error) {
+	getCtx, cancel := opts.requestContext(ctx)
+	defer cancel()
+
+	pvc := &corev1.PersistentVolumeClaim{}
+	if err := p.client.Get(getCtx, client.ObjectKey{Namespace: namespace, Name: name}, pvc); err != nil {
+		return nil, opts.timeoutError(err)
+	}
+	return pvc, nil
+}
+
+// extractImageFromVM adds the VirtualMachineImage or ClusterVirtualMachineImage a VirtualMachine was deployed from
+// spec.image carries the kind of the image; a bare spec.imageName is resolved the way
+// VM Operator does, checking the VM's namespace before the cluster-scoped images
+func (p *VMGroupBackupItemAction) extractImageFromVM(ctx context.Context, vm *vmopv1.VirtualMachine, opts resolveOptions, deps *DependencyCollector, log logrus.FieldLogger) {
+	var imageKind, imageName string
+	switch {
+	case vm.Spec.Image != nil && vm.Spec.Image.Name != "":
+		imageKind, imageName = vm.Spec.Image.Kind, vm.Spec.Image.Name
+	case vm.Spec.ImageName != "":
+		imageKind, imageName = "ClusterVirtualMachineImage", vm.Spec.ImageName
+		getCtx, cancel := opts.requestContext(ctx)
+		defer cancel()
+
+		image := &vmopv1.VirtualMachineImage{}
+		if err := p.client.Get(getCtx, client.ObjectKey{Namespace: vm.Namespace, Name: imageName}, image); err == nil {
+			imageKind = "VirtualMachineImage"
+		} else if !apierrors.IsNotFound(err) {
+			log.WithField("image", imageName).Warnf("Failed to look up VirtualMachineImage %s/%s, assuming a ClusterVirtualMachineImage: %v", vm.Namespace, imageName, opts.timeoutError(err))
+		}
+	default:
+		return
+	}
+
+	if imageKind == "ClusterVirtualMachineImage" {
+		log.WithField("image", imageName).Info("Adding ClusterVirtualMachineImage")
+		deps.AddImage("", imageName)
+		return
+	}
+
+	log.WithField("image", imageName).Info("Adding VirtualMachineImage")
+	deps.AddImage(vm.Namespace, imageName)
+}
+
+// extractCdromImagesFromVM adds the ISO images backing the CD-ROMs of a VirtualMachine, e.g. the
+// media of an ISO-based installation or customization
+// The kind of a CD-ROM image defaults to VirtualMachineImage. Media on a PVC is attached as a
+// volume and added by extractPVCsFromVM.
+func (p *VMGroupBackupItemAction) extractCdromImagesFromVM(vm *vmopv1.VirtualMachine, deps *DependencyCollector, log logrus.FieldLogger) {
+	if vm.Spec.Hardware == nil {
+		return
+	}
+	for _, cdrom := range vm.Spec.Hardware.Cdrom {
+		if cdrom.Image.Name == "" {
+			continue
+		}
+		cdromLog := log.WithFields(logrus.Fields{"cdrom": cdrom.Name, "image": cdrom.Image.Name})
+		if cdrom.Image.Kind == "ClusterVirtualMachineImage" {
+			if deps.AddImage("", cdrom.Image.Name) {
+				cdromLog.Info("Adding ClusterVirtualMachineImage of CD-ROM")
+			}
+			continue
+		}
+		if deps.AddImage(vm.Namespace, cdrom.Image.Name) {
+			cdromLog.Info("Adding VirtualMachineImage of CD-ROM")
+		}
+	}
+}
+
+// extractClassFromVM adds the VirtualMachineClass of a VirtualMachine
+// Classes shared by several members are deduplicated by the group's collector
+func (p *VMGroupBackupItemAction) extractClassFromVM(vm *vmopv1.VirtualMachine, deps *DependencyCollector, log logrus.FieldLogger) {
+	if deps.AddClass(vm.Namespace, vm.Spec.ClassName) {
+		log.WithField("class", vm.Spec.ClassName).Info("Adding VirtualMachineClass")
+	}
+}
+
+// filterByBackupNamespaces drops the namespaced resource identifiers whose namespace
+// is outside the backup's included/excluded namespaces. Cluster-scoped items are kept.
+func (p *VMGroupBackupItemAction) filterByBackupNamespaces(items []veleroplugin.ResourceIdentifier, backup *velerov1.Backup, log logrus.FieldLogger) []veleroplugin.ResourceIdentifier {
+	namespaces := collections.NewIncludesExcludes().
+		Includes(backup.Spec.IncludedNamespaces...).
+		Excludes(backup.Spec.ExcludedNamespaces...)
+
+	filtered := make([]veleroplugin.ResourceIdentifier, 0, len(items))
+	for _, item := range items {
+		if item.Namespace != "" && !namespaces.ShouldInclude(item.Namespace) {
+			log.Infof("Skipping %s %s/%s - namespace is not included in backup %s", item.GroupResource, item.Namespace, item.Name, backup.Name)
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+
+	return filtered
+}
+
+// extractResourcePolicyFromVM adds the VirtualMachineSetResourcePolicy of a VirtualMachine
+// VirtualMachineGroups have no policy reference in v1alpha5, so the VMs are the only source.
+// Policies shared by several members are deduplicated by the group's collector.
+func (p *VMGroupBackupItemAction) extractResourcePolicyFromVM(vm *vmopv1.VirtualMachine, deps *DependencyCollector, log logrus.FieldLogger) {
+	if vm.Spec.Reserved == nil {
+		return
+	}
+	if deps.AddResourcePolicy(vm.Namespace, vm.Spec.Reserved.ResourcePolicyName) {
+		log.WithField("resourcePolicy", vm.Spec.Reserved.ResourcePolicyName).Info("Adding VirtualMachineSetResourcePolicy")
+	}
+}
+
+// extractEncryptionClassFromVM adds the EncryptionClass an encrypted VirtualMachine names in spec.crypto
+// An EncryptionClass only names a key provider and key ID of vCenter and references no secret,
+// so the class is the only dependency. VMs encrypted with the default key provider have none.
+func (p *VMGroupBackupItemAction) extractEncryptionClassFromVM(vm *vmopv1.VirtualMachine, deps *DependencyCollector, log logrus.FieldLogger) {
+	if vm.Spec.Crypto == nil {
+		return
+	}
+	if deps.AddEncryptionClass(vm.Namespace, vm.Spec.Crypto.EncryptionClassName) {
+		log.WithField("encryptionClass", vm.Spec.Crypto.EncryptionClassName).Info("Adding EncryptionClass")
+	}
+}
+
+// excludedDependencyKinds returns the dependency resources excluded with excludeDependencyKinds
+// Entries that are not a known dependency kind, including the VMs and PVCs themselves, are
+// logged and ignored.
+func (p *VMGroupBackupItemAction) excludedDependencyKinds(config map[string]string, log logrus.FieldLogger) map[string]struct{} {
+	excluded := make(map[string]struct{})
+	for _, kind := range parseList(config[excludeDependencyKindsConfigKey]) {
+		kind = strings.ToLower(kind)
+		if _, known := excludableDependencyKinds[kind]; !known {
+			log.Warnf("Ignoring unknown %s entry %s", excludeDependencyKindsConfigKey, kind)
+			continue
+		}
+		excluded[kind] = struct{}{}
+	}
+	return excluded
+}
+
+// filterExcludedKinds drops the resource identifiers of the excluded resources
+func filterExcludedKinds(items []veleroplugin.ResourceIdentifier, excludedKinds map[string]struct{}) []veleroplugin.ResourceIdentifier {
+	if len(excludedKinds) == 0 {
+		return items
+	}
+
+	filtered := make([]veleroplugin.ResourceIdentifier, 0, len(items))
+	for _, item := range items {
+		if _, excluded := excludedKinds[item.Resource]; excluded {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+	return filtered
+}
@@ -0,0 +1,2311 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	vmopv1cloudinit "github.com/vmware-tanzu/vm-operator/api/v1alpha5/cloudinit"
+	vmopv1common "github.com/vmware-tanzu/vm-operator/api/v1alpha5/common"
+	vmopv1sysprep "github.com/vmware-tanzu/vm-operator/api/v1alpha5/sysprep"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// newTestBackupAction returns a VMGroupBackupItemAction with a fake client serving objs
+// and the plugin config config
+func newTestBackupAction(t *testing.T, config map[string]string, objs ...client.Object) (*VMGroupBackupItemAction, *logrustest.Hook) {
+	t.Helper()
+	return newTestBackupActionWithClient(t, config, newFakeClient(t, objs...))
+}
+
+// newTestBackupActionWithClient returns a VMGroupBackupItemAction with the given client
+// and the plugin config config
+func newTestBackupActionWithClient(t testing.TB, config map[string]string, c client.Client) (*VMGroupBackupItemAction, *logrustest.Hook) {
+	t.Helper()
+
+	log, hook := newTestLogger()
+	configMapClient := newConfigMapClient(common.PluginKindBackupItemAction, VMGroupBackupPluginName, config)
+	return NewVMGroupBackupItemActionWithClient(log, c, configMapClient), hook
+}
+
+// extractSecrets returns the names of the bootstrap secrets extracted from a VM
+func extractSecrets(t *testing.T, vm *vmopv1.VirtualMachine) []string {
+	t.Helper()
+
+	log, _ := newTestLogger()
+	deps := NewDependencyCollector()
+	extractSecretsFromVM(vm, deps, log)
+	return namesOf(deps.Items(), "secrets")
+}
+
+func TestExtractSecretsFromVMBootstrap(t *testing.T) {
+	tests := []struct {
+		name      string
+		bootstrap *vmopv1.VirtualMachineBootstrapSpec
+		expected  []string
+	}{
+		{
+			name:      "no bootstrap",
+			bootstrap: nil,
+			expected:  nil,
+		},
+		{
+			name: "cloud-init raw cloud-config",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				CloudInit: &vmopv1.VirtualMachineBootstrapCloudInitSpec{
+					RawCloudConfig: &vmopv1common.SecretKeySelector{Name: "cloud-config", Key: "user-data"},
+				},
+			},
+			expected: []string{"cloud-config"},
+		},
+		{
+			name: "linuxprep password and script text",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				LinuxPrep: &vmopv1.VirtualMachineBootstrapLinuxPrepSpec{
+					Password:   &vmopv1common.PasswordSecretKeySelector{Name: "linux-password", Key: "password"},
+					ScriptText: &vmopv1common.ValueOrSecretKeySelector{From: &vmopv1common.SecretKeySelector{Name: "linux-script", Key: "script"}},
+				},
+			},
+			expected: []string{"linux-password", "linux-script"},
+		},
+		{
+			name: "raw sysprep",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				Sysprep: &vmopv1.VirtualMachineBootstrapSysprepSpec{
+					RawSysprep: &vmopv1common.SecretKeySelector{Name: "unattend", Key: "unattend"},
+				},
+			},
+			expected: []string{"unattend"},
+		},
+		{
+			name: "inline sysprep",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				Sysprep: &vmopv1.VirtualMachineBootstrapSysprepSpec{
+					Sysprep: &vmopv1sysprep.Sysprep{
+						GUIUnattended:  &vmopv1sysprep.GUIUnattended{Password: &vmopv1sysprep.PasswordSecretKeySelector{Name: "admin-password", Key: "password"}},
+						Identification: &vmopv1sysprep.Identification{DomainAdminPassword: &vmopv1sysprep.DomainPasswordSecretKeySelector{Name: "domain-password", Key: "password"}},
+						UserData:       vmopv1sysprep.UserData{ProductID: &vmopv1sysprep.ProductIDSecretKeySelector{Name: "product-id", Key: "id"}},
+					},
+				},
+			},
+			expected: []string{"admin-password", "domain-password", "product-id"},
+		},
+		{
+			name: "secret referenced twice and empty names",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				Sysprep: &vmopv1.VirtualMachineBootstrapSysprepSpec{
+					Sysprep: &vmopv1sysprep.Sysprep{
+						GUIUnattended:  &vmopv1sysprep.GUIUnattended{Password: &vmopv1sysprep.PasswordSecretKeySelector{Name: "windows", Key: "password"}},
+						Identification: &vmopv1sysprep.Identification{DomainAdminPassword: &vmopv1sysprep.DomainPasswordSecretKeySelector{Name: "windows", Key: "domain-password"}},
+						UserData:       vmopv1sysprep.UserData{ProductID: &vmopv1sysprep.ProductIDSecretKeySelector{Name: "", Key: "id"}},
+					},
+				},
+			},
+			expected: []string{"windows"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.Bootstrap = tc.bootstrap
+
+			assert.Equal(t, tc.expected, extractSecrets(t, vm))
+		})
+	}
+}
+
+func TestExtractSecretsFromVMVAppConfig(t *testing.T) {
+	secretProperty := func(key, secretName string) vmopv1common.KeyValueOrSecretKeySelectorPair {
+		return vmopv1common.KeyValueOrSecretKeySelectorPair{
+			Key:   key,
+			Value: vmopv1common.ValueOrSecretKeySelector{From: &vmopv1common.SecretKeySelector{Name: secretName, Key: key}},
+		}
+	}
+	valueProperty := func(key, value string) vmopv1common.KeyValueOrSecretKeySelectorPair {
+		return vmopv1common.KeyValueOrSecretKeySelectorPair{
+			Key:   key,
+			Value: vmopv1common.ValueOrSecretKeySelector{Value: &value},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		vAppConfig *vmopv1.VirtualMachineBootstrapVAppConfigSpec
+		expected   []string
+	}{
+		{
+			name:       "no vAppConfig",
+			vAppConfig: nil,
+			expected:   nil,
+		},
+		{
+			name:       "raw properties",
+			vAppConfig: &vmopv1.VirtualMachineBootstrapVAppConfigSpec{RawProperties: "vapp-properties"},
+			expected:   []string{"vapp-properties"},
+		},
+		{
+			name: "properties sourced from secrets",
+			vAppConfig: &vmopv1.VirtualMachineBootstrapVAppConfigSpec{
+				Properties: []vmopv1common.KeyValueOrSecretKeySelectorPair{
+					secretProperty("password", "vapp-secret"),
+					valueProperty("hostname", "appliance"),
+					secretProperty("token", "vapp-token"),
+				},
+			},
+			expected: []string{"vapp-secret", "vapp-token"},
+		},
+		{
+			name: "secret shared by properties and raw properties",
+			vAppConfig: &vmopv1.VirtualMachineBootstrapVAppConfigSpec{
+				Properties: []vmopv1common.KeyValueOrSecretKeySelectorPair{
+					secretProperty("password", "vapp-secret"),
+					secretProperty("token", "vapp-secret"),
+				},
+				RawProperties: "vapp-secret",
+			},
+			expected: []string{"vapp-secret"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.Bootstrap = &vmopv1.VirtualMachineBootstrapSpec{VAppConfig: tc.vAppConfig}
+
+			assert.Equal(t, tc.expected, extractSecrets(t, vm))
+		})
+	}
+}
+
+func TestExtractSecretsFromVMInlineCloudConfig(t *testing.T) {
+	vm := newVM("vm-1")
+	vm.Spec.Bootstrap = &vmopv1.VirtualMachineBootstrapSpec{
+		CloudInit: &vmopv1.VirtualMachineBootstrapCloudInitSpec{
+			CloudConfig: &vmopv1cloudinit.CloudConfig{
+				Users: []vmopv1cloudinit.User{
+					{
+						Name:              "admin",
+						Passwd:            &vmopv1common.SecretKeySelector{Name: "admin-passwd", Key: "passwd"},
+						SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA admin"},
+					},
+					{
+						Name:         "ops",
+						HashedPasswd: &vmopv1common.SecretKeySelector{Name: "ops-passwd", Key: "hash"},
+					},
+					{
+						Name:   "readonly",
+						Passwd: &vmopv1common.SecretKeySelector{Name: "admin-passwd", Key: "readonly"},
+					},
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"admin-passwd", "ops-passwd"}, extractSecrets(t, vm))
+}
+
+func TestExtractSecretsFromVMWriteFiles(t *testing.T) {
+	vm := newVM("vm-1")
+	vm.Spec.Bootstrap = &vmopv1.VirtualMachineBootstrapSpec{
+		CloudInit: &vmopv1.VirtualMachineBootstrapCloudInitSpec{
+			CloudConfig: &vmopv1cloudinit.CloudConfig{
+				Users: []vmopv1cloudinit.User{
+					{Name: "admin", Passwd: &vmopv1common.SecretKeySelector{Name: "bootstrap", Key: "passwd"}},
+				},
+				WriteFiles: []vmopv1cloudinit.WriteFile{
+					{Path: "/etc/app/tls.key", Content: json.RawMessage(`{"name":"app-tls","key":"tls.key"}`)},
+					{Path: "/etc/app/tls.crt", Content: json.RawMessage(`{"name":"app-tls","key":"tls.crt"}`)},
+					{Path: "/etc/app/token", Content: json.RawMessage(`{"name":"bootstrap","key":"token"}`)},
+					{Path: "/etc/motd", Content: json.RawMessage(`"Hello, world."`)},
+					{Path: "/etc/empty"},
+				},
+			},
+		},
+	}
+
+	// Secrets shared by several files or with the user passwords are added once
+	assert.Equal(t, []string{"bootstrap", "app-tls"}, extractSecrets(t, vm))
+}
+
+// executeBackup runs the backup action on a VirtualMachineGroup and returns the additional items
+func executeBackup(t *testing.T, action *VMGroupBackupItemAction, vmGroup *vmopv1.VirtualMachineGroup) []veleroplugin.ResourceIdentifier {
+	t.Helper()
+
+	item := toUnstructured(t, vmGroup)
+	updatedItem, additionalItems, err := action.Execute(item, &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+	require.NoError(t, err)
+	assert.Equal(t, item, updatedItem)
+	return additionalItems
+}
+
+// withCloudConfigSecret sets the raw cloud-config secret of a VM
+func withCloudConfigSecret(vm *vmopv1.VirtualMachine, secretName string) *vmopv1.VirtualMachine {
+	vm.Spec.Bootstrap = &vmopv1.VirtualMachineBootstrapSpec{
+		CloudInit: &vmopv1.VirtualMachineBootstrapCloudInitSpec{
+			RawCloudConfig: &vmopv1common.SecretKeySelector{Name: secretName, Key: "user-data"},
+		},
+	}
+	return vm
+}
+
+func TestExecuteDeduplicatesSharedSecret(t *testing.T) {
+	action, _ := newTestBackupAction(t, nil,
+		withCloudConfigSecret(newVM("vm-1"), "shared-cloud-config"),
+		withCloudConfigSecret(newVM("vm-2"), "shared-cloud-config"),
+	)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-2"))
+
+	assert.Equal(t, []string{"vm-1", "vm-2"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, []string{"shared-cloud-config"}, namesOf(additionalItems, "secrets"))
+}
+
+// TestExecuteReadinessProbe covers that spec.readinessProbe adds no items, as none of its actions
+// references a secret or ConfigMap in v1alpha5
+func TestExecuteReadinessProbe(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe *vmopv1.VirtualMachineReadinessProbeSpec
+	}{
+		{
+			name: "nil probe",
+		},
+		{
+			name:  "tcp socket",
+			probe: &vmopv1.VirtualMachineReadinessProbeSpec{TCPSocket: &vmopv1.TCPSocketAction{Port: intstr.FromInt32(443)}},
+		},
+		{
+			name:  "guest heartbeat",
+			probe: &vmopv1.VirtualMachineReadinessProbeSpec{GuestHeartbeat: &vmopv1.GuestHeartbeatAction{ThresholdStatus: vmopv1.GreenHeartbeatStatus}},
+		},
+		{
+			name:  "guest info",
+			probe: &vmopv1.VirtualMachineReadinessProbeSpec{GuestInfo: []vmopv1.GuestInfoAction{{Key: "ready", Value: "true"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := withCloudConfigSecret(newVM("vm-1"), "cloud-config")
+			vm.Spec.ReadinessProbe = tt.probe
+			action, _ := newTestBackupAction(t, nil, vm)
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+			assert.Equal(t, []string{"cloud-config"}, namesOf(additionalItems, "secrets"))
+			assert.Empty(t, namesOf(additionalItems, "configmaps"))
+		})
+	}
+}
+
+// TestExecuteAdvancedSpec covers that spec.advanced adds no items, as none of its settings
+// references a secret or ConfigMap in v1alpha5
+func TestExecuteAdvancedSpec(t *testing.T) {
+	bootDiskCapacity := resource.MustParse("50Gi")
+	changeBlockTracking := true
+	tests := []struct {
+		name     string
+		advanced *vmopv1.VirtualMachineAdvancedSpec
+	}{
+		{
+			name: "nil advanced spec",
+		},
+		{
+			name: "every setting",
+			advanced: &vmopv1.VirtualMachineAdvancedSpec{
+				BootDiskCapacity:              &bootDiskCapacity,
+				DefaultVolumeProvisioningMode: vmopv1.VolumeProvisioningModeThin,
+				ChangeBlockTracking:           &changeBlockTracking,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := withCloudConfigSecret(newVM("vm-1"), "cloud-config")
+			vm.Spec.Advanced = tt.advanced
+			action, _ := newTestBackupAction(t, nil, vm)
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+			assert.Equal(t, []string{"cloud-config"}, namesOf(additionalItems, "secrets"))
+			assert.Empty(t, namesOf(additionalItems, "configmaps"))
+		})
+	}
+}
+
+// requestCounter counts the Gets and Lists of VirtualMachines sent through an intercepted client
+type requestCounter struct {
+	vmGets  atomic.Int32
+	vmLists atomic.Int32
+}
+
+// funcs returns the interceptor functions counting the requests, and passing them on
+func (c *requestCounter) funcs() interceptor.Funcs {
+	return interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, isVM := obj.(*vmopv1.VirtualMachine); isVM {
+				c.vmGets.Add(1)
+			}
+			return cl.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if _, isVMList := list.(*vmopv1.VirtualMachineList); isVMList {
+				c.vmLists.Add(1)
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	}
+}
+
+// newVMs returns count VMs named vm-0, vm-1, ... with a secret each, and their names
+func newVMs(count int) ([]client.Object, []string) {
+	objs := make([]client.Object, 0, count)
+	names := make([]string, 0, count)
+	for i := range count {
+		name := fmt.Sprintf("vm-%d", i)
+		objs = append(objs, withCloudConfigSecret(newVM(name), name+"-cloud-config"))
+		names = append(names, name)
+	}
+	return objs, names
+}
+
+func TestExecuteMemberLookup(t *testing.T) {
+	tests := []struct {
+		name          string
+		members       int
+		expectedLists int32
+		expectedGets  int32
+	}{
+		{
+			name:          "small group gets every member",
+			members:       memberListThreshold - 1,
+			expectedLists: 0,
+			expectedGets:  memberListThreshold - 1,
+		},
+		{
+			name:          "large group lists the members once",
+			members:       memberListThreshold,
+			expectedLists: 1,
+			expectedGets:  0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			objs, names := newVMs(tc.members)
+			counter := &requestCounter{}
+			action, _ := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, counter.funcs(), objs...))
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", names...))
+
+			assert.Equal(t, names, namesOf(additionalItems, "virtualmachines"))
+			assert.Len(t, namesOf(additionalItems, "secrets"), tc.members)
+			assert.Equal(t, tc.expectedLists, counter.vmLists.Load())
+			assert.Equal(t, tc.expectedGets, counter.vmGets.Load())
+		})
+	}
+}
+
+func TestExecuteUsesListedVMs(t *testing.T) {
+	objs, names := newVMs(memberListThreshold)
+
+	// The list carries a secret the stored VM does not have, so the dependencies
+	// show whether the listed or a fetched VM was used
+	counter := &requestCounter{}
+	funcs := counter.funcs()
+	list := funcs.List
+	funcs.List = func(ctx context.Context, cl client.WithWatch, objList client.ObjectList, opts ...client.ListOption) error {
+		if err := list(ctx, cl, objList, opts...); err != nil {
+			return err
+		}
+		if vmList, isVMList := objList.(*vmopv1.VirtualMachineList); isVMList {
+			withCloudConfigSecret(&vmList.Items[0], "listed-cloud-config")
+		}
+		return nil
+	}
+	action, _ := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, funcs, objs...))
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", names...))
+
+	secrets := namesOf(additionalItems, "secrets")
+	assert.Contains(t, secrets, "listed-cloud-config")
+	assert.NotContains(t, secrets, "vm-0-cloud-config")
+	assert.Equal(t, int32(0), counter.vmGets.Load())
+}
+
+func TestExecuteGetsMembersMissingFromList(t *testing.T) {
+	objs, names := newVMs(memberListThreshold)
+
+	// The list misses the last member, which has to be fetched on its own
+	counter := &requestCounter{}
+	funcs := counter.funcs()
+	list := funcs.List
+	funcs.List = func(ctx context.Context, cl client.WithWatch, objList client.ObjectList, opts ...client.ListOption) error {
+		if err := list(ctx, cl, objList, opts...); err != nil {
+			return err
+		}
+		if vmList, isVMList := objList.(*vmopv1.VirtualMachineList); isVMList {
+			vmList.Items = vmList.Items[:len(vmList.Items)-1]
+		}
+		return nil
+	}
+	action, _ := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, funcs, objs...))
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", names...))
+
+	assert.Equal(t, names, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, int32(1), counter.vmGets.Load())
+}
+
+func BenchmarkMemberLookup(b *testing.B) {
+	objs, names := newVMs(50)
+	action, _ := newTestBackupActionWithClient(b, nil, newFakeClient(b, objs...))
+	ctx := context.Background()
+	opts := resolveOptions{backoff: wait.Backoff{Steps: 1}, getTimeout: defaultGetTimeout, log: action.log}
+
+	b.Run("get", func(b *testing.B) {
+		for b.Loop() {
+			for _, name := range names {
+				if _, err := action.getVirtualMachine(ctx, testNamespace, name, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+
+	b.Run("list", func(b *testing.B) {
+		for b.Loop() {
+			vms, err := action.listVirtualMachines(ctx, testNamespace, opts)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, name := range names {
+				if vms[name] == nil {
+					b.Fatalf("VirtualMachine %s was not listed", name)
+				}
+			}
+		}
+	})
+}
+
+// warnings returns the messages of the warning entries of a log hook
+func warnings(hook *logrustest.Hook) []string {
+	var messages []string
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			messages = append(messages, entry.Message)
+		}
+	}
+	return messages
+}
+
+func TestExecuteWarnsAboutMissingMember(t *testing.T) {
+	action, hook := newTestBackupAction(t, nil, newVM("vm-1"))
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-x"))
+
+	assert.Equal(t, []string{"vm-1"}, namesOf(additionalItems, "virtualmachines"))
+	require.Len(t, warnings(hook), 1)
+	assert.Contains(t, warnings(hook)[0], "vm-ns/group-1")
+	assert.Contains(t, warnings(hook)[0], "vm-ns/vm-x")
+}
+
+// withNestedGroups adds VirtualMachineGroup members to the boot order of a group
+func withNestedGroups(vmGroup *vmopv1.VirtualMachineGroup, groupNames ...string) *vmopv1.VirtualMachineGroup {
+	bootOrderGroup := vmopv1.VirtualMachineGroupBootOrderGroup{}
+	for _, groupName := range groupNames {
+		bootOrderGroup.Members = append(bootOrderGroup.Members, vmopv1.GroupMember{Name: groupName, Kind: "VirtualMachineGroup"})
+	}
+	vmGroup.Spec.BootOrder = append(vmGroup.Spec.BootOrder, bootOrderGroup)
+	return vmGroup
+}
+
+func TestExecuteNestedGroups(t *testing.T) {
+	tests := []struct {
+		name             string
+		groups           []*vmopv1.VirtualMachineGroup
+		expectedVMs      []string
+		expectedGroups   []string
+		expectedWarnings []string
+	}{
+		{
+			name: "two levels of nesting",
+			groups: []*vmopv1.VirtualMachineGroup{
+				withNestedGroups(newVMGroup("group-1", "vm-1"), "group-2"),
+				withNestedGroups(newVMGroup("group-2", "vm-2"), "group-3"),
+				newVMGroup("group-3", "vm-3"),
+			},
+			expectedVMs:    []string{"vm-1", "vm-2", "vm-3"},
+			expectedGroups: []string{"group-2", "group-3"},
+		},
+		{
+			name: "group nested twice",
+			groups: []*vmopv1.VirtualMachineGroup{
+				withNestedGroups(newVMGroup("group-1", "vm-1"), "group-2", "group-3"),
+				withNestedGroups(newVMGroup("group-2", "vm-2"), "group-3"),
+				newVMGroup("group-3", "vm-3"),
+			},
+			expectedVMs:    []string{"vm-1", "vm-2", "vm-3"},
+			expectedGroups: []string{"group-2", "group-3"},
+		},
+		{
+			name: "cycle back to the backed up group",
+			groups: []*vmopv1.VirtualMachineGroup{
+				withNestedGroups(newVMGroup("group-1", "vm-1"), "group-2"),
+				withNestedGroups(newVMGroup("group-2", "vm-2"), "group-1"),
+			},
+			expectedVMs:      []string{"vm-1", "vm-2"},
+			expectedGroups:   []string{"group-2"},
+			expectedWarnings: []string{"VirtualMachineGroup vm-ns/group-1: cyclic member reference group-1 -> group-2 -> group-1 - not expanding it again"},
+		},
+		{
+			name: "cycle between nested groups",
+			groups: []*vmopv1.VirtualMachineGroup{
+				withNestedGroups(newVMGroup("group-1", "vm-1"), "group-2"),
+				withNestedGroups(newVMGroup("group-2", "vm-2"), "group-3"),
+				withNestedGroups(newVMGroup("group-3", "vm-3"), "group-2"),
+			},
+			expectedVMs:      []string{"vm-1", "vm-2", "vm-3"},
+			expectedGroups:   []string{"group-2", "group-3"},
+			expectedWarnings: []string{"VirtualMachineGroup vm-ns/group-1: cyclic member reference group-1 -> group-2 -> group-3 -> group-2 - not expanding it again"},
+		},
+		{
+			name: "self reference",
+			groups: []*vmopv1.VirtualMachineGroup{
+				withNestedGroups(newVMGroup("group-1", "vm-1"), "group-1"),
+			},
+			expectedVMs:      []string{"vm-1"},
+			expectedWarnings: []string{"VirtualMachineGroup vm-ns/group-1: cyclic member reference group-1 -> group-1 - not expanding it again"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			objs := []client.Object{newVM("vm-1"), newVM("vm-2"), newVM("vm-3")}
+			for _, vmGroup := range tc.groups {
+				objs = append(objs, vmGroup)
+			}
+			action, hook := newTestBackupAction(t, nil, objs...)
+
+			additionalItems := executeBackup(t, action, tc.groups[0])
+
+			assert.Equal(t, tc.expectedVMs, namesOf(additionalItems, "virtualmachines"))
+			assert.Equal(t, tc.expectedGroups, namesOf(additionalItems, "virtualmachinegroups"))
+			assert.Equal(t, tc.expectedWarnings, warnings(hook))
+		})
+	}
+}
+
+func TestExecuteNestedGroupsMaxDepth(t *testing.T) {
+	// A chain of groups nested two levels deeper than expanded
+	var objs []client.Object
+	var groups []*vmopv1.VirtualMachineGroup
+	for i := 0; i <= maxGroupNestingDepth+2; i++ {
+		vmGroup := newVMGroup(fmt.Sprintf("group-%d", i), fmt.Sprintf("vm-%d", i))
+		if i < maxGroupNestingDepth+2 {
+			withNestedGroups(vmGroup, fmt.Sprintf("group-%d", i+1))
+		}
+		groups = append(groups, vmGroup)
+		objs = append(objs, vmGroup, newVM(fmt.Sprintf("vm-%d", i)))
+	}
+	action, hook := newTestBackupAction(t, nil, objs...)
+
+	additionalItems := executeBackup(t, action, groups[0])
+
+	// The deepest expanded group is backed up without its members
+	assert.Len(t, namesOf(additionalItems, "virtualmachines"), maxGroupNestingDepth)
+	assert.Len(t, namesOf(additionalItems, "virtualmachinegroups"), maxGroupNestingDepth)
+	assert.NotContains(t, namesOf(additionalItems, "virtualmachinegroups"), fmt.Sprintf("group-%d", maxGroupNestingDepth+1))
+	assert.Equal(t, []string{fmt.Sprintf("VirtualMachineGroup vm-ns/group-0: nested more than %d levels deep at group-%d - its members were not backed up", maxGroupNestingDepth, maxGroupNestingDepth)}, warnings(hook))
+}
+
+func TestExtractImageFromVM(t *testing.T) {
+	namespacedImage := &vmopv1.VirtualMachineImage{
+		TypeMeta:   metav1.TypeMeta{APIVersion: vmopv1.GroupVersion.String(), Kind: "VirtualMachineImage"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "vmi-namespaced"},
+	}
+
+	tests := []struct {
+		name      string
+		image     *vmopv1.VirtualMachineImageRef
+		imageName string
+		expected  []veleroplugin.ResourceIdentifier
+	}{
+		{
+			name:     "no image",
+			expected: nil,
+		},
+		{
+			name:  "namespaced image reference",
+			image: &vmopv1.VirtualMachineImageRef{Kind: "VirtualMachineImage", Name: "vmi-namespaced"},
+			expected: []veleroplugin.ResourceIdentifier{{
+				GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachineimages"},
+				Namespace:     testNamespace,
+				Name:          "vmi-namespaced",
+			}},
+		},
+		{
+			name:  "cluster-scoped image reference",
+			image: &vmopv1.VirtualMachineImageRef{Kind: "ClusterVirtualMachineImage", Name: "vmi-cluster"},
+			expected: []veleroplugin.ResourceIdentifier{{
+				GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "clustervirtualmachineimages"},
+				Name:          "vmi-cluster",
+			}},
+		},
+		{
+			name:      "image name of a namespaced image",
+			imageName: "vmi-namespaced",
+			expected: []veleroplugin.ResourceIdentifier{{
+				GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachineimages"},
+				Namespace:     testNamespace,
+				Name:          "vmi-namespaced",
+			}},
+		},
+		{
+			name:      "image name of a cluster-scoped image",
+			imageName: "vmi-cluster",
+			expected: []veleroplugin.ResourceIdentifier{{
+				GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "clustervirtualmachineimages"},
+				Name:          "vmi-cluster",
+			}},
+		},
+		{
+			name:     "empty image reference",
+			image:    &vmopv1.VirtualMachineImageRef{Kind: "VirtualMachineImage"},
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.Image = tc.image
+			vm.Spec.ImageName = tc.imageName
+
+			action, _ := newTestBackupAction(t, nil, namespacedImage)
+			deps := NewDependencyCollector()
+			action.extractImageFromVM(context.Background(), vm, resolveOptions{getTimeout: defaultGetTimeout}, deps, action.log)
+
+			assert.Equal(t, tc.expected, deps.Items())
+		})
+	}
+}
+
+// withCdroms attaches CD-ROMs backed by the images to a VM
+func withCdroms(vm *vmopv1.VirtualMachine, images ...vmopv1.VirtualMachineImageRef) *vmopv1.VirtualMachine {
+	if vm.Spec.Hardware == nil {
+		vm.Spec.Hardware = &vmopv1.VirtualMachineHardwareSpec{}
+	}
+	for i, image := range images {
+		vm.Spec.Hardware.Cdrom = append(vm.Spec.Hardware.Cdrom, vmopv1.VirtualMachineCdromSpec{Name: fmt.Sprintf("cdrom%d", i), Image: image})
+	}
+	return vm
+}
+
+func TestExtractCdromImagesFromVM(t *testing.T) {
+	tests := []struct {
+		name     string
+		vm       *vmopv1.VirtualMachine
+		expected []veleroplugin.ResourceIdentifier
+	}{
+		{
+			name: "no hardware",
+			vm:   newVM("vm-1"),
+		},
+		{
+			name: "no CD-ROMs",
+			vm:   withCdroms(newVM("vm-1")),
+		},
+		{
+			name: "ISO images",
+			vm: withCdroms(newVM("vm-1"),
+				vmopv1.VirtualMachineImageRef{Name: "vmi-installer"},
+				vmopv1.VirtualMachineImageRef{Kind: "ClusterVirtualMachineImage", Name: "vmi-drivers"},
+				// A second CD-ROM with the same media is only added once
+				vmopv1.VirtualMachineImageRef{Kind: "VirtualMachineImage", Name: "vmi-installer"},
+			),
+			expected: []veleroplugin.ResourceIdentifier{
+				{
+					GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachineimages"},
+					Namespace:     testNamespace,
+					Name:          "vmi-installer",
+				},
+				{
+					GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "clustervirtualmachineimages"},
+					Name:          "vmi-drivers",
+				},
+			},
+		},
+		{
+			name: "empty image reference",
+			vm:   withCdroms(newVM("vm-1"), vmopv1.VirtualMachineImageRef{Kind: "VirtualMachineImage"}),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			action, _ := newTestBackupAction(t, nil)
+			deps := NewDependencyCollector()
+			action.extractCdromImagesFromVM(tc.vm, deps, action.log)
+
+			assert.Equal(t, tc.expected, deps.Items())
+		})
+	}
+}
+
+func TestExecuteExtractsCdromImages(t *testing.T) {
+	vm := withCdroms(newVM("vm-1"), vmopv1.VirtualMachineImageRef{Name: "vmi-installer"})
+	vm.Spec.Image = &vmopv1.VirtualMachineImageRef{Kind: "ClusterVirtualMachineImage", Name: "vmi-ubuntu"}
+	action, _ := newTestBackupAction(t, nil, vm)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+	assert.Equal(t, []string{"vmi-installer"}, namesOf(additionalItems, "virtualmachineimages"))
+	assert.Equal(t, []string{"vmi-ubuntu"}, namesOf(additionalItems, "clustervirtualmachineimages"))
+}
+
+// withClass sets the VirtualMachineClass of a VM
+func withClass(vm *vmopv1.VirtualMachine, className string) *vmopv1.VirtualMachine {
+	vm.Spec.ClassName = className
+	return vm
+}
+
+func TestExecuteExtractsClasses(t *testing.T) {
+	action, _ := newTestBackupAction(t, nil,
+		withClass(newVM("vm-1"), "best-effort-small"),
+		withClass(newVM("vm-2"), "best-effort-small"),
+		withClass(newVM("vm-3"), "guaranteed-large"),
+		withClass(newVM("vm-4"), ""),
+	)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-2", "vm-3", "vm-4"))
+
+	assert.Equal(t, []string{"best-effort-small", "guaranteed-large"}, namesOf(additionalItems, "virtualmachineclasses"))
+	for _, item := range additionalItems {
+		if item.Resource == "virtualmachineclasses" {
+			assert.Equal(t, vmoperatorGroup, item.Group)
+			assert.Equal(t, testNamespace, item.Namespace)
+		}
+	}
+}
+
+// withPVCVolumes adds a volume per claim to a VM, named after the claim
+func withPVCVolumes(vm *vmopv1.VirtualMachine, claimNames ...string) *vmopv1.VirtualMachine {
+	for _, claimName := range claimNames {
+		vm.Spec.Volumes = append(vm.Spec.Volumes, vmopv1.VirtualMachineVolume{
+			Name: claimName,
+			VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+				PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{
+					PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+				},
+			},
+		})
+	}
+	return vm
+}
+
+// withStorageClass sets the storage class of a PVC
+func withStorageClass(pvc *corev1.PersistentVolumeClaim, storageClassName string) *corev1.PersistentVolumeClaim {
+	pvc.Spec.StorageClassName = &storageClassName
+	return pvc
+}
+
+func TestExtractStorageClassesFromVM(t *testing.T) {
+	vm := withPVCVolumes(newVM("vm-1"), "data-1", "data-2", "logs", "no-class", "missing")
+	action, hook := newTestBackupAction(t, nil,
+		withStorageClass(newPVC("data-1"), "vsan-gold"),
+		withStorageClass(newPVC("data-2"), "vsan-gold"),
+		withStorageClass(newPVC("logs"), "vsan-silver"),
+		newPVC("no-class"),
+	)
+
+	opts := resolveOptions{getTimeout: defaultGetTimeout, log: action.log}
+	deps := NewDependencyCollector()
+	action.extractStorageClassesFromVM(vm, action.getPVCsOfVM(context.Background(), vm, opts), opts, deps, opts.vmLog(vm))
+
+	assert.Equal(t, []veleroplugin.ResourceIdentifier{
+		{GroupResource: schema.GroupResource{Group: "storage.k8s.io", Resource: "storageclasses"}, Name: "vsan-gold"},
+		{GroupResource: schema.GroupResource{Group: "storage.k8s.io", Resource: "storageclasses"}, Name: "vsan-silver"},
+	}, deps.Items())
+	require.Len(t, warnings(hook), 1)
+	assert.Contains(t, warnings(hook)[0], "vm-ns/missing")
+}
+
+func TestExecuteRespectsBackupNamespaces(t *testing.T) {
+	tests := []struct {
+		name               string
+		includedNamespaces []string
+		excludedNamespaces []string
+		expected           []string
+	}{
+		{
+			name:     "all namespaces",
+			expected: []string{"vm-1", "cloud-config", "data"},
+		},
+		{
+			name:               "namespace included",
+			includedNamespaces: []string{testNamespace},
+			expected:           []string{"vm-1", "cloud-config", "data"},
+		},
+		{
+			name:               "namespace excluded",
+			excludedNamespaces: []string{testNamespace},
+			expected:           nil,
+		},
+		{
+			name:               "other namespace included",
+			includedNamespaces: []string{"other"},
+			expected:           nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := withPVCVolumes(withCloudConfigSecret(newVM("vm-1"), "cloud-config"), "data")
+			action, _ := newTestBackupAction(t, nil, vm)
+			backup := &velerov1.Backup{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"},
+				Spec: velerov1.BackupSpec{
+					IncludedNamespaces: tc.includedNamespaces,
+					ExcludedNamespaces: tc.excludedNamespaces,
+				},
+			}
+
+			_, additionalItems, err := action.Execute(toUnstructured(t, newVMGroup("group-1", "vm-1")), backup)
+			require.NoError(t, err)
+
+			var names []string
+			for _, item := range additionalItems {
+				names = append(names, item.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
+
+func TestExecuteGroupLabelSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		selector    string
+		groupLabels map[string]string
+		expectedVMs []string
+	}{
+		{
+			name:        "no selector processes every group",
+			groupLabels: nil,
+			expectedVMs: []string{"vm-1"},
+		},
+		{
+			name:        "matching group",
+			selector:    "backup.lubronzhan.io/enabled=true",
+			groupLabels: map[string]string{"backup.lubronzhan.io/enabled": "true"},
+			expectedVMs: []string{"vm-1"},
+		},
+		{
+			name:        "non-matching group",
+			selector:    "backup.lubronzhan.io/enabled=true",
+			groupLabels: map[string]string{"backup.lubronzhan.io/enabled": "false"},
+			expectedVMs: nil,
+		},
+		{
+			name:        "unlabeled group",
+			selector:    "backup.lubronzhan.io/enabled=true",
+			groupLabels: nil,
+			expectedVMs: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := map[string]string{}
+			if tc.selector != "" {
+				config[groupLabelSelectorConfigKey] = tc.selector
+			}
+			action, _ := newTestBackupAction(t, config, newVM("vm-1"))
+			vmGroup := newVMGroup("group-1", "vm-1")
+			vmGroup.Labels = tc.groupLabels
+
+			additionalItems := executeBackup(t, action, vmGroup)
+
+			assert.Equal(t, tc.expectedVMs, namesOf(additionalItems, "virtualmachines"))
+			if tc.expectedVMs == nil {
+				assert.Empty(t, additionalItems)
+			}
+		})
+	}
+}
+
+func TestExecuteInvalidGroupLabelSelector(t *testing.T) {
+	action, _ := newTestBackupAction(t, map[string]string{groupLabelSelectorConfigKey: "enabled in (true"})
+
+	_, _, err := action.Execute(toUnstructured(t, newVMGroup("group-1", "vm-1")), &velerov1.Backup{})
+	assert.ErrorContains(t, err, "invalid groupLabelSelector config")
+}
+
+func TestExecuteLogsDependencySummary(t *testing.T) {
+	action, hook := newTestBackupAction(t, nil,
+		withPVCVolumes(withClass(withCloudConfigSecret(newVM("vm-1"), "vm-1-cloud-config"), "best-effort-small"), "data-1", "data-2"),
+		withPVCVolumes(withClass(newVM("vm-2"), "best-effort-small"), "data-3"),
+		withStorageClass(newPVC("data-1"), "gold"),
+		withStorageClass(newPVC("data-2"), "gold"),
+		withStorageClass(newPVC("data-3"), "silver"),
+	)
+
+	executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-2"))
+
+	var summary *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if _, found := entry.Data["members"]; found {
+			summary = entry
+		}
+	}
+	require.NotNil(t, summary)
+	assert.Equal(t, 2, summary.Data["members"])
+	assert.Equal(t, 1, summary.Data["secrets"])
+	assert.Equal(t, 3, summary.Data["pvcs"])
+	assert.Equal(t, 1, summary.Data["classes"])
+	assert.Equal(t, 2, summary.Data["storageClasses"])
+	assert.Equal(t, 0, summary.Data["images"])
+	assert.Contains(t, summary.Message, "members=2 groups=0 secrets=1 configMaps=0 pvcs=3 images=0 classes=1 storageClasses=2 snapshots=0 policies=0 encryptionClasses=0 services=0")
+}
+
+func TestExecuteMembersOutsideBootOrder(t *testing.T) {
+	action, _ := newTestBackupAction(t, nil,
+		withCloudConfigSecret(newVM("vm-1"), "vm-1-cloud-config"),
+		withCloudConfigSecret(newVM("vm-2"), "vm-2-cloud-config"),
+		newVMGroup("nested-1"),
+	)
+
+	// vm-1 is in bootOrder and status.members, vm-2 and the nested group only in status.members
+	vmGroup := newVMGroup("group-1", "vm-1")
+	vmGroup.Status.Members = []vmopv1.VirtualMachineGroupMemberStatus{
+		{Name: "vm-1", Kind: "VirtualMachine"},
+		{Name: "vm-2", Kind: "VirtualMachine"},
+		{Name: "nested-1", Kind: "VirtualMachineGroup"},
+	}
+
+	additionalItems := executeBackup(t, action, vmGroup)
+	assert.Equal(t, []string{"vm-1", "vm-2"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, []string{"nested-1"}, namesOf(additionalItems, "virtualmachinegroups"))
+	assert.Equal(t, []string{"vm-1-cloud-config", "vm-2-cloud-config"}, namesOf(additionalItems, "secrets"))
+}
+
+func TestExecuteIncludeStatusMembers(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      map[string]string
+		expectedVMs []string
+	}{
+		{name: "default", expectedVMs: []string{"vm-1", "vm-2"}},
+		{name: "enabled", config: map[string]string{includeStatusMembersConfigKey: "true"}, expectedVMs: []string{"vm-1", "vm-2"}},
+		{name: "disabled", config: map[string]string{includeStatusMembersConfigKey: "false"}, expectedVMs: []string{"vm-1"}},
+		{name: "disabled dry run", config: map[string]string{includeStatusMembersConfigKey: "false", dryRunConfigKey: "true"}, expectedVMs: []string{"vm-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _ := newTestBackupAction(t, tt.config, newVM("vm-1"), newVM("vm-2"))
+
+			// vm-1 is in bootOrder and status.members, vm-2 was only linked by VM Operator
+			vmGroup := newVMGroup("group-1", "vm-1")
+			vmGroup.Status.Members = []vmopv1.VirtualMachineGroupMemberStatus{
+				{Name: "vm-1", Kind: "VirtualMachine"},
+				{Name: "vm-2", Kind: "VirtualMachine"},
+			}
+
+			additionalItems := executeBackup(t, action, vmGroup)
+			assert.Equal(t, tt.expectedVMs, namesOf(additionalItems, "virtualmachines"))
+		})
+	}
+}
+
+func TestExecuteInvalidIncludeStatusMembers(t *testing.T) {
+	action, _ := newTestBackupAction(t, map[string]string{includeStatusMembersConfigKey: "sometimes"}, newVM("vm-1"))
+
+	_, _, err := action.Execute(toUnstructured(t, newVMGroup("group-1", "vm-1")), &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+	assert.ErrorContains(t, err, "invalid includeStatusMembers config")
+}
+
+func TestExecuteMembersOnlyInStatus(t *testing.T) {
+	action, _ := newTestBackupAction(t, nil, withCloudConfigSecret(newVM("vm-1"), "vm-1-cloud-config"))
+
+	vmGroup := newVMGroup("group-1")
+	vmGroup.Status.Members = []vmopv1.VirtualMachineGroupMemberStatus{{Name: "vm-1", Kind: "VirtualMachine"}}
+
+	additionalItems := executeBackup(t, action, vmGroup)
+	assert.Equal(t, []string{"vm-1"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, []string{"vm-1-cloud-config"}, namesOf(additionalItems, "secrets"))
+}
+
+func TestExecuteDryRun(t *testing.T) {
+	var requests atomic.Int32
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			requests.Add(1)
+			return cl.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			requests.Add(1)
+			return cl.List(ctx, list, opts...)
+		},
+	}, withCloudConfigSecret(newVM("vm-1"), "vm-1-cloud-config"), newVM("vm-2"))
+
+	action, hook := newTestBackupActionWithClient(t, map[string]string{dryRunConfigKey: "true"}, c)
+
+	additionalItems := executeBackup(t, action, withNestedGroups(newVMGroup("group-1", "vm-1", "vm-2"), "nested-1"))
+	assert.Zero(t, requests.Load())
+
+	// Only the direct members are planned, the secret of vm-1 would need a Get of the VM
+	assert.Equal(t, []string{"vm-1", "vm-2"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, []string{"nested-1"}, namesOf(additionalItems, "virtualmachinegroups"))
+	assert.Empty(t, namesOf(additionalItems, "secrets"))
+
+	var planned int
+	for _, entry := range hook.AllEntries() {
+		if strings.HasPrefix(entry.Message, "Dry run: would add") {
+			planned++
+		}
+	}
+	assert.Equal(t, len(additionalItems), planned)
+}
+
+// failingGets returns interceptor functions failing the first failures VirtualMachine Gets with err
+// and counting all of them
+func failingGets(failures int32, err error, gets *atomic.Int32) interceptor.Funcs {
+	return interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, isVM := obj.(*vmopv1.VirtualMachine); isVM {
+				if gets.Add(1) <= failures {
+					return err
+				}
+			}
+			return cl.Get(ctx, key, obj, opts...)
+		},
+	}
+}
+
+func TestGetVirtualMachineRetries(t *testing.T) {
+	unavailable := apierrors.NewServiceUnavailable("apiserver is restarting")
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachines"}, "vm-1")
+
+	tests := []struct {
+		name         string
+		attempts     int
+		failures     int32
+		err          error
+		expectedGets int32
+		expectedErr  bool
+	}{
+		{name: "fails twice then succeeds", attempts: 3, failures: 2, err: unavailable, expectedGets: 3},
+		{name: "attempts exhausted", attempts: 2, failures: 2, err: unavailable, expectedGets: 2, expectedErr: true},
+		{name: "not found is not retried", attempts: 3, failures: 1, err: notFound, expectedGets: 1, expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets atomic.Int32
+			c := newInterceptedFakeClient(t, failingGets(tt.failures, tt.err, &gets), newVM("vm-1"))
+			action, _ := newTestBackupActionWithClient(t, nil, c)
+
+			backoff, err := getRetryBackoff(map[string]string{
+				getRetryAttemptsConfigKey: fmt.Sprint(tt.attempts),
+				getRetryBackoffConfigKey:  "1ms",
+			})
+			require.NoError(t, err)
+
+			vm, err := action.getVirtualMachine(context.Background(), testNamespace, "vm-1", resolveOptions{backoff: backoff, getTimeout: defaultGetTimeout, log: action.log})
+			if tt.expectedErr {
+				assert.ErrorIs(t, err, tt.err)
+				assert.Nil(t, vm)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, "vm-1", vm.Name)
+			}
+			assert.Equal(t, tt.expectedGets, gets.Load())
+		})
+	}
+}
+
+func TestGetRetryBackoffInvalidAttempts(t *testing.T) {
+	_, err := getRetryBackoff(map[string]string{getRetryAttemptsConfigKey: "0"})
+	assert.ErrorContains(t, err, "invalid getRetryAttempts config 0")
+}
+
+// slowGets returns interceptor functions failing the VirtualMachine Lists, so every member is
+// fetched on its own, and delaying the VirtualMachine Gets by latency(name)
+func slowGets(latency func(name string) time.Duration) interceptor.Funcs {
+	return interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, isVM := obj.(*vmopv1.VirtualMachine); isVM {
+				time.Sleep(latency(key.Name))
+			}
+			return cl.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if _, isVMList := list.(*vmopv1.VirtualMachineList); isVMList {
+				return apierrors.NewForbidden(schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachines"}, "", errors.New("list is not allowed"))
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	}
+}
+
+func TestExecuteOutputIndependentOfConcurrency(t *testing.T) {
+	objs, names := newVMs(50)
+	objs = append(objs, withPVCVolumes(withClass(newVM("vm-shared"), "best-effort-small"), "data"))
+	names = append(names, "vm-shared")
+
+	// Later members answer first, so the workers finish out of member order
+	latency := func(name string) time.Duration {
+		var i int
+		_, _ = fmt.Sscanf(name, "vm-%d", &i)
+		return time.Duration(50-i) * 20 * time.Microsecond
+	}
+
+	var expected []veleroplugin.ResourceIdentifier
+	for _, concurrency := range []string{"1", "4", "16"} {
+		t.Run("concurrency "+concurrency, func(t *testing.T) {
+			c := newInterceptedFakeClient(t, slowGets(latency), objs...)
+			action, _ := newTestBackupActionWithClient(t, map[string]string{concurrencyConfigKey: concurrency}, c)
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", names...))
+			assert.Equal(t, names, namesOf(additionalItems, "virtualmachines"))
+			if expected == nil {
+				expected = additionalItems
+				return
+			}
+			assert.Equal(t, expected, additionalItems)
+		})
+	}
+}
+
+func TestExecuteMemberPanic(t *testing.T) {
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, isPVC := obj.(*corev1.PersistentVolumeClaim); isPVC && key.Name == "malformed" {
+				var pvc *corev1.PersistentVolumeClaim
+				_ = pvc.Spec.StorageClassName
+			}
+			return cl.Get(ctx, key, obj, opts...)
+		},
+	}, newVM("vm-1"), withPVCVolumes(newVM("vm-2"), "malformed"), newVM("vm-3"))
+	action, hook := newTestBackupActionWithClient(t, nil, c)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-2", "vm-3"))
+	assert.Equal(t, []string{"vm-1", "vm-3"}, namesOf(additionalItems, "virtualmachines"))
+
+	require.Len(t, warnings(hook), 1)
+	assert.Contains(t, warnings(hook)[0], "VirtualMachineGroup vm-ns/group-1: panic resolving member VirtualMachine vm-ns/vm-2: runtime error: invalid memory address or nil pointer dereference - its dependencies were not backed up")
+
+	// The panic is logged without debug logging, its stack only with it
+	entry := entryWithMessage(t, hook, "Recovered from panic resolving member VirtualMachine: runtime error: invalid memory address or nil pointer dereference")
+	assert.Equal(t, logrus.ErrorLevel, entry.Level)
+	assert.Equal(t, "vm-2", entry.Data["vm"])
+	var stack *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if strings.HasPrefix(entry.Message, "Stack of the panic:") {
+			stack = entry
+		}
+	}
+	require.NotNil(t, stack)
+	assert.Equal(t, logrus.DebugLevel, stack.Level)
+	assert.Contains(t, stack.Message, "resolveMember")
+}
+
+func TestExecuteMemberPanicFailOnMissingMember(t *testing.T) {
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, isPVC := obj.(*corev1.PersistentVolumeClaim); isPVC {
+				panic("unexpected PVC")
+			}
+			return cl.Get(ctx, key, obj, opts...)
+		},
+	}, withPVCVolumes(newVM("vm-1"), "data"))
+	action, _ := newTestBackupActionWithClient(t, map[string]string{failOnMissingMemberConfigKey: "true"}, c)
+
+	_, _, err := action.Execute(toUnstructured(t, newVMGroup("group-1", "vm-1")), &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup-1"}})
+	assert.ErrorContains(t, err, "panic resolving member VirtualMachine vm-ns/vm-1: unexpected PVC")
+}
+
+func TestExecuteInvalidConcurrency(t *testing.T) {
+	action, _ := newTestBackupAction(t, map[string]string{concurrencyConfigKey: "0"}, newVM("vm-1"))
+	_, _, err := action.Execute(toUnstructured(t, newVMGroup("group-1", "vm-1")), &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Name: "backup-1"}})
+	assert.ErrorContains(t, err, "invalid concurrency config 0")
+}
+
+func BenchmarkExecuteConcurrency(b *testing.B) {
+	objs, names := newVMs(50)
+	vmGroup := toUnstructured(b, newVMGroup("group-1", names...))
+	backup := &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}}
+	latency := func(string) time.Duration { return 200 * time.Microsecond }
+
+	for _, bc := range []struct{ name, concurrency string }{
+		{name: "sequential", concurrency: "1"},
+		{name: "parallel", concurrency: fmt.Sprint(defaultConcurrency)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			c := newInterceptedFakeClient(b, slowGets(latency), objs...)
+			action, _ := newTestBackupActionWithClient(b, map[string]string{concurrencyConfigKey: bc.concurrency}, c)
+			for b.Loop() {
+				if _, _, err := action.Execute(vmGroup, backup); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteExtractsPVCsFromMixedVolumes(t *testing.T) {
+	vm := withPVCVolumes(newVM("vm-1"), "data")
+	vm.Spec.Volumes = append(vm.Spec.Volumes,
+		vmopv1.VirtualMachineVolume{
+			Name: "instance-storage",
+			VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+				PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{
+					PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: "vm-1-instance-0"},
+					InstanceVolumeClaim:               &vmopv1.InstanceVolumeClaimVolumeSource{StorageClass: "instance-storage", Size: resource.MustParse("10Gi")},
+				},
+			},
+		},
+		// Not backed by a PVC
+		vmopv1.VirtualMachineVolume{Name: "no-source"},
+		// Not provisioned yet
+		vmopv1.VirtualMachineVolume{
+			Name: "unclaimed",
+			VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+				PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{},
+			},
+		},
+	)
+
+	action, _ := newTestBackupAction(t, nil, vm)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+	assert.Equal(t, []string{"data", "vm-1-instance-0"}, namesOf(additionalItems, "persistentvolumeclaims"))
+}
+
+func TestExecuteConfigMapBackedCloudInit(t *testing.T) {
+	withConfigMapTransport := func(vm *vmopv1.VirtualMachine) *vmopv1.VirtualMachine {
+		vm.Annotations = map[string]string{vmopv1.V1alpha1ConfigMapTransportAnnotation: "true"}
+		return vm
+	}
+
+	tests := []struct {
+		name               string
+		vm                 *vmopv1.VirtualMachine
+		expectedSecrets    []string
+		expectedConfigMaps []string
+	}{
+		{
+			name:            "secret transport",
+			vm:              withCloudConfigSecret(newVM("vm-1"), "cloud-config"),
+			expectedSecrets: []string{"cloud-config"},
+		},
+		{
+			name:               "configmap transport",
+			vm:                 withConfigMapTransport(withCloudConfigSecret(newVM("vm-1"), "cloud-config")),
+			expectedConfigMaps: []string{"cloud-config"},
+		},
+		{
+			name: "configmap transport with a user password secret",
+			vm: func() *vmopv1.VirtualMachine {
+				vm := withConfigMapTransport(withCloudConfigSecret(newVM("vm-1"), "cloud-config"))
+				vm.Spec.Bootstrap.CloudInit.CloudConfig = &vmopv1cloudinit.CloudConfig{
+					Users: []vmopv1cloudinit.User{{Name: "admin", Passwd: &vmopv1common.SecretKeySelector{Name: "admin-passwd", Key: "passwd"}}},
+				}
+				return vm
+			}(),
+			expectedSecrets:    []string{"admin-passwd"},
+			expectedConfigMaps: []string{"cloud-config"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _ := newTestBackupAction(t, nil, tt.vm)
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+			assert.Equal(t, tt.expectedSecrets, namesOf(additionalItems, "secrets"))
+			assert.Equal(t, tt.expectedConfigMaps, namesOf(additionalItems, "configmaps"))
+		})
+	}
+}
+
+func TestExecuteFailOnMissingMember(t *testing.T) {
+	vmGroup := newVMGroup("group-1", "vm-1", "vm-x", "vm-y")
+
+	t.Run("warnings", func(t *testing.T) {
+		action, hook := newTestBackupAction(t, map[string]string{failOnMissingMemberConfigKey: "false"}, newVM("vm-1"))
+
+		additionalItems := executeBackup(t, action, vmGroup)
+		assert.Equal(t, []string{"vm-1"}, namesOf(additionalItems, "virtualmachines"))
+		require.Len(t, warnings(hook), 2)
+		assert.Contains(t, warnings(hook)[0], "vm-ns/vm-x")
+		assert.Contains(t, warnings(hook)[1], "vm-ns/vm-y")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		action, hook := newTestBackupAction(t, map[string]string{failOnMissingMemberConfigKey: "true"}, newVM("vm-1"))
+
+		_, additionalItems, err := action.Execute(toUnstructured(t, vmGroup), &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+		require.Error(t, err)
+		assert.Nil(t, additionalItems)
+		assert.Contains(t, err.Error(), "failed to resolve 2 members of VirtualMachineGroup vm-ns/group-1")
+		assert.Contains(t, err.Error(), "vm-ns/vm-x")
+		assert.Contains(t, err.Error(), "vm-ns/vm-y")
+		assert.Empty(t, warnings(hook))
+	})
+}
+
+func TestExecuteExpandsGroupOncePerBackup(t *testing.T) {
+	newBackup := func(uid types.UID) *velerov1.Backup {
+		return &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1", UID: uid}}
+	}
+	vmGroup := newVMGroup("group-1", "vm-1")
+
+	t.Run("same backup", func(t *testing.T) {
+		counter := &requestCounter{}
+		action, hook := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, counter.funcs(), newVM("vm-1")))
+
+		// The group is triggered directly and as the group of its VM
+		_, additionalItems, err := action.Execute(toUnstructured(t, vmGroup), newBackup("backup-uid-1"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"vm-1"}, namesOf(additionalItems, "virtualmachines"))
+		expansions := counter.vmGets.Load() + counter.vmLists.Load()
+
+		_, additionalItems, err = action.Execute(toUnstructured(t, vmGroup), newBackup("backup-uid-1"))
+		require.NoError(t, err)
+		assert.Empty(t, additionalItems)
+		assert.Equal(t, expansions, counter.vmGets.Load()+counter.vmLists.Load())
+		entryWithMessage(t, hook, "VirtualMachineGroup was already expanded in this backup - skipping its members")
+	})
+
+	t.Run("another backup", func(t *testing.T) {
+		action, _ := newTestBackupAction(t, nil, newVM("vm-1"))
+
+		for _, uid := range []types.UID{"backup-uid-1", "backup-uid-2"} {
+			_, additionalItems, err := action.Execute(toUnstructured(t, vmGroup), newBackup(uid))
+			require.NoError(t, err)
+			assert.Equal(t, []string{"vm-1"}, namesOf(additionalItems, "virtualmachines"))
+		}
+	})
+
+	t.Run("failed expansion is retried", func(t *testing.T) {
+		action, _ := newTestBackupAction(t, map[string]string{failOnMissingMemberConfigKey: "true"})
+
+		for range 2 {
+			_, _, err := action.Execute(toUnstructured(t, vmGroup), newBackup("backup-uid-1"))
+			assert.ErrorContains(t, err, "failed to resolve 1 members of VirtualMachineGroup vm-ns/group-1")
+		}
+	})
+}
+
+func TestExecuteVerifySecrets(t *testing.T) {
+	var secretLists, secretGets atomic.Int32
+	funcs := interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, isSecret := obj.(*corev1.Secret); isSecret || obj.GetObjectKind().GroupVersionKind().Kind == "Secret" {
+				secretGets.Add(1)
+			}
+			return cl.Get(ctx, key, obj, opts...)
+		},
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if list.GetObjectKind().GroupVersionKind().Kind == "SecretList" {
+				secretLists.Add(1)
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	}
+	// Every member has its own copy of the bootstrap secret template, and one of them is missing
+	c := newInterceptedFakeClient(t, funcs,
+		withCloudConfigSecret(newVM("vm-1"), "vm-1-cloud-config"),
+		withCloudConfigSecret(newVM("vm-2"), "vm-2-cloud-config"),
+		withCloudConfigSecret(newVM("vm-3"), "vm-3-cloud-config"),
+		withCloudConfigSecret(newVM("vm-4"), "vm-1-cloud-config"),
+		newSecret("vm-1-cloud-config"),
+		newSecret("vm-2-cloud-config"),
+		newSecret("unrelated"),
+	)
+	action, hook := newTestBackupActionWithClient(t, map[string]string{verifySecretsConfigKey: "true"}, c)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-2", "vm-3", "vm-4"))
+
+	assert.Equal(t, []string{"vm-1-cloud-config", "vm-2-cloud-config", "vm-3-cloud-config"}, namesOf(additionalItems, "secrets"))
+	assert.Equal(t, int32(1), secretLists.Load())
+	assert.Zero(t, secretGets.Load())
+	assert.Equal(t, []string{"Secret vm-ns/vm-3-cloud-config does not exist - it will be missing from the backup"}, warnings(hook))
+}
+
+func TestExecuteVerifySecretsDisabled(t *testing.T) {
+	var secretLists atomic.Int32
+	funcs := interceptor.Funcs{
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if list.GetObjectKind().GroupVersionKind().Kind == "SecretList" {
+				secretLists.Add(1)
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		config map[string]string
+		vm     *vmopv1.VirtualMachine
+	}{
+		{name: "not configured", vm: withCloudConfigSecret(newVM("vm-1"), "missing")},
+		{name: "no secrets", config: map[string]string{verifySecretsConfigKey: "true"}, vm: newVM("vm-1")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			action, hook := newTestBackupActionWithClient(t, tt.config, newInterceptedFakeClient(t, funcs, tt.vm))
+
+			executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+			assert.Zero(t, secretLists.Load())
+			assert.Empty(t, warnings(hook))
+		})
+	}
+}
+
+func TestExecuteVerifySecretsListError(t *testing.T) {
+	funcs := interceptor.Funcs{
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if list.GetObjectKind().GroupVersionKind().Kind == "SecretList" {
+				return apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("no access"))
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	}
+	c := newInterceptedFakeClient(t, funcs, withCloudConfigSecret(newVM("vm-1"), "cloud-config"))
+	action, hook := newTestBackupActionWithClient(t, map[string]string{verifySecretsConfigKey: "true"}, c)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+	assert.Equal(t, []string{"cloud-config"}, namesOf(additionalItems, "secrets"))
+	require.Len(t, warnings(hook), 1)
+	assert.Contains(t, warnings(hook)[0], "VirtualMachineGroup vm-ns/group-1: failed to list secrets")
+	assert.Contains(t, warnings(hook)[0], "its bootstrap secrets were not verified")
+}
+
+// withGroupName sets the spec.groupName of a VM
+func withGroupName(vm *vmopv1.VirtualMachine, groupName string) *vmopv1.VirtualMachine {
+	vm.Spec.GroupName = groupName
+	return vm
+}
+
+func TestExecuteMembersByGroupName(t *testing.T) {
+	nestedGroup := newVMGroup("nested-1")
+	nestedGroup.Spec.GroupName = "group-1"
+
+	action, _ := newTestBackupAction(t, nil,
+		withGroupName(withCloudConfigSecret(newVM("vm-1"), "vm-1-cloud-config"), "group-1"),
+		withGroupName(newVM("vm-2"), "group-1"),
+		withGroupName(withCloudConfigSecret(newVM("vm-3"), "vm-3-cloud-config"), "nested-1"),
+		withGroupName(withCloudConfigSecret(newVM("vm-other"), "vm-other-cloud-config"), "group-2"),
+		newVM("vm-ungrouped"),
+		nestedGroup,
+	)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1"))
+	assert.ElementsMatch(t, []string{"vm-1", "vm-2", "vm-3"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, []string{"nested-1"}, namesOf(additionalItems, "virtualmachinegroups"))
+	assert.ElementsMatch(t, []string{"vm-1-cloud-config", "vm-3-cloud-config"}, namesOf(additionalItems, "secrets"))
+}
+
+// TestExecuteLargeGroupByGroupName covers that the VirtualMachines listed to find the members of
+// a large group by their spec.groupName serve the members, without listing them again
+func TestExecuteLargeGroupByGroupName(t *testing.T) {
+	objs, names := newVMs(memberListThreshold)
+	for _, obj := range objs {
+		withGroupName(obj.(*vmopv1.VirtualMachine), "group-1")
+	}
+	counter := &requestCounter{}
+	action, _ := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, counter.funcs(), objs...))
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1"))
+
+	assert.Equal(t, names, namesOf(additionalItems, "virtualmachines"))
+	assert.Len(t, namesOf(additionalItems, "secrets"), memberListThreshold)
+	assert.Equal(t, int32(1), counter.vmLists.Load())
+	assert.Equal(t, int32(0), counter.vmGets.Load())
+}
+
+// withResourcePolicy sets the VirtualMachineSetResourcePolicy of a VM
+func withResourcePolicy(vm *vmopv1.VirtualMachine, policyName string) *vmopv1.VirtualMachine {
+	vm.Spec.Reserved = &vmopv1.VirtualMachineReservedSpec{ResourcePolicyName: policyName}
+	return vm
+}
+
+func TestExecuteExtractsResourcePolicies(t *testing.T) {
+	action, _ := newTestBackupAction(t, nil,
+		withResourcePolicy(newVM("vm-1"), "tkg-policy"),
+		withResourcePolicy(newVM("vm-2"), "tkg-policy"),
+		withResourcePolicy(newVM("vm-3"), "db-policy"),
+		withResourcePolicy(newVM("vm-4"), ""),
+		newVM("vm-5"),
+	)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-2", "vm-3", "vm-4", "vm-5"))
+	assert.Equal(t, []string{"tkg-policy", "db-policy"}, namesOf(additionalItems, "virtualmachinesetresourcepolicies"))
+	for _, item := range additionalItems {
+		if item.Resource == "virtualmachinesetresourcepolicies" {
+			assert.Equal(t, vmoperatorGroup, item.Group)
+			assert.Equal(t, testNamespace, item.Namespace)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		objs     []client.Object
+		vmGroup  *vmopv1.VirtualMachineGroup
+		expected []veleroplugin.ResourceIdentifier
+		warnings int
+	}{
+		{
+			name:    "group without members",
+			vmGroup: newVMGroup("group-1"),
+		},
+		{
+			name:    "members",
+			objs:    []client.Object{newVM("vm-1"), newVM("vm-2")},
+			vmGroup: newVMGroup("group-1", "vm-1", "vm-2"),
+			expected: []veleroplugin.ResourceIdentifier{
+				{GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachines"}, Namespace: testNamespace, Name: "vm-1"},
+				{GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachines"}, Namespace: testNamespace, Name: "vm-2"},
+			},
+		},
+		{
+			name:    "missing member",
+			objs:    []client.Object{newVM("vm-1")},
+			vmGroup: newVMGroup("group-1", "vm-1", "vm-x"),
+			expected: []veleroplugin.ResourceIdentifier{
+				{GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachines"}, Namespace: testNamespace, Name: "vm-1"},
+			},
+			warnings: 1,
+		},
+		{
+			name: "dependencies",
+			objs: []client.Object{
+				withResourcePolicy(withPVCVolumes(withClass(withCloudConfigSecret(newVM("vm-1"), "cloud-config"), "best-effort-small"), "data"), "tkg-policy"),
+				withStorageClass(newPVC("data"), "gold"),
+			},
+			vmGroup: newVMGroup("group-1", "vm-1"),
+			expected: []veleroplugin.ResourceIdentifier{
+				{GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachines"}, Namespace: testNamespace, Name: "vm-1"},
+				{GroupResource: schema.GroupResource{Resource: "secrets"}, Namespace: testNamespace, Name: "cloud-config"},
+				{GroupResource: schema.GroupResource{Resource: "persistentvolumeclaims"}, Namespace: testNamespace, Name: "data"},
+				{GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachineclasses"}, Namespace: testNamespace, Name: "best-effort-small"},
+				{GroupResource: schema.GroupResource{Group: "storage.k8s.io", Resource: "storageclasses"}, Name: "gold"},
+				{GroupResource: schema.GroupResource{Group: vmoperatorGroup, Resource: "virtualmachinesetresourcepolicies"}, Namespace: testNamespace, Name: "tkg-policy"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, hook := newTestBackupAction(t, nil, tt.objs...)
+
+			additionalItems := executeBackup(t, action, tt.vmGroup)
+			assert.ElementsMatch(t, tt.expected, additionalItems)
+
+			var memberWarnings int
+			for _, message := range warnings(hook) {
+				if strings.Contains(message, "its dependencies were not backed up") {
+					memberWarnings++
+				}
+			}
+			assert.Equal(t, tt.warnings, memberWarnings)
+		})
+	}
+}
+
+func TestResolveMemberUsesVMNamespace(t *testing.T) {
+	vm := withResourcePolicy(withPVCVolumes(withClass(withCloudConfigSecret(newVM("vm-1"), "cloud-config"), "best-effort-small"), "data"), "tkg-policy")
+	vm.Namespace = "other-ns"
+	vm.Spec.Image = &vmopv1.VirtualMachineImageRef{Kind: "ClusterVirtualMachineImage", Name: "vmi-ubuntu"}
+	pvc := withStorageClass(newPVC("data"), "gold")
+	pvc.Namespace = "other-ns"
+
+	action, _ := newTestBackupAction(t, nil, pvc)
+	opts := resolveOptions{backoff: wait.Backoff{Steps: 1}, getTimeout: defaultGetTimeout, log: action.log}
+
+	result := action.resolveMember(context.Background(), testNamespace, "vm-1", vm, opts)
+	require.NoError(t, result.err)
+
+	namespaces := make(map[string]string, len(result.items))
+	for _, item := range result.items {
+		namespaces[item.Resource] = item.Namespace
+	}
+	assert.Equal(t, map[string]string{
+		"virtualmachines":                   "other-ns",
+		"secrets":                           "other-ns",
+		"persistentvolumeclaims":            "other-ns",
+		"virtualmachineclasses":             "other-ns",
+		"virtualmachinesetresourcepolicies": "other-ns",
+		"clustervirtualmachineimages":       "",
+		"storageclasses":                    "",
+	}, namespaces)
+}
+
+func TestExecuteVerifyPVCs(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           map[string]string
+		expectedWarnings []string
+	}{
+		{
+			name:             "verified",
+			config:           map[string]string{verifyPVCsConfigKey: "true"},
+			expectedWarnings: []string{"PVC vm-ns/missing does not exist - it will be missing from the backup"},
+		},
+		{
+			name:             "not verified",
+			expectedWarnings: []string{"Failed to get PVC vm-ns/missing - its StorageClass was not backed up"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := withPVCVolumes(newVM("vm-1"), "data", "missing")
+			// The same claim mounted through a second volume
+			vm.Spec.Volumes = append(vm.Spec.Volumes, vmopv1.VirtualMachineVolume{
+				Name: "data-again",
+				VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+					PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{
+						PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+					},
+				},
+			})
+
+			var pvcGets atomic.Int32
+			c := newInterceptedFakeClient(t, interceptor.Funcs{
+				Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					if _, isPVC := obj.(*corev1.PersistentVolumeClaim); isPVC {
+						pvcGets.Add(1)
+					}
+					return cl.Get(ctx, key, obj, opts...)
+				},
+			}, vm, withStorageClass(newPVC("data"), "gold"))
+			action, hook := newTestBackupActionWithClient(t, tt.config, c)
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+			// Both claims are still backed up, and each is fetched once
+			assert.Equal(t, []string{"data", "missing"}, namesOf(additionalItems, "persistentvolumeclaims"))
+			assert.Equal(t, []string{"gold"}, namesOf(additionalItems, "storageclasses"))
+			assert.Equal(t, int32(2), pvcGets.Load())
+
+			require.Len(t, warnings(hook), len(tt.expectedWarnings))
+			for i, expected := range tt.expectedWarnings {
+				assert.Contains(t, warnings(hook)[i], expected)
+			}
+			if tt.config[verifyPVCsConfigKey] == "true" {
+				for _, entry := range hook.AllEntries() {
+					if entry.Level == logrus.WarnLevel {
+						assert.Equal(t, "vm-1", entry.Data["vm"])
+						assert.Equal(t, "missing", entry.Data["volume"])
+					}
+				}
+			}
+		})
+	}
+}
+
+// fakeAuthorizer answers SelfSubjectAccessReviews, denying the permissions in denied
+func fakeAuthorizer(denied ...string) interceptor.Funcs {
+	return interceptor.Funcs{
+		Create: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			review, isReview := obj.(*authorizationv1.SelfSubjectAccessReview)
+			if !isReview {
+				return cl.Create(ctx, obj, opts...)
+			}
+			attributes := review.Spec.ResourceAttributes
+			review.Status.Allowed = true
+			for _, permission := range denied {
+				if permission == attributes.Verb+" "+attributes.Resource {
+					review.Status.Allowed = false
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	t.Run("allowed", func(t *testing.T) {
+		action, hook := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, fakeAuthorizer()))
+		action.checkPermissions()
+		assert.Empty(t, warnings(hook))
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		action, hook := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, fakeAuthorizer("list virtualmachines", "get persistentvolumeclaims")))
+		action.checkPermissions()
+		require.Len(t, warnings(hook), 1)
+		assert.Contains(t, warnings(hook)[0], "list virtualmachines.vmoperator.vmware.com, get persistentvolumeclaims")
+	})
+
+	t.Run("optional features denied", func(t *testing.T) {
+		action, hook := newTestBackupActionWithClient(t, nil, newInterceptedFakeClient(t, fakeAuthorizer("list secrets", "list virtualmachineservices")))
+		action.checkPermissions()
+		require.Len(t, warnings(hook), 1)
+		assert.Contains(t, warnings(hook)[0], "list secrets, list virtualmachineservices.vmoperator.vmware.com")
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		var deadlines atomic.Int32
+		c := newInterceptedFakeClient(t, interceptor.Funcs{
+			Create: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+				if _, hasDeadline := ctx.Deadline(); hasDeadline {
+					deadlines.Add(1)
+				}
+				return ctx.Err()
+			},
+		})
+		action, _ := newTestBackupActionWithClient(t, nil, c)
+		action.checkPermissions()
+		assert.Equal(t, int32(len(requiredPermissions)), deadlines.Load())
+	})
+}
+
+func TestExecuteExcludeDependencyKinds(t *testing.T) {
+	vm := withPVCVolumes(withClass(withCloudConfigSecret(newVM("vm-1"), "cloud-config"), "best-effort-small"), "data")
+	objs := []client.Object{vm, withStorageClass(newPVC("data"), "vsan-gold")}
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		excluded []string
+		warnings int
+	}{
+		{name: "nothing excluded"},
+		{
+			name:     "secrets and storage classes",
+			config:   map[string]string{excludeDependencyKindsConfigKey: "secrets, StorageClasses"},
+			excluded: []string{"secrets", "storageclasses"},
+		},
+		{
+			name:     "unknown kind",
+			config:   map[string]string{excludeDependencyKindsConfigKey: "virtualmachineclasses,persistentvolumeclaims,widgets"},
+			excluded: []string{"virtualmachineclasses"},
+			warnings: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, hook := newTestBackupAction(t, tt.config, objs...)
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+			expected := map[string][]string{
+				"virtualmachines":        {"vm-1"},
+				"persistentvolumeclaims": {"data"},
+				"secrets":                {"cloud-config"},
+				"virtualmachineclasses":  {"best-effort-small"},
+				"storageclasses":         {"vsan-gold"},
+			}
+			for _, resource := range tt.excluded {
+				expected[resource] = nil
+			}
+			for resource, names := range expected {
+				assert.Equal(t, names, namesOf(additionalItems, resource), resource)
+			}
+			assert.Len(t, warnings(hook), tt.warnings)
+		})
+	}
+}
+
+func TestExecuteMaxAdditionalItems(t *testing.T) {
+	objs, names := newVMs(3)
+
+	t.Run("truncated", func(t *testing.T) {
+		action, hook := newTestBackupAction(t, map[string]string{maxAdditionalItemsConfigKey: "4"}, objs...)
+
+		additionalItems := executeBackup(t, action, newVMGroup("group-1", names...))
+
+		// Each VM brings its cloud-config secret, six items in total
+		assert.Len(t, additionalItems, 4)
+		require.Len(t, warnings(hook), 1)
+		assert.Contains(t, warnings(hook)[0], "has 6 additional items, more than the maximum of 4")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		action, _ := newTestBackupAction(t, map[string]string{maxAdditionalItemsConfigKey: "4", failOnMaxAdditionalItemsConfigKey: "true"}, objs...)
+
+		_, _, err := action.Execute(toUnstructured(t, newVMGroup("group-1", names...)), &velerov1.Backup{})
+		assert.ErrorContains(t, err, "has 6 additional items, more than the maximum of 4")
+	})
+
+	t.Run("within the maximum", func(t *testing.T) {
+		action, hook := newTestBackupAction(t, map[string]string{maxAdditionalItemsConfigKey: "6", failOnMaxAdditionalItemsConfigKey: "true"}, objs...)
+
+		assert.Len(t, executeBackup(t, action, newVMGroup("group-1", names...)), 6)
+		assert.Empty(t, warnings(hook))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		action, _ := newTestBackupAction(t, map[string]string{maxAdditionalItemsConfigKey: "0"}, objs...)
+
+		_, _, err := action.Execute(toUnstructured(t, newVMGroup("group-1", names...)), &velerov1.Backup{})
+		assert.ErrorContains(t, err, "invalid maxAdditionalItems config 0")
+	})
+}
+
+// blockingGets returns interceptor functions failing the VirtualMachine Lists, so every member is
+// fetched on its own, and blocking the VirtualMachine Gets until their context is done
+func blockingGets() interceptor.Funcs {
+	funcs := slowGets(func(string) time.Duration { return 0 })
+	funcs.Get = func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+		if _, isVM := obj.(*vmopv1.VirtualMachine); isVM {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return cl.Get(ctx, key, obj, opts...)
+	}
+	return funcs
+}
+
+func TestExecuteGetTimeout(t *testing.T) {
+	c := newInterceptedFakeClient(t, blockingGets(), newVM("vm-1"))
+	action, hook := newTestBackupActionWithClient(t, map[string]string{getTimeoutConfigKey: "20ms", getRetryAttemptsConfigKey: "1"}, c)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+	assert.Empty(t, additionalItems)
+	require.Len(t, warnings(hook), 1)
+	assert.Contains(t, warnings(hook)[0], "request timed out after 20ms, see the getTimeout config")
+}
+
+func TestMembersByGroupNameListDeadlines(t *testing.T) {
+	const getTimeout = 100 * time.Millisecond
+	var groupListTimeLeft time.Duration
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			switch list.(type) {
+			case *vmopv1.VirtualMachineList:
+				time.Sleep(getTimeout / 2)
+			case *vmopv1.VirtualMachineGroupList:
+				deadline, _ := ctx.Deadline()
+				groupListTimeLeft = time.Until(deadline)
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	})
+	action, _ := newTestBackupActionWithClient(t, nil, c)
+
+	_, err := action.membersByGroupName(context.Background(), newVMGroup("group-1"), map[string]*vmopv1.VirtualMachine{}, resolveOptions{getTimeout: getTimeout, log: action.log})
+	require.NoError(t, err)
+
+	// The slow VirtualMachine List does not use up the time of the group List
+	assert.Greater(t, groupListTimeLeft, getTimeout*3/4)
+}
+
+// entryWithMessage returns the last log entry with the given message
+func entryWithMessage(t *testing.T, hook *logrustest.Hook, message string) *logrus.Entry {
+	t.Helper()
+
+	var found *logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == message {
+			found = entry
+		}
+	}
+	require.NotNil(t, found, "no log entry %q", message)
+	return found
+}
+
+func TestExecuteLogFields(t *testing.T) {
+	action, hook := newTestBackupAction(t, nil, withClass(newVM("vm-1"), "best-effort-small"))
+
+	executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+	assert.Equal(t, logrus.Fields{
+		"action":    VMGroupBackupPluginName,
+		"backup":    "backup-1",
+		"namespace": testNamespace,
+		"group":     "group-1",
+	}, entryWithMessage(t, hook, "Processing VirtualMachineGroup").Data)
+
+	// Member and dependency entries keep the fields of the group's entries to correlate them
+	assert.Equal(t, logrus.Fields{
+		"action":    VMGroupBackupPluginName,
+		"backup":    "backup-1",
+		"namespace": testNamespace,
+		"group":     "group-1",
+		"vm":        "vm-1",
+	}, entryWithMessage(t, hook, "Adding VirtualMachine to backup").Data)
+	assert.Equal(t, logrus.Fields{
+		"action":    VMGroupBackupPluginName,
+		"backup":    "backup-1",
+		"namespace": testNamespace,
+		"group":     "group-1",
+		"vm":        "vm-1",
+		"class":     "best-effort-small",
+	}, entryWithMessage(t, hook, "Adding VirtualMachineClass").Data)
+}
+
+func TestExtractPVCsFromVMDeduplicatesClaims(t *testing.T) {
+	vm := withPVCVolumes(newVM("vm-1"), "data", "logs")
+	vm.Spec.Volumes = append(vm.Spec.Volumes, vmopv1.VirtualMachineVolume{
+		Name: "data-again",
+		VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+			PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{
+				PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+			},
+		},
+	})
+	action, hook := newTestBackupAction(t, nil, vm)
+
+	opts := resolveOptions{getTimeout: defaultGetTimeout, log: action.log}
+	deps := NewDependencyCollector()
+	action.extractPVCsFromVM(vm, nil, opts, deps, opts.vmLog(vm))
+
+	assert.Equal(t, []string{"data", "logs"}, namesOf(deps.Items(), "persistentvolumeclaims"))
+	assert.Equal(t, logrus.Fields{"namespace": testNamespace, "vm": "vm-1", "volume": "data-again", "pvc": "data"},
+		entryWithMessage(t, hook, "PVC was already added for another volume - skipping").Data)
+}
+
+func TestExecuteExtractsVolumeSnapshots(t *testing.T) {
+	snapshotGroup := volumeSnapshotGroup
+	otherNamespace := "snapshots"
+
+	fromSnapshotRef := newPVC("from-snapshot-ref")
+	fromSnapshotRef.Spec.DataSourceRef = &corev1.TypedObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"}
+	fromSnapshot := newPVC("from-snapshot")
+	fromSnapshot.Spec.DataSource = &corev1.TypedLocalObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-2"}
+	crossNamespace := newPVC("cross-namespace")
+	crossNamespace.Spec.DataSourceRef = &corev1.TypedObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-3", Namespace: &otherNamespace}
+	sameSnapshot := newPVC("same-snapshot")
+	sameSnapshot.Spec.DataSourceRef = &corev1.TypedObjectReference{APIGroup: &snapshotGroup, Kind: "VolumeSnapshot", Name: "snapshot-1"}
+	clone := newPVC("clone")
+	clone.Spec.DataSourceRef = &corev1.TypedObjectReference{Kind: "PersistentVolumeClaim", Name: "from-snapshot"}
+
+	vm := withPVCVolumes(newVM("vm-1"), "from-snapshot-ref", "from-snapshot", "cross-namespace", "same-snapshot", "clone", "missing")
+	action, _ := newTestBackupAction(t, nil, vm, fromSnapshotRef, fromSnapshot, crossNamespace, sameSnapshot, clone)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+	var snapshots []veleroplugin.ResourceIdentifier
+	for _, item := range additionalItems {
+		if item.Resource == "volumesnapshots" {
+			snapshots = append(snapshots, item)
+		}
+	}
+	snapshot := func(namespace, name string) veleroplugin.ResourceIdentifier {
+		return veleroplugin.ResourceIdentifier{GroupResource: schema.GroupResource{Group: "snapshot.storage.k8s.io", Resource: "volumesnapshots"}, Namespace: namespace, Name: name}
+	}
+	assert.Equal(t, []veleroplugin.ResourceIdentifier{
+		snapshot(testNamespace, "snapshot-1"),
+		snapshot(testNamespace, "snapshot-2"),
+		snapshot(otherNamespace, "snapshot-3"),
+	}, snapshots)
+}
+
+func TestExecuteExtractsEncryptionClasses(t *testing.T) {
+	encrypted := func(name, encryptionClassName string) *vmopv1.VirtualMachine {
+		vm := newVM(name)
+		vm.Spec.Crypto = &vmopv1.VirtualMachineCryptoSpec{EncryptionClassName: encryptionClassName}
+		return vm
+	}
+
+	action, _ := newTestBackupAction(t, nil,
+		encrypted("vm-1", "tenant-key"),
+		encrypted("vm-2", "tenant-key"),
+		// Encrypted with the default key provider
+		encrypted("vm-3", ""),
+		newVM("vm-4"),
+	)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1", "vm-2", "vm-3", "vm-4"))
+
+	assert.Equal(t, []string{"vm-1", "vm-2", "vm-3", "vm-4"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Equal(t, []string{"tenant-key"}, namesOf(additionalItems, "encryptionclasses"))
+	for _, item := range additionalItems {
+		if item.Resource == "encryptionclasses" {
+			assert.Equal(t, "encryption.vmware.com", item.Group)
+			assert.Equal(t, testNamespace, item.Namespace)
+		}
+	}
+}
+
+// newVMService returns a VirtualMachineService in the test namespace selecting VMs by selector
+func newVMService(name string, selector map[string]string) *vmopv1.VirtualMachineService {
+	return &vmopv1.VirtualMachineService{
+		TypeMeta:   metav1.TypeMeta{APIVersion: vmopv1.GroupVersion.String(), Kind: "VirtualMachineService"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name},
+		Spec: vmopv1.VirtualMachineServiceSpec{
+			Type:     vmopv1.VirtualMachineServiceTypeLoadBalancer,
+			Selector: selector,
+		},
+	}
+}
+
+func TestExecuteExtractsServices(t *testing.T) {
+	labeled := func(name, app string) *vmopv1.VirtualMachine {
+		vm := newVM(name)
+		vm.Labels = map[string]string{"app": app, "tier": "web"}
+		return vm
+	}
+	objs := []client.Object{
+		labeled("vm-1", "shop"),
+		labeled("vm-2", "shop"),
+		labeled("vm-3", "blog"),
+		newVMService("shop-lb", map[string]string{"app": "shop"}),
+		newVMService("web-lb", map[string]string{"tier": "web"}),
+		newVMService("db-lb", map[string]string{"app": "db"}),
+		newVMService("no-selector", nil),
+	}
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		vmNames  []string
+		expected []string
+	}{
+		{name: "disabled by default", vmNames: []string{"vm-1", "vm-2"}},
+		{name: "matching", config: map[string]string{backupServicesConfigKey: "true"}, vmNames: []string{"vm-1", "vm-2"}, expected: []string{"shop-lb", "web-lb"}},
+		{name: "partially matching", config: map[string]string{backupServicesConfigKey: "true"}, vmNames: []string{"vm-3"}, expected: []string{"web-lb"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _ := newTestBackupAction(t, tt.config, objs...)
+
+			additionalItems := executeBackup(t, action, newVMGroup("group-1", tt.vmNames...))
+
+			assert.Equal(t, tt.expected, namesOf(additionalItems, "virtualmachineservices"))
+			for _, item := range additionalItems {
+				if item.Resource == "virtualmachineservices" {
+					assert.Equal(t, "vmoperator.vmware.com", item.Group)
+					assert.Equal(t, testNamespace, item.Namespace)
+				}
+			}
+		})
+	}
+}
+
+func TestExecuteNoMatchingServices(t *testing.T) {
+	vm := newVM("vm-1")
+	vm.Labels = map[string]string{"app": "shop"}
+	action, hook := newTestBackupAction(t, map[string]string{backupServicesConfigKey: "true"},
+		vm,
+		newVMService("db-lb", map[string]string{"app": "db"}),
+	)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+	assert.Equal(t, []string{"vm-1"}, namesOf(additionalItems, "virtualmachines"))
+	assert.Empty(t, namesOf(additionalItems, "virtualmachineservices"))
+	entryWithMessage(t, hook, "None of the 1 VirtualMachineServices selects a member VirtualMachine")
+}
+
+func TestExecuteListServicesError(t *testing.T) {
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if _, ok := list.(*vmopv1.VirtualMachineServiceList); ok {
+				return apierrors.NewForbidden(schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "virtualmachineservices"}, "", errors.New("denied"))
+			}
+			return c.List(ctx, list, opts...)
+		},
+	}, newVM("vm-1"))
+	action, hook := newTestBackupActionWithClient(t, map[string]string{backupServicesConfigKey: "true"}, c)
+
+	additionalItems := executeBackup(t, action, newVMGroup("group-1", "vm-1"))
+
+	// The members are still backed up and the failure is reported as a backup warning
+	assert.Equal(t, []string{"vm-1"}, namesOf(additionalItems, "virtualmachines"))
+	var warned bool
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "failed to list VirtualMachineServices") {
+			warned = true
+		}
+	}
+	assert.True(t, warned, "the list failure should be logged as a warning")
+}
+
+func TestExecuteInvalidBackupServices(t *testing.T) {
+	action, _ := newTestBackupAction(t, map[string]string{backupServicesConfigKey: "sometimes"}, newVM("vm-1"))
+
+	_, _, err := action.Execute(toUnstructured(t, newVMGroup("group-1", "vm-1")), &velerov1.Backup{ObjectMeta: metav1.ObjectMeta{Namespace: "velero", Name: "backup-1"}})
+	assert.ErrorContains(t, err, "invalid backupServices config")
+}
+
+func TestExecuteExtraBackupAnnotation(t *testing.T) {
+	tests := []struct {
+		name       string
+		annotation string
+		expected   []veleroplugin.ResourceIdentifier
+		warnings   []string
+	}{
+		{
+			name:       "valid",
+			annotation: "configmaps/my-cm, secrets/my-secret,deployments.apps/web,configmaps/my-cm",
+			expected: []veleroplugin.ResourceIdentifier{
+				{GroupResource: schema.GroupResource{Resource: "configmaps"}, Namespace: testNamespace, Name: "my-cm"},
+				{GroupResource: schema.GroupResource{Resource: "secrets"}, Namespace: testNamespace, Name: "my-secret"},
+				{GroupResource: schema.GroupResource{Group: "apps", Resource: "deployments"}, Namespace: testNamespace, Name: "web"},
+			},
+		},
+		{
+			name:       "malformed entries are ignored",
+			annotation: "configmaps/my-cm,my-secret,secrets/,/my-secret,ConfigMap/other,configmaps/a/b",
+			expected: []veleroplugin.ResourceIdentifier{
+				{GroupResource: schema.GroupResource{Resource: "configmaps"}, Namespace: testNamespace, Name: "my-cm"},
+			},
+			warnings: []string{"my-secret", "secrets/", "/my-secret", "ConfigMap/other", "configmaps/a/b"},
+		},
+		{name: "empty", annotation: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, hook := newTestBackupAction(t, nil, newVM("vm-1"))
+			vmGroup := newVMGroup("group-1", "vm-1")
+			vmGroup.Annotations = map[string]string{extraBackupAnnotation: tt.annotation}
+
+			additionalItems := executeBackup(t, action, vmGroup)
+
+			var extraItems []veleroplugin.ResourceIdentifier
+			for _, item := range additionalItems {
+				if item.Resource != "virtualmachines" {
+					extraItems = append(extraItems, item)
+				}
+			}
+			assert.Equal(t, tt.expected, extraItems)
+
+			var warnings []string
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					warnings = append(warnings, entry.Message)
+				}
+			}
+			require.Len(t, warnings, len(tt.warnings))
+			for i, entry := range tt.warnings {
+				assert.Contains(t, warnings[i], fmt.Sprintf("ignoring malformed lubronzhan.io/extra-backup entry %q", entry))
+			}
+		})
+	}
+}
+
+func TestExecuteExtraBackupAnnotationWithoutMembers(t *testing.T) {
+	vmGroup := newVMGroup("group-1")
+	vmGroup.Annotations = map[string]string{extraBackupAnnotation: "configmaps/my-cm"}
+
+	for _, config := range []map[string]string{nil, {dryRunConfigKey: "true"}} {
+		action, _ := newTestBackupAction(t, config)
+
+		additionalItems := executeBackup(t, action, vmGroup)
+
+		assert.Equal(t, []string{"my-cm"}, namesOf(additionalItems, "configmaps"))
+	}
+}
+
+// TestExecuteExtraBackupOfExcludedKind covers that excludeDependencyKinds only applies to the
+// discovered dependencies, not to the resources requested in the extra-backup annotation
+func TestExecuteExtraBackupOfExcludedKind(t *testing.T) {
+	config := map[string]string{excludeDependencyKindsConfigKey: "secrets"}
+
+	t.Run("with members", func(t *testing.T) {
+		action, hook := newTestBackupAction(t, config, withCloudConfigSecret(newVM("vm-1"), "cloud-config"))
+		vmGroup := newVMGroup("group-1", "vm-1")
+		vmGroup.Annotations = map[string]string{extraBackupAnnotation: "secrets/my-secret"}
+
+		additionalItems := executeBackup(t, action, vmGroup)
+
+		assert.Equal(t, []string{"my-secret"}, namesOf(additionalItems, "secrets"))
+		entry := entryWithMessage(t, hook, "Backing up extra resource from lubronzhan.io/extra-backup although excludeDependencyKinds excludes secrets")
+		assert.Equal(t, logrus.InfoLevel, entry.Level)
+		assert.Empty(t, warnings(hook))
+	})
+
+	t.Run("without members", func(t *testing.T) {
+		action, _ := newTestBackupAction(t, config)
+		vmGroup := newVMGroup("group-1")
+		vmGroup.Annotations = map[string]string{extraBackupAnnotation: "secrets/my-secret"}
+
+		additionalItems := executeBackup(t, action, vmGroup)
+
+		assert.Equal(t, []string{"my-secret"}, namesOf(additionalItems, "secrets"))
+	})
+}
+
+func TestExecuteGroupWithoutNamespace(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        map[string]string
+		expectedVMs   []string
+		expectedLevel logrus.Level
+		expectedMsg   string
+	}{
+		{
+			name:          "skipped",
+			expectedLevel: logrus.WarnLevel,
+			expectedMsg:   "VirtualMachineGroup group-1 has no namespace and defaultNamespace is not configured - skipping its members",
+		},
+		{
+			name:          "default namespace",
+			config:        map[string]string{defaultNamespaceConfigKey: testNamespace},
+			expectedVMs:   []string{"vm-1"},
+			expectedLevel: logrus.ErrorLevel,
+			expectedMsg:   "VirtualMachineGroup group-1 has no namespace - looking up its members in the defaultNamespace vm-ns",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, hook := newTestBackupAction(t, tt.config, newVM("vm-1"))
+			vmGroup := newVMGroup("group-1", "vm-1")
+			vmGroup.Namespace = ""
+
+			additionalItems := executeBackup(t, action, vmGroup)
+
+			assert.Equal(t, tt.expectedVMs, namesOf(additionalItems, "virtualmachines"))
+			for _, item := range additionalItems {
+				assert.Equal(t, testNamespace, item.Namespace)
+			}
+			assert.Equal(t, tt.expectedLevel, entryWithMessage(t, hook, tt.expectedMsg).Level)
+		})
+	}
+}
@@ -19,41 +19,176 @@ limitations under the License.
 package plugin
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	velerov1 "github.com/vmware-tanzu/velero/pkg/apis/velero/v1"
 	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+	riav2 "github.com/vmware-tanzu/velero/pkg/plugin/velero/restoreitemaction/v2"
+)
+
+// preserveInstanceUUIDConfigKey is the plugin config key that keeps spec.instanceUUID
+// on restored VMs when set to "true"
+const preserveInstanceUUIDConfigKey = "preserveInstanceUUID"
+
+// dnsServersConfigKey and searchDomainsConfigKey are the plugin config keys holding comma-separated
+// nameservers and search domains replacing those of the source cluster in injected network config,
+// e.g. when restoring to another site. An empty value clears them.
+const (
+	dnsServersConfigKey    = "dnsServers"
+	searchDomainsConfigKey = "searchDomains"
+)
+
+// statusNetworkConfigPathsConfigKey is the plugin config key holding comma-separated dotted paths,
+// e.g. status.networkConfig, tried in order after status.network.config when the network config of
+// a VM is not found there
+const statusNetworkConfigPathsConfigKey = "statusNetworkConfigPaths"
+
+// skipNetworkInjectionAnnotation opts a VM out of network config injection when set to "true",
+// so the restored VM gets a fresh address instead of the preserved one
+const skipNetworkInjectionAnnotation = "lubronzhan.io/skip-network-injection"
+
+// preservedIPAnnotation records the primary IPs of a restored VM whose network config was injected,
+// e.g. "192.168.1.10" or "192.168.1.10,fd00::10" for dual-stack VMs
+const preservedIPAnnotation = "lubronzhan.io/preserved-ip"
+
+// waitForGroupTimeoutConfigKey is the plugin config key holding how long Velero waits
+// for the VirtualMachineGroup of a VM to be ready, e.g. "10m"
+const waitForGroupTimeoutConfigKey = "waitForGroupTimeout"
+
+// vmClassMappingConfigKey is the plugin config key holding a comma-separated list
+// of "old:new" VirtualMachineClass names used to rewrite spec.className
+const vmClassMappingConfigKey = "vmClassMapping"
+
+// vmImageMappingConfigKey is the plugin config key holding a comma-separated list
+// of "old:new" image names used to rewrite spec.image.name and spec.imageName
+const vmImageMappingConfigKey = "vmImageMapping"
+
+// maxHardwareVersionConfigKey is the plugin config key holding the highest hardware version the target
+// cluster supports, e.g. "19". A higher spec.minHardwareVersion of restored VMs is lowered to it.
+const maxHardwareVersionConfigKey = "maxHardwareVersion"
+
+// minSupportedHardwareVersion is the lowest spec.minHardwareVersion VM Operator accepts
+const minSupportedHardwareVersion = 13
+
+// defaultVMAnnotationsToRemove are removed from restored VMs when removeAnnotations is not configured
+var defaultVMAnnotationsToRemove = []string{vmopv1.FirstBootDoneAnnotation}
+
+// forceFirstBootConfigKey is the plugin config key that keeps the first-boot-done annotation on
+// restored VMs when set to "false", so they boot without running guest customization again
+const forceFirstBootConfigKey = "forceFirstBoot"
+
+// restorePowerStateConfigKey is the plugin config key setting spec.powerState of restored VMs
+// to "PoweredOff" or "PoweredOn". "Preserve", the default, keeps the backed up power state.
+const restorePowerStateConfigKey = "restorePowerState"
+
+// preservePowerState keeps the power state of the backed up VM
+const preservePowerState = "Preserve"
+
+// clearStatusConfigKey is the plugin config key that empties the status of restored VMs
+// unless set to "false"
+const clearStatusConfigKey = "clearStatus"
+
+// secretMappingConfigKey is the plugin config key holding a comma-separated list
+// of "old:new" secret names used to rewrite the bootstrap secret references
+const secretMappingConfigKey = "secretMapping"
+
+// bootstrapSecretNameFields are the fields of spec.bootstrap holding a single secret name
+var bootstrapSecretNameFields = [][]string{
+	{"cloudInit", "rawCloudConfig", "name"},
+	{"linuxPrep", "password", "name"},
+	{"linuxPrep", "scriptText", "from", "name"},
+	{"sysprep", "rawSysprep", "name"},
+	{"sysprep", "sysprep", "guiUnattended", "password", "name"},
+	{"sysprep", "sysprep", "identification", "domainAdminPassword", "name"},
+	{"sysprep", "sysprep", "userData", "productID", "name"},
+	{"sysprep", "sysprep", "scriptText", "from", "name"},
+	{"vAppConfig", "rawProperties"},
+}
+
+// groupNameMappingConfigKey is the plugin config key holding a comma-separated list of "old:new"
+// VirtualMachineGroup names, and groupNameSuffixConfigKey the key holding a suffix appended to the
+// names without a mapping, e.g. "-staging". They rename the restored groups and the spec.groupName
+// of their VMs, so a test restore does not join the groups of the production reconcilers.
+const (
+	groupNameMappingConfigKey = "groupNameMapping"
+	groupNameSuffixConfigKey  = "groupNameSuffix"
 )
 
+// defaultWaitForGroupTimeout is used when waitForGroupTimeout is not set or invalid
+const defaultWaitForGroupTimeout = 10 * time.Minute
+
 // VMRestoreItemAction is a restore item action plugin for VirtualMachine
 type VMRestoreItemAction struct {
-	log logrus.FieldLogger
+	log             logrus.FieldLogger
+	client          client.Client
+	configMapClient corev1client.ConfigMapInterface
+	transformers    []VMRestoreTransformer
 }
 
 // NewVMRestoreItemAction creates a new VMRestoreItemAction
-func NewVMRestoreItemAction(log logrus.FieldLogger) *VMRestoreItemAction {
+func NewVMRestoreItemAction(log logrus.FieldLogger, restConfig *rest.Config, configMapClient corev1client.ConfigMapInterface) (*VMRestoreItemAction, error) {
+	c, err := newClient(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewVMRestoreItemActionWithClient(log, c, configMapClient), nil
+}
+
+// NewVMRestoreItemActionWithClient creates a new VMRestoreItemAction using the given client,
+// e.g. a fake client from sigs.k8s.io/controller-runtime/pkg/client/fake
+// The client must know the VM Operator types.
+func NewVMRestoreItemActionWithClient(log logrus.FieldLogger, c client.Client, configMapClient corev1client.ConfigMapInterface) *VMRestoreItemAction {
 	return &VMRestoreItemAction{
-		log: log,
+		log:             log,
+		client:          c,
+		configMapClient: configMapClient,
+		transformers:    DefaultVMRestoreTransformers(),
 	}
 }
 
+// SetTransformers replaces the transformers run on each VM, in order
+// Use DefaultVMRestoreTransformers to keep the built-in mutations alongside custom ones.
+func (p *VMRestoreItemAction) SetTransformers(transformers ...VMRestoreTransformer) {
+	p.transformers = transformers
+}
+
+// Name returns the name of this plugin
+func (p *VMRestoreItemAction) Name() string {
+	return VMRestorePluginName
+}
+
 // AppliesTo returns the resources this plugin applies to
 func (p *VMRestoreItemAction) AppliesTo() (veleroplugin.ResourceSelector, error) {
 	return veleroplugin.ResourceSelector{
-		IncludedResources: []string{"virtualmachines.vmoperator.vmware.com"},
+		IncludedResources: []string{virtualMachinesResource},
 	}, nil
 }
 
 // Execute performs the restore action
 // This plugin:
-// 1. Removes cluster-specific fields that shouldn't be restored
-// 2. Injects network configuration from status to spec to preserve IP addresses
-// 3. Adds the VirtualMachineGroup as an additional item to restore first
+// 1. Runs the transformers - by default removing cluster-specific fields and injecting network configuration from status to spec
+// 2. Remaps the VM class, image, bootstrap secrets and instance volume storage classes according to the plugin config
+// 3. Renames the VM's VirtualMachineGroup and sets the power state according to the plugin config
+// 4. Clears the status of the source cluster's VM
+// 5. Adds the VirtualMachineGroup and the bootstrap secrets as additional items to restore first
 func (p *VMRestoreItemAction) Execute(input *veleroplugin.RestoreItemActionExecuteInput) (*veleroplugin.RestoreItemActionExecuteOutput, error) {
 	p.log.Infof("Executing VMRestoreItemAction for restore %s", input.Restore.Name)
 
@@ -64,107 +199,583 @@ func (p *VMRestoreItemAction) Execute(input *veleroplugin.RestoreItemActionExecu
 	namespace, _, _ := unstructured.NestedString(obj, "metadata", "namespace")
 	vmName, _, _ := unstructured.NestedString(obj, "metadata", "name")
 
-	p.log.Infof("Processing VirtualMachine %s/%s", namespace, vmName)
+	log := p.log.WithFields(logrus.Fields{
+		"action":    VMRestorePluginName,
+		"restore":   input.Restore.Name,
+		"namespace": namespace,
+		"vm":        vmName,
+	})
+	log.Info("Processing VirtualMachine")
+
+	config, err := getRestoreConfig(p.configMapClient, VMRestorePluginName, log)
+	if err != nil {
+		return nil, err
+	}
 
-	modified := false
+	// 1. Run the transformers - by default removing instanceUUID and the configured annotations,
+	// and injecting the network configuration from status to spec
+	transformerInput := &VMRestoreTransformerInput{RestoreInput: input, Config: config, Log: log}
+	for _, transformer := range p.transformers {
+		changed, err := transformer.Transform(obj, transformerInput)
+		if err != nil {
+			return nil, errors.Wrapf(err, "VM restore transformer %s failed", transformer.Name())
+		}
+		log.WithFields(logrus.Fields{"transformer": transformer.Name(), "changed": changed}).Debug("Ran VM restore transformer")
+	}
 
-	// 1. Remove instanceUUID - this is cluster-specific and will be regenerated
-	if instanceUUID, found, _ := unstructured.NestedString(obj, "spec", "instanceUUID"); found && instanceUUID != "" {
-		p.log.Infof("Removing instanceUUID from VM %s/%s", namespace, vmName)
-		unstructured.SetNestedField(obj, "", "spec", "instanceUUID")
-		modified = true
+	// 2. Remap the VM class to one that exists in the target cluster
+	if value, found := config[vmClassMappingConfigKey]; found {
+		vmClassMapping, err := parseMapping(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s config", vmClassMappingConfigKey)
+		}
+		if className, found, _ := unstructured.NestedString(obj, "spec", "className"); found && className != "" {
+			if newClassName, mapped := vmClassMapping[className]; mapped {
+				log.Infof("Changing VM class from %s to %s", className, newClassName)
+				unstructured.SetNestedField(obj, newClassName, "spec", "className")
+			}
+		}
 	}
 
-	// 2. Remove first-boot-done annotation - VM should go through first boot again
-	if annotations, found, _ := unstructured.NestedStringMap(obj, "metadata", "annotations"); found {
-		if _, exists := annotations["virtualmachine.vmoperator.vmware.com/first-boot-done"]; exists {
-			p.log.Infof("Removing first-boot-done annotation from VM %s/%s", namespace, vmName)
-			delete(annotations, "virtualmachine.vmoperator.vmware.com/first-boot-done")
-			unstructured.SetNestedStringMap(obj, annotations, "metadata", "annotations")
-			modified = true
+	// 3. Remap the image to one that exists in the target cluster, in both the
+	// structured spec.image reference and the legacy spec.imageName
+	if value, found := config[vmImageMappingConfigKey]; found {
+		vmImageMapping, err := parseMapping(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s config", vmImageMappingConfigKey)
+		}
+		for _, fields := range [][]string{{"spec", "image", "name"}, {"spec", "imageName"}} {
+			imageName, found, _ := unstructured.NestedString(obj, fields...)
+			if !found || imageName == "" {
+				continue
+			}
+			if newImageName, mapped := vmImageMapping[imageName]; mapped {
+				log.Infof("Changing %s from %s to %s", strings.Join(fields, "."), imageName, newImageName)
+				unstructured.SetNestedField(obj, newImageName, fields...)
+			}
 		}
 	}
 
-	// 3. Inject network configuration from status.network.config to spec.network
-	if p.injectNetworkConfigFromStatus(obj, namespace, vmName) {
-		modified = true
+	// 4. Rewrite the bootstrap secret references to secrets restored under a new name
+	if value, found := config[secretMappingConfigKey]; found {
+		secretMapping, err := parseMapping(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s config", secretMappingConfigKey)
+		}
+		p.remapBootstrapSecrets(obj, secretMapping, log)
 	}
 
-	// Use the modified object
-	var updatedItem runtime.Unstructured
-	if modified {
-		updatedItem = &unstructured.Unstructured{Object: obj}
-	} else {
-		updatedItem = input.Item
+	// 5. Remap the storage classes of instance volume claims the same way the PVC restore plugin
+	// remaps standalone PVCs
+	if hasInstanceVolumeClaims(obj) {
+		pvcRestoreConfig, err := getRestoreConfig(p.configMapClient, PVCRestorePluginName, log)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to get pvc-restore plugin config")
+		}
+		if value, found := pvcRestoreConfig[storageClassMappingConfigKey]; found {
+			storageClassMapping, err := parseMapping(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid %s config", storageClassMappingConfigKey)
+			}
+			remapInstanceVolumeStorageClasses(obj, storageClassMapping, log)
+		}
 	}
 
-	// Convert to typed object to get groupName
+	// Convert to typed object to get the groupName the group was backed up under
 	vm := &vmopv1.VirtualMachine{}
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj, vm); err != nil {
+	if err := fromUnstructured(obj, vm); err != nil {
 		return nil, errors.Wrap(err, "failed to convert item to VirtualMachine")
 	}
-
-	// Check if this VM belongs to a VirtualMachineGroup
 	vmGroupName := vm.Spec.GroupName
 
+	// 6. Join the renamed VirtualMachineGroup when groups are restored under a new name
+	if vmGroupName != "" {
+		newGroupName, err := restoredGroupName(vmGroupName, config)
+		if err != nil {
+			return nil, err
+		}
+		if newGroupName != vmGroupName {
+			log.Infof("Changing VirtualMachineGroup from %s to %s", vmGroupName, newGroupName)
+			unstructured.SetNestedField(obj, newGroupName, "spec", "groupName")
+		}
+	}
+
+	// 7. Override the power state, e.g. to validate powered off VMs before a cutover
+	restorePowerState := strings.TrimSpace(config[restorePowerStateConfigKey])
+	switch restorePowerState {
+	case "", preservePowerState:
+	case string(vmopv1.VirtualMachinePowerStateOff), string(vmopv1.VirtualMachinePowerStateOn):
+		if powerState, _, _ := unstructured.NestedString(obj, "spec", "powerState"); powerState != restorePowerState {
+			log.Infof("Changing power state from %s to %s", powerState, restorePowerState)
+			unstructured.SetNestedField(obj, restorePowerState, "spec", "powerState")
+		}
+	default:
+		return nil, errors.Errorf("invalid %s config %q, expected %s, %s or %s", restorePowerStateConfigKey, restorePowerState,
+			vmopv1.VirtualMachinePowerStateOff, vmopv1.VirtualMachinePowerStateOn, preservePowerState)
+	}
+
+	// 8. Empty the status of the source cluster's VM - instanceUUID, biosUUID and placement.
+	// This must happen after the network injection, which reads status.network.config.
+	clearStatus, err := getBool(config, clearStatusConfigKey, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := obj["status"]; found && clearStatus {
+		log.Info("Clearing status")
+		obj["status"] = map[string]interface{}{}
+	}
+
+	// 9. Remove the managed fields of the source cluster and label the VM as restored by the
+	// plugin for tracking and cleanup
+	updatedItem := &unstructured.Unstructured{Object: obj}
+	if err := clearManagedFields(updatedItem, config, log); err != nil {
+		return nil, err
+	}
+	if _, err := setRestoreLabel(updatedItem, config); err != nil {
+		return nil, err
+	}
+
+	// Always return the working object, so no change made to it above can be dropped
 	output := veleroplugin.NewRestoreItemActionExecuteOutput(updatedItem)
 
 	if vmGroupName != "" {
-		p.log.Infof("VirtualMachine %s/%s belongs to VirtualMachineGroup %s", namespace, vmName, vmGroupName)
+		log = log.WithField("group", vmGroupName)
+		log.Info("VirtualMachine belongs to VirtualMachineGroup")
 
 		// Add the VirtualMachineGroup as an additional item to restore
-		// Velero will restore it before this VM
-		output.AdditionalItems = []veleroplugin.ResourceIdentifier{
-			{
-				GroupResource: schema.GroupResource{
-					Group:    "vmoperator.vmware.com",
-					Resource: "virtualmachinegroups",
-				},
-				Namespace: namespace,
-				Name:      vmGroupName,
-			},
-		}
+		// Velero will restore it before this VM. The identifier must use the namespace and name of
+		// the backup, which Velero looks the item up in. The namespace is then remapped by the
+		// namespace mapping and the name by VMGroupRestoreItemAction with groupNameMapping/groupNameSuffix.
+		output.AdditionalItems = []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(namespace, vmGroupName)}
 
 		// Tell Velero to wait for the additional items to be ready
 		output.WaitForAdditionalItems = true
-		p.log.Infof("Will wait for VirtualMachineGroup %s/%s before restoring VM", namespace, vmGroupName)
+		output.AdditionalItemsReadyTimeout = waitForGroupTimeout(config, log)
+		log.Infof("Will wait up to %s for VirtualMachineGroup before restoring VM", output.AdditionalItemsReadyTimeout)
 	}
 
+	// Restore the bootstrap secrets with the VM, which is not restored through its group when the
+	// restore only includes the VM
+	output.AdditionalItems = append(output.AdditionalItems, bootstrapItemsFromBackup(input, namespace, log)...)
+
+	preservedIP, _, _ := unstructured.NestedString(obj, "metadata", "annotations", preservedIPAnnotation)
+	log.WithField("preservedIP", preservedIP).Info("VirtualMachine prepared for restore")
 	return output, nil
 }
 
-// injectNetworkConfigFromStatus copies network configuration from status.network.config to spec.network
-// This preserves the original IP address during restore
-func (p *VMRestoreItemAction) injectNetworkConfigFromStatus(obj map[string]interface{}, namespace, vmName string) bool {
-	// Check if spec.network already exists
-	if specNetwork, found, _ := unstructured.NestedMap(obj, "spec", "network"); found && specNetwork != nil {
-		p.log.Infof("VM %s/%s already has spec.network configuration - preserving as-is", namespace, vmName)
+// bootstrapItemsFromBackup returns the bootstrap secrets and ConfigMaps the backed up VM references,
+// as found by the backup plugin. The names are read from the backed up VM, as Velero looks the items
+// up under the names of the backup, before secretMapping rewrote the references.
+func bootstrapItemsFromBackup(input *veleroplugin.RestoreItemActionExecuteInput, namespace string, log logrus.FieldLogger) []veleroplugin.ResourceIdentifier {
+	if input.ItemFromBackup == nil {
+		return nil
+	}
+	vm := &vmopv1.VirtualMachine{}
+	if err := fromUnstructured(input.ItemFromBackup.UnstructuredContent(), vm); err != nil {
+		log.WithError(err).Warn("Failed to read the bootstrap secrets of the backed up VM - they are not restored with it")
+		return nil
+	}
+	vm.Namespace = namespace
+
+	deps := NewDependencyCollector()
+	extractSecretsFromVM(vm, deps, log)
+	extractConfigMapsFromVM(vm, deps, log)
+	return deps.Items()
+}
+
+// recoverAnnotations reads metadata.annotations as a raw map and converts values that are not
+// strings, e.g. numbers or booleans of a hand-edited object, to their string form
+func recoverAnnotations(obj map[string]interface{}) (map[string]string, bool, error) {
+	rawAnnotations, found, err := unstructured.NestedMap(obj, "metadata", "annotations")
+	if err != nil || !found {
+		return nil, found, errors.Wrap(err, "failed to read annotations")
+	}
+	annotations := make(map[string]string, len(rawAnnotations))
+	for key, value := range rawAnnotations {
+		switch v := value.(type) {
+		case string:
+			annotations[key] = v
+		case nil:
+			annotations[key] = ""
+		default:
+			annotations[key] = fmt.Sprint(v)
+		}
+	}
+	return annotations, true, nil
+}
+
+// hasInstanceVolumeClaims reports whether spec.volumes has an instance volume claim
+func hasInstanceVolumeClaims(obj map[string]interface{}) bool {
+	volumes, _, _ := unstructured.NestedSlice(obj, "spec", "volumes")
+	for _, volume := range volumes {
+		volumeMap, ok := volume.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, found, _ := unstructured.NestedMap(volumeMap, "persistentVolumeClaim", "instanceVolumeClaim"); found {
+			return true
+		}
+	}
+	return false
+}
+
+// remapInstanceVolumeStorageClasses rewrites the storage classes of the instance volume claims in
+// spec.volumes according to storageClassMapping and reports whether any changed
+func remapInstanceVolumeStorageClasses(obj map[string]interface{}, storageClassMapping map[string]string, log logrus.FieldLogger) bool {
+	volumes, found, _ := unstructured.NestedSlice(obj, "spec", "volumes")
+	if !found {
 		return false
 	}
 
-	// Get status.network.config
-	statusNetworkConfig, found, err := unstructured.NestedMap(obj, "status", "network", "config")
-	if !found || err != nil {
-		p.log.Warnf("VM %s/%s has no status.network.config - cannot inject network config", namespace, vmName)
+	changed := false
+	for _, volume := range volumes {
+		volumeMap, ok := volume.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		storageClass, found, _ := unstructured.NestedString(volumeMap, "persistentVolumeClaim", "instanceVolumeClaim", "storageClass")
+		if !found {
+			continue
+		}
+		if newStorageClass, mapped := storageClassMapping[storageClass]; mapped {
+			volumeName, _, _ := unstructured.NestedString(volumeMap, "name")
+			log.WithField("volume", volumeName).Infof("Changing instance volume storage class from %s to %s", storageClass, newStorageClass)
+			unstructured.SetNestedField(volumeMap, newStorageClass, "persistentVolumeClaim", "instanceVolumeClaim", "storageClass")
+			changed = true
+		}
+	}
+	if changed {
+		unstructured.SetNestedSlice(obj, volumes, "spec", "volumes")
+	}
+	return changed
+}
+
+// remapBootstrapSecrets rewrites the secret names referenced by spec.bootstrap according to secretMapping
+// It covers the CloudInit, LinuxPrep, Sysprep and vAppConfig references and reports whether any changed
+func (p *VMRestoreItemAction) remapBootstrapSecrets(obj map[string]interface{}, secretMapping map[string]string, log logrus.FieldLogger) bool {
+	bootstrap, found, _ := unstructured.NestedMap(obj, "spec", "bootstrap")
+	if !found {
 		return false
 	}
 
-	// Get primary IP for logging
-	primaryIP, _, _ := unstructured.NestedString(obj, "status", "network", "primaryIP4")
+	modified := false
+	remap := func(fields ...string) {
+		name, found, _ := unstructured.NestedString(bootstrap, fields...)
+		if !found || name == "" {
+			return
+		}
+		if newName, mapped := secretMapping[name]; mapped {
+			log.Infof("Changing bootstrap secret %s from %s to %s", strings.Join(fields, "."), name, newName)
+			unstructured.SetNestedField(bootstrap, newName, fields...)
+			modified = true
+		}
+	}
 
-	p.log.Infof("Injecting network configuration for VM %s/%s with IP %s", namespace, vmName, primaryIP)
+	for _, fields := range bootstrapSecretNameFields {
+		remap(fields...)
+	}
 
-	// Copy status.network.config to spec.network
-	// This preserves the exact network configuration including:
-	// - interfaces with IP addresses
-	// - DNS settings
+	// The user passwords of the inline cloud-config
+	if users, found, _ := unstructured.NestedSlice(bootstrap, "cloudInit", "cloudConfig", "users"); found {
+		for _, user := range users {
+			userMap, ok := user.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, field := range []string{"passwd", "hashed_passwd"} {
+				name, found, _ := unstructured.NestedString(userMap, field, "name")
+				if !found || name == "" {
+					continue
+				}
+				if newName, mapped := secretMapping[name]; mapped {
+					log.Infof("Changing bootstrap secret cloudInit.cloudConfig.users.%s from %s to %s", field, name, newName)
+					unstructured.SetNestedField(userMap, newName, field, "name")
+					modified = true
+				}
+			}
+		}
+		unstructured.SetNestedSlice(bootstrap, users, "cloudInit", "cloudConfig", "users")
+	}
+
+	// The write_files content sourced from secrets
+	if writeFiles, found, _ := unstructured.NestedSlice(bootstrap, "cloudInit", "cloudConfig", "write_files"); found {
+		for _, writeFile := range writeFiles {
+			writeFileMap, ok := writeFile.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, found, _ := unstructured.NestedString(writeFileMap, "content", "name")
+			if !found || name == "" {
+				continue
+			}
+			if newName, mapped := secretMapping[name]; mapped {
+				log.Infof("Changing bootstrap secret cloudInit.cloudConfig.write_files.content from %s to %s", name, newName)
+				unstructured.SetNestedField(writeFileMap, newName, "content", "name")
+				modified = true
+			}
+		}
+		unstructured.SetNestedSlice(bootstrap, writeFiles, "cloudInit", "cloudConfig", "write_files")
+	}
+
+	// The vAppConfig properties sourced from secrets
+	if properties, found, _ := unstructured.NestedSlice(bootstrap, "vAppConfig", "properties"); found {
+		for _, property := range properties {
+			propertyMap, ok := property.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, found, _ := unstructured.NestedString(propertyMap, "value", "from", "name")
+			if !found || name == "" {
+				continue
+			}
+			if newName, mapped := secretMapping[name]; mapped {
+				log.Infof("Changing bootstrap secret vAppConfig.properties.value.from from %s to %s", name, newName)
+				unstructured.SetNestedField(propertyMap, newName, "value", "from", "name")
+				modified = true
+			}
+		}
+		unstructured.SetNestedSlice(bootstrap, properties, "vAppConfig", "properties")
+	}
+
+	if modified {
+		unstructured.SetNestedMap(obj, bootstrap, "spec", "bootstrap")
+	}
+	return modified
+}
+
+// Progress is not supported as the plugin starts no asynchronous operations
+func (p *VMRestoreItemAction) Progress(operationID string, restore *velerov1.Restore) (veleroplugin.OperationProgress, error) {
+	return veleroplugin.OperationProgress{}, riav2.AsyncOperationsNotSupportedError()
+}
+
+// Cancel is not supported as the plugin starts no asynchronous operations
+func (p *VMRestoreItemAction) Cancel(operationID string, restore *velerov1.Restore) error {
+	return riav2.AsyncOperationsNotSupportedError()
+}
+
+// AreAdditionalItemsReady reports whether the restored VirtualMachineGroup of a VM has been reconciled
+func (p *VMRestoreItemAction) AreAdditionalItemsReady(additionalItems []veleroplugin.ResourceIdentifier, restore *velerov1.Restore) (bool, error) {
+	config, err := getRestoreConfig(p.configMapClient, VMRestorePluginName, p.log)
+	if err != nil {
+		return false, err
+	}
+
+	return areGroupsReady(context.Background(), p.client, p.log, additionalItems, restore, config)
+}
+
+// areGroupsReady reports whether the restored VirtualMachineGroups among additionalItems have been reconciled
+// A group counts as reconciled once VM Operator has evaluated its Ready condition for the current
+// generation. Ready may still be False then, as the member VMs are only restored afterwards.
+// A group that was not restored counts as ready, so its members are restored without it.
+// config is the vm-restore plugin config, which the group names are mapped with.
+// Each Get is bounded by defaultGetTimeout so a hung API server cannot stall the restore.
+func areGroupsReady(ctx context.Context, c client.Client, log logrus.FieldLogger, additionalItems []veleroplugin.ResourceIdentifier, restore *velerov1.Restore, config map[string]string) (bool, error) {
+	for _, item := range additionalItems {
+		if item.Group != vmoperatorGroup || item.Resource != "virtualmachinegroups" {
+			continue
+		}
+
+		// The additional items carry the namespace and name of the backup, the group lives in the
+		// restore's target namespace under its possibly renamed name
+		namespace := restoreNamespace(item.Namespace, restore)
+		name, err := restoredGroupName(item.Name, config)
+		if err != nil {
+			return false, err
+		}
+
+		vmGroup := &vmopv1.VirtualMachineGroup{}
+		getCtx, cancel := context.WithTimeout(ctx, defaultGetTimeout)
+		err = c.Get(getCtx, client.ObjectKey{Namespace: namespace, Name: name}, vmGroup)
+		cancel()
+		if err != nil {
+			// Velero restores the additional items before waiting for them, so a missing group was
+			// excluded from or failed in the restore and waiting for it would only run into the timeout
+			if apierrors.IsNotFound(err) {
+				log.WithFields(logrus.Fields{"namespace": namespace, "group": name}).Warn("VirtualMachineGroup was not restored - not waiting for it")
+				continue
+			}
+			return false, errors.Wrapf(err, "failed to get VirtualMachineGroup %s/%s", namespace, name)
+		}
+
+		readyCondition := meta.FindStatusCondition(vmGroup.Status.Conditions, vmopv1.ReadyConditionType)
+		if readyCondition == nil || readyCondition.Status == metav1.ConditionUnknown || readyCondition.ObservedGeneration < vmGroup.Generation {
+			log.WithFields(logrus.Fields{"namespace": namespace, "group": name}).Info("VirtualMachineGroup is not reconciled yet")
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// restoreNamespace returns the namespace a backed up namespace is restored into
+func restoreNamespace(namespace string, restore *velerov1.Restore) string {
+	if restore != nil {
+		if mapped, found := restore.Spec.NamespaceMapping[namespace]; found {
+			return mapped
+		}
+	}
+	return namespace
+}
+
+// restoredGroupName returns the name a VirtualMachineGroup is restored under according to
+// groupNameMapping, or with groupNameSuffix appended when the group has no mapping
+func restoredGroupName(name string, config map[string]string) (string, error) {
+	if value, found := config[groupNameMappingConfigKey]; found {
+		groupNameMapping, err := parseMapping(value)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid %s config", groupNameMappingConfigKey)
+		}
+		if newName, mapped := groupNameMapping[name]; mapped {
+			return newName, nil
+		}
+	}
+
+	suffix := strings.TrimSpace(config[groupNameSuffixConfigKey])
+	if suffix == "" {
+		return name, nil
+	}
+	newName := name + suffix
+	if errs := validation.IsDNS1123Subdomain(newName); len(errs) > 0 {
+		return "", errors.Errorf("invalid %s config %q for VirtualMachineGroup %s: %s", groupNameSuffixConfigKey, suffix, name, strings.Join(errs, ", "))
+	}
+	return newName, nil
+}
+
+// waitForGroupTimeout returns the configured wait timeout for the VirtualMachineGroup
+// An invalid duration is logged and replaced by the default rather than failing the restore
+func waitForGroupTimeout(config map[string]string, log logrus.FieldLogger) time.Duration {
+	value := strings.TrimSpace(config[waitForGroupTimeoutConfigKey])
+	if value == "" {
+		return defaultWaitForGroupTimeout
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		log.Warnf("Invalid %s config %q - using the default of %s", waitForGroupTimeoutConfigKey, value, defaultWaitForGroupTimeout)
+		return defaultWaitForGroupTimeout
+	}
+	return timeout
+}
+
+// injectNetworkConfigFromStatus copies network configuration of all interfaces from status.network.config to spec.network
+// This preserves the original IP address during restore. A spec.network without interfaces is
+// completed from status, keeping the fields it already sets.
+// The network config is read from the first of configPaths holding one, and the DNS settings are
+// replaced or cleared according to dnsOverrides.
+// It returns the primary IPs of the VM and whether its network config was injected.
+// RestoreItemActionExecuteOutput has no warnings, so a VM losing its IP can only be reported as a
+// warning in the restore log, not in velero restore describe.
+func injectNetworkConfigFromStatus(obj map[string]interface{}, configPaths []string, dnsOverrides map[string][]string, log logrus.FieldLogger) (string, bool) {
+	// Check if the VM opted out of injection to get a fresh address
+	if skip, found, _ := unstructured.NestedString(obj, "metadata", "annotations", skipNetworkInjectionAnnotation); found && strings.EqualFold(skip, "true") {
+		log.Infof("VM has annotation %s - skipping network config injection", skipNetworkInjectionAnnotation)
+		return "", false
+	}
+
+	// Only a spec.network with interfaces is complete, e.g. from an earlier attempt of the restore.
+	// An empty or null one counts as absent, and a partial one, e.g. with only DNS settings, is
+	// completed from status below.
+	specNetwork, _, _ := unstructured.NestedMap(obj, "spec", "network")
+	if specInterfaces, _, _ := unstructured.NestedSlice(specNetwork, "interfaces"); len(specInterfaces) > 0 {
+		log.Info("VM already has spec.network interfaces - preserving as-is")
+		return "", false
+	}
+	if disabled, _, _ := unstructured.NestedBool(specNetwork, "disabled"); disabled {
+		log.Info("VM has networking disabled - skipping network config injection")
+		return "", false
+	}
+
+	// Get status.network.config, or the network config at a fallback path
+	statusNetworkConfig, configPath, found := statusNetworkConfig(obj, configPaths)
+	if !found {
+		log.Warnf("VM %s has no %s - cannot inject network config, its IP may not be preserved", vmNameOf(obj), strings.Join(configPaths, " or "))
+		return "", false
+	}
+
+	// An empty config would inject an empty spec.network and the reconciler would apply its defaults
+	if interfaces, _, _ := unstructured.NestedSlice(statusNetworkConfig, "interfaces"); len(interfaces) == 0 {
+		log.Warnf("VM %s has no interfaces in %s - nothing to inject", vmNameOf(obj), configPath)
+		return "", false
+	}
+
+	// Get primary IPs for logging - dual-stack VMs have both, IPv6-only VMs only primaryIP6
+	primaryIP := primaryIPsFromStatus(obj)
+
+	log.WithFields(logrus.Fields{"ip": primaryIP, "path": configPath}).Info("Injecting network configuration")
+
+	// Convert status.network.config to spec.network
+	// This preserves the network configuration of every interface including:
+	// - IP addresses
 	// - gateway configuration
-	if err := unstructured.SetNestedMap(obj, statusNetworkConfig, "spec", "network"); err != nil {
-		p.log.Errorf("Failed to inject network config for VM %s/%s: %v", namespace, vmName, err)
-		return false
+	// - DNS settings
+	networkSpec := networkSpecFromStatusConfig(statusNetworkConfig)
+
+	// Keep the fields a partial spec.network already sets and only add the missing ones
+	for field, value := range specNetwork {
+		if field == "interfaces" {
+			continue
+		}
+		if _, fromStatus := networkSpec[field]; fromStatus {
+			log.WithField("field", field).Info("Keeping spec.network field over status.network.config")
+		}
+		networkSpec[field] = value
 	}
 
-	p.log.Infof("VM %s/%s network config injected successfully - IP %s will be preserved", namespace, vmName, primaryIP)
+	overrideDNS(networkSpec, dnsOverrides, log)
+
+	interfaces, _, _ := unstructured.NestedSlice(networkSpec, "interfaces")
+	for _, iface := range interfaces {
+		ifaceSpec := iface.(map[string]interface{})
+		name, _, _ := unstructured.NestedString(ifaceSpec, "name")
+		addresses, _, _ := unstructured.NestedStringSlice(ifaceSpec, "addresses")
+		gateway4, _, _ := unstructured.NestedString(ifaceSpec, "gateway4")
+		gateway6, _, _ := unstructured.NestedString(ifaceSpec, "gateway6")
+		log.WithFields(logrus.Fields{
+			"interface": name,
+			"addresses": addresses,
+			"gateway4":  gateway4,
+			"gateway6":  gateway6,
+		}).Info("Injecting interface configuration")
+	}
+
+	if err := unstructured.SetNestedMap(obj, networkSpec, "spec", "network"); err != nil {
+		log.Errorf("Failed to inject network config: %v", err)
+		return "", false
+	}
 
-	return true
+	log.WithField("ip", primaryIP).Info("Network config injected successfully - IP will be preserved")
+
+	return primaryIP, true
+}
+
+// vmNameOf returns the "namespace/name" of a VirtualMachine for warning messages, which are
+// read without their log fields
+func vmNameOf(obj map[string]interface{}) string {
+	namespace, _, _ := unstructured.NestedString(obj, "metadata", "namespace")
+	name, _, _ := unstructured.NestedString(obj, "metadata", "name")
+	return namespace + "/" + name
+}
+
+// primaryIPsFromStatus returns the VM's primary IPv4 and IPv6 addresses from
+// status.network, joined with a comma when both are present
+func primaryIPsFromStatus(obj map[string]interface{}) string {
+	var primaryIPs []string
+	for _, field := range []string{"primaryIP4", "primaryIP6"} {
+		if ip, found, _ := unstructured.NestedString(obj, "status", "network", field); found && ip != "" {
+			primaryIPs = append(primaryIPs, ip)
+		}
+	}
+	return strings.Join(primaryIPs, ",")
+}
+
+// vmGroupResourceIdentifier returns the resource identifier of a VirtualMachineGroup
+func vmGroupResourceIdentifier(namespace, name string) veleroplugin.ResourceIdentifier {
+	return veleroplugin.ResourceIdentifier{
+		GroupResource: schema.GroupResource{
+			Group:    vmoperatorGroup,
+			Resource: "virtualmachinegroups",
+		},
+		Namespace: namespace,
+		Name:      name,
+	}
 }
@@ -0,0 +1,1427 @@
+/*
+Copyright 2026 the Velero contributors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	vmopv1 "github.com/vmware-tanzu/vm-operator/api/v1alpha5"
+	vmopv1cloudinit "github.com/vmware-tanzu/vm-operator/api/v1alpha5/cloudinit"
+	vmopv1common "github.com/vmware-tanzu/vm-operator/api/v1alpha5/common"
+	vmopv1sysprep "github.com/vmware-tanzu/vm-operator/api/v1alpha5/sysprep"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/vmware-tanzu/velero/pkg/plugin/framework/common"
+	veleroplugin "github.com/vmware-tanzu/velero/pkg/plugin/velero"
+)
+
+// newTestVMRestoreAction returns a VMRestoreItemAction with a fake client serving objs
+// and the plugin config config
+func newTestVMRestoreAction(t *testing.T, config map[string]string, objs ...client.Object) (*VMRestoreItemAction, *logrustest.Hook) {
+	t.Helper()
+
+	log, hook := newTestLogger()
+	configMapClient := newConfigMapClient(common.PluginKindRestoreItemAction, VMRestorePluginName, config)
+	return NewVMRestoreItemActionWithClient(log, newFakeClient(t, objs...), configMapClient), hook
+}
+
+// executeVMRestore runs the VM restore action with the plugin config config and returns
+// the output and the content of the restored VM
+func executeVMRestore(t *testing.T, config map[string]string, vm *vmopv1.VirtualMachine) (*veleroplugin.RestoreItemActionExecuteOutput, map[string]interface{}) {
+	t.Helper()
+
+	action, _ := newTestVMRestoreAction(t, config)
+	output, err := action.Execute(newRestoreInput(t, vm))
+	require.NoError(t, err)
+	return output, output.UpdatedItem.UnstructuredContent()
+}
+
+// nestedString returns a string field of an object, or "" when it is not set
+func nestedString(obj map[string]interface{}, fields ...string) string {
+	value, _, _ := unstructured.NestedString(obj, fields...)
+	return value
+}
+
+func TestVMRestoreInstanceUUID(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected string
+	}{
+		{
+			name:     "removed by default",
+			config:   nil,
+			expected: "",
+		},
+		{
+			name:     "removed when not preserved",
+			config:   map[string]string{preserveInstanceUUIDConfigKey: "false"},
+			expected: "",
+		},
+		{
+			name:     "preserved",
+			config:   map[string]string{preserveInstanceUUIDConfigKey: "true"},
+			expected: "50123456-789a-bcde-f012-3456789abcde",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.InstanceUUID = "50123456-789a-bcde-f012-3456789abcde"
+
+			_, obj := executeVMRestore(t, tc.config, vm)
+
+			assert.Equal(t, tc.expected, nestedString(obj, "spec", "instanceUUID"))
+		})
+	}
+}
+
+func TestVMRestoreInvalidPreserveInstanceUUID(t *testing.T) {
+	action, _ := newTestVMRestoreAction(t, map[string]string{preserveInstanceUUIDConfigKey: "sometimes"})
+
+	_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	assert.ErrorContains(t, err, "invalid preserveInstanceUUID config")
+}
+
+// withNetworkConfigStatus sets the status.network.config interfaces of a VM
+func withNetworkConfigStatus(vm *vmopv1.VirtualMachine, interfaces ...vmopv1.VirtualMachineNetworkConfigInterfaceStatus) *vmopv1.VirtualMachine {
+	if vm.Status.Network == nil {
+		vm.Status.Network = &vmopv1.VirtualMachineNetworkStatus{}
+	}
+	vm.Status.Network.Config = &vmopv1.VirtualMachineNetworkConfigStatus{Interfaces: interfaces}
+	return vm
+}
+
+// staticInterface returns the status.network.config of an interface with static addresses
+func staticInterface(name, gateway4, gateway6 string, addresses ...string) vmopv1.VirtualMachineNetworkConfigInterfaceStatus {
+	return vmopv1.VirtualMachineNetworkConfigInterfaceStatus{
+		Name: name,
+		IP: &vmopv1.VirtualMachineNetworkConfigInterfaceIPStatus{
+			Addresses: addresses,
+			Gateway4:  gateway4,
+			Gateway6:  gateway6,
+		},
+	}
+}
+
+// restoredVM converts the content of a restored VM to a VirtualMachine
+func restoredVM(t *testing.T, obj map[string]interface{}) *vmopv1.VirtualMachine {
+	t.Helper()
+
+	vm := &vmopv1.VirtualMachine{}
+	require.NoError(t, fromUnstructured(obj, vm))
+	return vm
+}
+
+func TestVMRestoreInjectsEveryInterface(t *testing.T) {
+	vm := withNetworkConfigStatus(newVM("vm-1"),
+		staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"),
+		staticInterface("eth1", "10.0.0.1", "fd00::1", "10.0.0.10/16", "fd00::10/64"),
+	)
+	vm.Status.Network.PrimaryIP4 = "192.168.1.10"
+
+	_, obj := executeVMRestore(t, nil, vm)
+
+	network := restoredVM(t, obj).Spec.Network
+	require.NotNil(t, network)
+	require.Len(t, network.Interfaces, 2)
+
+	assert.Equal(t, "eth0", network.Interfaces[0].Name)
+	assert.Equal(t, []string{"192.168.1.10/24"}, network.Interfaces[0].Addresses)
+	assert.Equal(t, "192.168.1.1", network.Interfaces[0].Gateway4)
+
+	assert.Equal(t, "eth1", network.Interfaces[1].Name)
+	assert.Equal(t, []string{"10.0.0.10/16", "fd00::10/64"}, network.Interfaces[1].Addresses)
+	assert.Equal(t, "10.0.0.1", network.Interfaces[1].Gateway4)
+	assert.Equal(t, "fd00::1", network.Interfaces[1].Gateway6)
+}
+
+func TestVMRestoreInjectsIPv6OnlyInterface(t *testing.T) {
+	vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "", "fd00::1", "fd00::10/64"))
+	vm.Status.Network.PrimaryIP6 = "fd00::10"
+
+	action, hook := newTestVMRestoreAction(t, nil)
+	output, err := action.Execute(newRestoreInput(t, vm))
+	require.NoError(t, err)
+
+	network := restoredVM(t, output.UpdatedItem.UnstructuredContent()).Spec.Network
+	require.NotNil(t, network)
+	require.Len(t, network.Interfaces, 1)
+	assert.Equal(t, []string{"fd00::10/64"}, network.Interfaces[0].Addresses)
+	assert.Equal(t, "fd00::1", network.Interfaces[0].Gateway6)
+	assert.Empty(t, network.Interfaces[0].Gateway4)
+
+	var loggedIPs []interface{}
+	for _, entry := range hook.AllEntries() {
+		if ip, found := entry.Data["ip"]; found {
+			loggedIPs = append(loggedIPs, ip)
+		}
+	}
+	assert.Contains(t, loggedIPs, "fd00::10")
+}
+
+func TestVMRestoreDNSOverrides(t *testing.T) {
+	tests := []struct {
+		name                       string
+		config                     map[string]string
+		expectedNameservers        []string
+		expectedSearchDomains      []string
+		expectedIfaceNameservers   []string
+		expectedIfaceSearchDomains []string
+	}{
+		{
+			name:                       "preserved",
+			expectedNameservers:        []string{"192.168.1.53"},
+			expectedSearchDomains:      []string{"site-a.example.com"},
+			expectedIfaceNameservers:   []string{"192.168.1.54"},
+			expectedIfaceSearchDomains: []string{"eth0.site-a.example.com"},
+		},
+		{
+			name: "overridden",
+			config: map[string]string{
+				dnsServersConfigKey:    "10.0.0.53, fd00::53",
+				searchDomainsConfigKey: "site-b.example.com",
+			},
+			expectedNameservers:   []string{"10.0.0.53", "fd00::53"},
+			expectedSearchDomains: []string{"site-b.example.com"},
+		},
+		{
+			name:   "cleared",
+			config: map[string]string{dnsServersConfigKey: "", searchDomainsConfigKey: ""},
+		},
+		{
+			name:                       "nameservers overridden only",
+			config:                     map[string]string{dnsServersConfigKey: "10.0.0.53"},
+			expectedNameservers:        []string{"10.0.0.53"},
+			expectedSearchDomains:      []string{"site-a.example.com"},
+			expectedIfaceSearchDomains: []string{"eth0.site-a.example.com"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			iface := staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24")
+			iface.DNS = &vmopv1.VirtualMachineNetworkConfigDNSStatus{
+				Nameservers:   []string{"192.168.1.54"},
+				SearchDomains: []string{"eth0.site-a.example.com"},
+			}
+			vm := withNetworkConfigStatus(newVM("vm-1"), iface)
+			vm.Status.Network.Config.DNS = &vmopv1.VirtualMachineNetworkConfigDNSStatus{
+				HostName:      "vm-1",
+				Nameservers:   []string{"192.168.1.53"},
+				SearchDomains: []string{"site-a.example.com"},
+			}
+
+			_, obj := executeVMRestore(t, tc.config, vm)
+
+			network := restoredVM(t, obj).Spec.Network
+			require.NotNil(t, network)
+			assert.Equal(t, "vm-1", network.HostName)
+			assert.Equal(t, tc.expectedNameservers, network.Nameservers)
+			assert.Equal(t, tc.expectedSearchDomains, network.SearchDomains)
+			require.Len(t, network.Interfaces, 1)
+			assert.Equal(t, []string{"192.168.1.10/24"}, network.Interfaces[0].Addresses)
+			assert.Equal(t, tc.expectedIfaceNameservers, network.Interfaces[0].Nameservers)
+			assert.Equal(t, tc.expectedIfaceSearchDomains, network.Interfaces[0].SearchDomains)
+		})
+	}
+}
+
+func TestVMRestoreInvalidDNSServers(t *testing.T) {
+	vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+	action, _ := newTestVMRestoreAction(t, map[string]string{dnsServersConfigKey: "10.0.0.53,dns.example.com"})
+
+	_, err := action.Execute(newRestoreInput(t, vm))
+	assert.ErrorContains(t, err, `invalid dnsServers config: "dns.example.com" is not an IP address`)
+}
+
+func TestPrimaryIPsFromStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		primaryIP4 string
+		primaryIP6 string
+		expected   string
+	}{
+		{name: "IPv4 only", primaryIP4: "192.168.1.10", expected: "192.168.1.10"},
+		{name: "IPv6 only", primaryIP6: "fd00::10", expected: "fd00::10"},
+		{name: "dual-stack", primaryIP4: "192.168.1.10", primaryIP6: "fd00::10", expected: "192.168.1.10,fd00::10"},
+		{name: "none", expected: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Status.Network = &vmopv1.VirtualMachineNetworkStatus{PrimaryIP4: tc.primaryIP4, PrimaryIP6: tc.primaryIP6}
+
+			assert.Equal(t, tc.expected, primaryIPsFromStatus(toUnstructured(t, vm).Object))
+		})
+	}
+}
+
+func TestVMRestoreSkipNetworkInjectionAnnotation(t *testing.T) {
+	tests := []struct {
+		name           string
+		annotations    map[string]string
+		expectInjected bool
+	}{
+		{
+			name:           "annotation absent",
+			annotations:    nil,
+			expectInjected: true,
+		},
+		{
+			name:           "annotation true",
+			annotations:    map[string]string{skipNetworkInjectionAnnotation: "true"},
+			expectInjected: false,
+		},
+		{
+			name:           "annotation false",
+			annotations:    map[string]string{skipNetworkInjectionAnnotation: "false"},
+			expectInjected: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+			vm.Annotations = tc.annotations
+
+			_, obj := executeVMRestore(t, nil, vm)
+
+			_, injected, _ := unstructured.NestedMap(obj, "spec", "network")
+			assert.Equal(t, tc.expectInjected, injected)
+		})
+	}
+}
+
+func TestVMRestoreWaitForGroupTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected time.Duration
+		warns    bool
+	}{
+		{name: "default", expected: defaultWaitForGroupTimeout},
+		{name: "configured", config: map[string]string{waitForGroupTimeoutConfigKey: "90s"}, expected: 90 * time.Second},
+		{name: "invalid", config: map[string]string{waitForGroupTimeoutConfigKey: "soon"}, expected: defaultWaitForGroupTimeout, warns: true},
+		{name: "not positive", config: map[string]string{waitForGroupTimeoutConfigKey: "-1m"}, expected: defaultWaitForGroupTimeout, warns: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.GroupName = "group-1"
+
+			action, hook := newTestVMRestoreAction(t, tt.config)
+			output, err := action.Execute(newRestoreInput(t, vm))
+			require.NoError(t, err)
+
+			assert.True(t, output.WaitForAdditionalItems)
+			assert.Equal(t, tt.expected, output.AdditionalItemsReadyTimeout)
+			warned := false
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, waitForGroupTimeoutConfigKey) {
+					warned = true
+					assert.Equal(t, "vm-1", entry.Data["vm"])
+				}
+			}
+			assert.Equal(t, tt.warns, warned)
+		})
+	}
+}
+
+// reconciledVMGroup returns a VirtualMachineGroup whose Ready condition VM Operator has evaluated
+// for its current generation
+func reconciledVMGroup(name string, status metav1.ConditionStatus) *vmopv1.VirtualMachineGroup {
+	vmGroup := newVMGroup(name)
+	vmGroup.Generation = 2
+	vmGroup.Status.Conditions = []metav1.Condition{{
+		Type:               vmopv1.ReadyConditionType,
+		Status:             status,
+		ObservedGeneration: 2,
+		Reason:             "Reconciled",
+		LastTransitionTime: metav1.NewTime(time.Now()),
+	}}
+	return vmGroup
+}
+
+func TestVMRestoreAreAdditionalItemsReady(t *testing.T) {
+	staleCondition := reconciledVMGroup("group-1", metav1.ConditionTrue)
+	staleCondition.Status.Conditions[0].ObservedGeneration = 1
+
+	unknownCondition := reconciledVMGroup("group-1", metav1.ConditionUnknown)
+
+	renamed := reconciledVMGroup("group-1-restored", metav1.ConditionTrue)
+	renamed.Namespace = "target-ns"
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		mapping  map[string]string
+		group    *vmopv1.VirtualMachineGroup
+		expected bool
+	}{
+		{name: "group not restored", expected: true},
+		{name: "no conditions", group: newVMGroup("group-1"), expected: false},
+		{name: "condition of an older generation", group: staleCondition, expected: false},
+		{name: "condition unknown", group: unknownCondition, expected: false},
+		{name: "reconciled but not ready", group: reconciledVMGroup("group-1", metav1.ConditionFalse), expected: true},
+		{name: "ready", group: reconciledVMGroup("group-1", metav1.ConditionTrue), expected: true},
+		{
+			name:     "renamed group in a mapped namespace",
+			config:   map[string]string{groupNameSuffixConfigKey: "-restored"},
+			mapping:  map[string]string{testNamespace: "target-ns"},
+			group:    renamed,
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var objs []client.Object
+			if tt.group != nil {
+				objs = append(objs, tt.group)
+			}
+			action, _ := newTestVMRestoreAction(t, tt.config, objs...)
+
+			restore := newRestoreInput(t, newVM("vm-1")).Restore
+			restore.Spec.NamespaceMapping = tt.mapping
+
+			ready, err := action.AreAdditionalItemsReady([]veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")}, restore)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, ready)
+		})
+	}
+}
+
+func TestVMRestoreClassMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected string
+	}{
+		{name: "matched", config: map[string]string{vmClassMappingConfigKey: "best-effort-small:best-effort-medium"}, expected: "best-effort-medium"},
+		{name: "unmatched", config: map[string]string{vmClassMappingConfigKey: "guaranteed-small:guaranteed-medium"}, expected: "best-effort-small"},
+		{name: "empty mapping", config: map[string]string{vmClassMappingConfigKey: ""}, expected: "best-effort-small"},
+		{name: "not configured", expected: "best-effort-small"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.ClassName = "best-effort-small"
+
+			_, obj := executeVMRestore(t, tt.config, vm)
+			assert.Equal(t, tt.expected, restoredVM(t, obj).Spec.ClassName)
+		})
+	}
+}
+
+func TestVMRestoreInvalidClassMapping(t *testing.T) {
+	action, _ := newTestVMRestoreAction(t, map[string]string{vmClassMappingConfigKey: "best-effort-small"})
+	_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	assert.ErrorContains(t, err, "invalid vmClassMapping config")
+}
+
+func TestVMRestoreImageMapping(t *testing.T) {
+	config := map[string]string{vmImageMappingConfigKey: "ubuntu-2204-old:ubuntu-2204-new"}
+
+	tests := []struct {
+		name          string
+		image         *vmopv1.VirtualMachineImageRef
+		imageName     string
+		expectedImage string
+		expectedName  string
+	}{
+		{
+			name:          "structured image reference",
+			image:         &vmopv1.VirtualMachineImageRef{Kind: "VirtualMachineImage", Name: "ubuntu-2204-old"},
+			expectedImage: "ubuntu-2204-new",
+		},
+		{
+			name:         "legacy image name",
+			imageName:    "ubuntu-2204-old",
+			expectedName: "ubuntu-2204-new",
+		},
+		{
+			name:          "both forms",
+			image:         &vmopv1.VirtualMachineImageRef{Kind: "ClusterVirtualMachineImage", Name: "ubuntu-2204-old"},
+			imageName:     "ubuntu-2204-old",
+			expectedImage: "ubuntu-2204-new",
+			expectedName:  "ubuntu-2204-new",
+		},
+		{
+			name:          "unmapped image",
+			image:         &vmopv1.VirtualMachineImageRef{Kind: "VirtualMachineImage", Name: "photon-5"},
+			imageName:     "photon-5",
+			expectedImage: "photon-5",
+			expectedName:  "photon-5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.Image = tt.image
+			vm.Spec.ImageName = tt.imageName
+
+			_, obj := executeVMRestore(t, config, vm)
+			assert.Equal(t, tt.expectedImage, nestedString(obj, "spec", "image", "name"))
+			assert.Equal(t, tt.expectedName, nestedString(obj, "spec", "imageName"))
+			if tt.image != nil {
+				assert.Equal(t, tt.image.Kind, nestedString(obj, "spec", "image", "kind"))
+			}
+		})
+	}
+}
+
+func TestVMRestoreSecretMapping(t *testing.T) {
+	config := map[string]string{secretMappingConfigKey: "old:new"}
+
+	tests := []struct {
+		name      string
+		bootstrap *vmopv1.VirtualMachineBootstrapSpec
+		expected  []string
+	}{
+		{
+			name: "cloud-init raw cloud-config",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				CloudInit: &vmopv1.VirtualMachineBootstrapCloudInitSpec{
+					RawCloudConfig: &vmopv1common.SecretKeySelector{Name: "old", Key: "user-data"},
+				},
+			},
+			expected: []string{"new"},
+		},
+		{
+			name: "cloud-init inline cloud-config users",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				CloudInit: &vmopv1.VirtualMachineBootstrapCloudInitSpec{
+					CloudConfig: &vmopv1cloudinit.CloudConfig{
+						Users: []vmopv1cloudinit.User{
+							{Name: "admin", Passwd: &vmopv1common.SecretKeySelector{Name: "old", Key: "passwd"}},
+							{Name: "ops", HashedPasswd: &vmopv1common.SecretKeySelector{Name: "keep", Key: "hash"}},
+						},
+					},
+				},
+			},
+			expected: []string{"new", "keep"},
+		},
+		{
+			name: "linuxprep",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				LinuxPrep: &vmopv1.VirtualMachineBootstrapLinuxPrepSpec{
+					Password:   &vmopv1common.PasswordSecretKeySelector{Name: "old", Key: "password"},
+					ScriptText: &vmopv1common.ValueOrSecretKeySelector{From: &vmopv1common.SecretKeySelector{Name: "keep", Key: "script"}},
+				},
+			},
+			expected: []string{"new", "keep"},
+		},
+		{
+			name: "raw sysprep",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				Sysprep: &vmopv1.VirtualMachineBootstrapSysprepSpec{
+					RawSysprep: &vmopv1common.SecretKeySelector{Name: "old", Key: "unattend"},
+				},
+			},
+			expected: []string{"new"},
+		},
+		{
+			name: "inline sysprep",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				Sysprep: &vmopv1.VirtualMachineBootstrapSysprepSpec{
+					Sysprep: &vmopv1sysprep.Sysprep{
+						GUIUnattended:  &vmopv1sysprep.GUIUnattended{Password: &vmopv1sysprep.PasswordSecretKeySelector{Name: "old", Key: "password"}},
+						Identification: &vmopv1sysprep.Identification{DomainAdminPassword: &vmopv1sysprep.DomainPasswordSecretKeySelector{Name: "old", Key: "domain-password"}},
+						UserData:       vmopv1sysprep.UserData{ProductID: &vmopv1sysprep.ProductIDSecretKeySelector{Name: "keep", Key: "id"}},
+					},
+				},
+			},
+			expected: []string{"new", "keep"},
+		},
+		{
+			name: "vAppConfig",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				VAppConfig: &vmopv1.VirtualMachineBootstrapVAppConfigSpec{
+					Properties: []vmopv1common.KeyValueOrSecretKeySelectorPair{{
+						Key:   "password",
+						Value: vmopv1common.ValueOrSecretKeySelector{From: &vmopv1common.SecretKeySelector{Name: "old", Key: "password"}},
+					}},
+					RawProperties: "old",
+				},
+			},
+			expected: []string{"new"},
+		},
+		{
+			name: "unmapped secret",
+			bootstrap: &vmopv1.VirtualMachineBootstrapSpec{
+				CloudInit: &vmopv1.VirtualMachineBootstrapCloudInitSpec{
+					RawCloudConfig: &vmopv1common.SecretKeySelector{Name: "keep", Key: "user-data"},
+				},
+			},
+			expected: []string{"keep"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.Bootstrap = tt.bootstrap
+
+			_, obj := executeVMRestore(t, config, vm)
+
+			// The secrets the backup plugin finds on the restored VM are the ones it now references
+			assert.Equal(t, tt.expected, extractSecrets(t, restoredVM(t, obj)))
+		})
+	}
+}
+
+// withInstanceVolumeClaim adds an instance volume claim of storageClass to a VM
+func withInstanceVolumeClaim(vm *vmopv1.VirtualMachine, volumeName, storageClass string) *vmopv1.VirtualMachine {
+	vm.Spec.Volumes = append(vm.Spec.Volumes, vmopv1.VirtualMachineVolume{
+		Name: volumeName,
+		VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+			PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{
+				PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: vm.Name + "-" + volumeName},
+				InstanceVolumeClaim: &vmopv1.InstanceVolumeClaimVolumeSource{
+					StorageClass: storageClass,
+					Size:         resource.MustParse("10Gi"),
+				},
+			},
+		},
+	})
+	return vm
+}
+
+func TestVMRestoreInstanceVolumeStorageClassMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected []string
+	}{
+		{
+			name:     "mapped",
+			config:   map[string]string{storageClassMappingConfigKey: "vsan-default:vsan-target"},
+			expected: []string{"vsan-target", "vsan-other"},
+		},
+		{
+			name:     "not configured",
+			expected: []string{"vsan-default", "vsan-other"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := withInstanceVolumeClaim(withInstanceVolumeClaim(newVM("vm-1"), "instance-1", "vsan-default"), "instance-2", "vsan-other")
+			vm.Spec.Volumes = append(vm.Spec.Volumes, vmopv1.VirtualMachineVolume{
+				Name: "data",
+				VirtualMachineVolumeSource: vmopv1.VirtualMachineVolumeSource{
+					PersistentVolumeClaim: &vmopv1.PersistentVolumeClaimVolumeSource{
+						PersistentVolumeClaimVolumeSource: corev1.PersistentVolumeClaimVolumeSource{ClaimName: "data"},
+					},
+				},
+			})
+
+			// The mapping is read from the config of the PVC restore plugin
+			log, _ := newTestLogger()
+			configMapClient := newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName, tt.config)
+			action := NewVMRestoreItemActionWithClient(log, newFakeClient(t), configMapClient)
+			output, err := action.Execute(newRestoreInput(t, vm))
+			require.NoError(t, err)
+
+			volumes := restoredVM(t, output.UpdatedItem.UnstructuredContent()).Spec.Volumes
+			require.Len(t, volumes, 3)
+			for i, expected := range tt.expected {
+				assert.Equal(t, expected, volumes[i].PersistentVolumeClaim.InstanceVolumeClaim.StorageClass)
+				assert.Equal(t, resource.MustParse("10Gi"), volumes[i].PersistentVolumeClaim.InstanceVolumeClaim.Size)
+			}
+			assert.Nil(t, volumes[2].PersistentVolumeClaim.InstanceVolumeClaim)
+			assert.Equal(t, "data", volumes[2].PersistentVolumeClaim.ClaimName)
+		})
+	}
+}
+
+func TestVMRestoreInvalidInstanceVolumeStorageClassMapping(t *testing.T) {
+	log, _ := newTestLogger()
+	configMapClient := newConfigMapClient(common.PluginKindRestoreItemAction, PVCRestorePluginName, map[string]string{storageClassMappingConfigKey: "vsan-default"})
+	action := NewVMRestoreItemActionWithClient(log, newFakeClient(t), configMapClient)
+
+	_, err := action.Execute(newRestoreInput(t, withInstanceVolumeClaim(newVM("vm-1"), "instance-1", "vsan-default")))
+	assert.ErrorContains(t, err, "invalid storageClassMapping config")
+}
+
+func TestVMRestoreClearStatus(t *testing.T) {
+	tests := []struct {
+		name                 string
+		config               map[string]string
+		expectedInstanceUUID string
+	}{
+		{name: "cleared by default"},
+		{name: "kept", config: map[string]string{clearStatusConfigKey: "false"}, expectedInstanceUUID: "instance-uuid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+			vm.Status.InstanceUUID = "instance-uuid"
+			vm.Status.BiosUUID = "bios-uuid"
+
+			_, obj := executeVMRestore(t, tt.config, vm)
+
+			assert.Equal(t, tt.expectedInstanceUUID, nestedString(obj, "status", "instanceUUID"))
+			if tt.expectedInstanceUUID == "" {
+				assert.Empty(t, obj["status"])
+			}
+
+			// The network config is read from the status before it is cleared
+			network := restoredVM(t, obj).Spec.Network
+			require.NotNil(t, network)
+			require.Len(t, network.Interfaces, 1)
+			assert.Equal(t, []string{"192.168.1.10/24"}, network.Interfaces[0].Addresses)
+		})
+	}
+}
+
+func TestVMRestoreRemoveAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		vmopv1.FirstBootDoneAnnotation:               "true",
+		"vmoperator.vmware.com/reconcile-marker":     "1",
+		"vmoperator.vmware.com/paused":               "true",
+		"example.com/owner":                          "team-a",
+		"example.com/ticket":                         "OPS-1",
+		"virtualmachine.vmoperator.vmware.com/other": "keep",
+	}
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected map[string]string
+	}{
+		{
+			name: "default removes first-boot-done",
+			expected: map[string]string{
+				"vmoperator.vmware.com/reconcile-marker":     "1",
+				"vmoperator.vmware.com/paused":               "true",
+				"example.com/owner":                          "team-a",
+				"example.com/ticket":                         "OPS-1",
+				"virtualmachine.vmoperator.vmware.com/other": "keep",
+			},
+		},
+		{
+			name:   "explicit keys",
+			config: map[string]string{removeAnnotationsConfigKey: "example.com/owner, vmoperator.vmware.com/paused"},
+			expected: map[string]string{
+				vmopv1.FirstBootDoneAnnotation:               "true",
+				"vmoperator.vmware.com/reconcile-marker":     "1",
+				"example.com/ticket":                         "OPS-1",
+				"virtualmachine.vmoperator.vmware.com/other": "keep",
+			},
+		},
+		{
+			name:   "prefix",
+			config: map[string]string{removeAnnotationsConfigKey: "vmoperator.vmware.com/*," + vmopv1.FirstBootDoneAnnotation},
+			expected: map[string]string{
+				"example.com/owner":                          "team-a",
+				"example.com/ticket":                         "OPS-1",
+				"virtualmachine.vmoperator.vmware.com/other": "keep",
+			},
+		},
+		{
+			name:     "empty list removes nothing",
+			config:   map[string]string{removeAnnotationsConfigKey: ""},
+			expected: annotations,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Annotations = maps.Clone(annotations)
+
+			_, obj := executeVMRestore(t, tt.config, vm)
+			assert.Equal(t, tt.expected, restoredVM(t, obj).Annotations)
+		})
+	}
+}
+
+func TestVMRestoreMalformedAnnotations(t *testing.T) {
+	input := newRestoreInput(t, newVM("vm-1"))
+	require.NoError(t, unstructured.SetNestedMap(input.Item.UnstructuredContent(), map[string]interface{}{
+		vmopv1.FirstBootDoneAnnotation: "true",
+		"example.com/replicas":         int64(3),
+		"example.com/enabled":          true,
+		"example.com/owner":            "team-a",
+	}, "metadata", "annotations"))
+
+	action, hook := newTestVMRestoreAction(t, nil)
+	output, err := action.Execute(input)
+	require.NoError(t, err)
+
+	// first-boot-done is still removed and the other values are kept as strings
+	assert.Equal(t, map[string]string{
+		"example.com/replicas": "3",
+		"example.com/enabled":  "true",
+		"example.com/owner":    "team-a",
+	}, restoredVM(t, output.UpdatedItem.UnstructuredContent()).Annotations)
+	assert.Equal(t, logrus.WarnLevel, entryWithMessage(t, hook, "VM has malformed annotations, converting their values to strings").Level)
+}
+
+func TestVMRestoreInvalidAnnotations(t *testing.T) {
+	input := newRestoreInput(t, newVM("vm-1"))
+	require.NoError(t, unstructured.SetNestedField(input.Item.UnstructuredContent(), "not-a-map", "metadata", "annotations"))
+
+	action, _ := newTestVMRestoreAction(t, nil)
+	_, err := action.Execute(input)
+	assert.ErrorContains(t, err, "failed to read annotations")
+}
+
+func TestVMRestorePowerState(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected vmopv1.VirtualMachinePowerState
+	}{
+		{name: "preserved by default", expected: vmopv1.VirtualMachinePowerStateOn},
+		{name: "preserve", config: map[string]string{restorePowerStateConfigKey: preservePowerState}, expected: vmopv1.VirtualMachinePowerStateOn},
+		{name: "powered off", config: map[string]string{restorePowerStateConfigKey: "PoweredOff"}, expected: vmopv1.VirtualMachinePowerStateOff},
+		{name: "powered on", config: map[string]string{restorePowerStateConfigKey: "PoweredOn"}, expected: vmopv1.VirtualMachinePowerStateOn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.PowerState = vmopv1.VirtualMachinePowerStateOn
+
+			_, obj := executeVMRestore(t, tt.config, vm)
+			assert.Equal(t, string(tt.expected), nestedString(obj, "spec", "powerState"))
+		})
+	}
+}
+
+func TestVMRestorePowerStateSetsMissingField(t *testing.T) {
+	_, obj := executeVMRestore(t, map[string]string{restorePowerStateConfigKey: "PoweredOff"}, newVM("vm-1"))
+	assert.Equal(t, string(vmopv1.VirtualMachinePowerStateOff), nestedString(obj, "spec", "powerState"))
+}
+
+func TestVMRestoreInvalidPowerState(t *testing.T) {
+	action, _ := newTestVMRestoreAction(t, map[string]string{restorePowerStateConfigKey: "Suspended"})
+	_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	assert.ErrorContains(t, err, `invalid restorePowerState config "Suspended"`)
+}
+
+func TestVMRestoreGroupBeforeVM(t *testing.T) {
+	groupIdentifier := veleroplugin.ResourceIdentifier{
+		GroupResource: schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "virtualmachinegroups"},
+		Namespace:     testNamespace,
+		Name:          "group-1",
+	}
+
+	tests := []struct {
+		name      string
+		groupName string
+		mapping   map[string]string
+		expected  []veleroplugin.ResourceIdentifier
+		wait      bool
+	}{
+		{name: "no group", groupName: "", expected: nil, wait: false},
+		{name: "group", groupName: "group-1", expected: []veleroplugin.ResourceIdentifier{groupIdentifier}, wait: true},
+		{
+			name:      "group with namespace mapping",
+			groupName: "group-1",
+			mapping:   map[string]string{testNamespace: "target-ns"},
+			expected:  []veleroplugin.ResourceIdentifier{groupIdentifier},
+			wait:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _ := newTestVMRestoreAction(t, nil)
+			input := newRestoreInput(t, withGroupName(newVM("vm-1"), tt.groupName))
+			input.Restore.Spec.NamespaceMapping = tt.mapping
+
+			output, err := action.Execute(input)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, output.AdditionalItems)
+			assert.Equal(t, tt.wait, output.WaitForAdditionalItems)
+		})
+	}
+}
+
+func TestVMRestoreKeepsAdvancedSpec(t *testing.T) {
+	bootDiskCapacity := resource.MustParse("50Gi")
+	changeBlockTracking := true
+	vm := newVM("vm-1")
+	vm.Spec.Advanced = &vmopv1.VirtualMachineAdvancedSpec{
+		BootDiskCapacity:              &bootDiskCapacity,
+		DefaultVolumeProvisioningMode: vmopv1.VolumeProvisioningModeThin,
+		ChangeBlockTracking:           &changeBlockTracking,
+	}
+
+	_, obj := executeVMRestore(t, nil, vm)
+
+	assert.Equal(t, vm.Spec.Advanced, restoredVM(t, obj).Spec.Advanced)
+}
+
+func TestVMRestoreBootstrapSecrets(t *testing.T) {
+	secretIdentifier := func(name string) veleroplugin.ResourceIdentifier {
+		return veleroplugin.ResourceIdentifier{GroupResource: schema.GroupResource{Resource: "secrets"}, Namespace: testNamespace, Name: name}
+	}
+	groupIdentifier := veleroplugin.ResourceIdentifier{
+		GroupResource: schema.GroupResource{Group: "vmoperator.vmware.com", Resource: "virtualmachinegroups"},
+		Namespace:     testNamespace,
+		Name:          "group-1",
+	}
+
+	tests := []struct {
+		name     string
+		config   map[string]string
+		vm       *vmopv1.VirtualMachine
+		expected []veleroplugin.ResourceIdentifier
+		wait     bool
+	}{
+		{
+			name: "no bootstrap",
+			vm:   newVM("vm-1"),
+		},
+		{
+			name:     "cloud-init secret",
+			vm:       withCloudConfigSecret(newVM("vm-1"), "cloud-config"),
+			expected: []veleroplugin.ResourceIdentifier{secretIdentifier("cloud-config")},
+		},
+		{
+			name:     "cloud-init secret of a VM in a group",
+			vm:       withGroupName(withCloudConfigSecret(newVM("vm-1"), "cloud-config"), "group-1"),
+			expected: []veleroplugin.ResourceIdentifier{groupIdentifier, secretIdentifier("cloud-config")},
+			wait:     true,
+		},
+		{
+			// Velero looks the secret up under its name in the backup
+			name:     "renamed secret",
+			config:   map[string]string{secretMappingConfigKey: "cloud-config:cloud-config-staging"},
+			vm:       withCloudConfigSecret(newVM("vm-1"), "cloud-config"),
+			expected: []veleroplugin.ResourceIdentifier{secretIdentifier("cloud-config")},
+		},
+		{
+			name: "configmap transport",
+			vm: func() *vmopv1.VirtualMachine {
+				vm := withCloudConfigSecret(newVM("vm-1"), "cloud-config")
+				vm.Annotations = map[string]string{vmopv1.V1alpha1ConfigMapTransportAnnotation: "true"}
+				return vm
+			}(),
+			expected: []veleroplugin.ResourceIdentifier{{GroupResource: schema.GroupResource{Resource: "configmaps"}, Namespace: testNamespace, Name: "cloud-config"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _ := newTestVMRestoreAction(t, tt.config)
+
+			output, err := action.Execute(newRestoreInput(t, tt.vm))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, output.AdditionalItems)
+			assert.Equal(t, tt.wait, output.WaitForAdditionalItems)
+		})
+	}
+}
+
+func TestVMRestoreNamespaceMapping(t *testing.T) {
+	vm := withGroupName(newVM("vm-1"), "group-1")
+	restoredGroup := reconciledVMGroup("group-1", metav1.ConditionTrue)
+	restoredGroup.Namespace = "target-ns"
+
+	action, _ := newTestVMRestoreAction(t, nil, restoredGroup)
+	input := newRestoreInput(t, vm)
+	input.Restore.Spec.NamespaceMapping = map[string]string{testNamespace: "target-ns"}
+
+	output, err := action.Execute(input)
+	require.NoError(t, err)
+
+	// Velero looks the additional item up in the backup under its source namespace and
+	// restores it into the mapped namespace
+	require.Equal(t, []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")}, output.AdditionalItems)
+
+	// The readiness check looks for the group where it was restored
+	ready, err := action.AreAdditionalItemsReady(output.AdditionalItems, input.Restore)
+	require.NoError(t, err)
+	assert.True(t, ready)
+}
+
+func TestVMRestoreEmptyNetworkConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+	}{
+		{name: "empty config", config: map[string]interface{}{}},
+		{name: "no interfaces", config: map[string]interface{}{"interfaces": []interface{}{}, "dns": map[string]interface{}{"nameservers": []interface{}{"10.0.0.2"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := newRestoreInput(t, newVM("vm-1"))
+			require.NoError(t, unstructured.SetNestedMap(input.Item.UnstructuredContent(), tt.config, "status", "network", "config"))
+
+			action, hook := newTestVMRestoreAction(t, map[string]string{clearStatusConfigKey: "false"})
+			output, err := action.Execute(input)
+			require.NoError(t, err)
+
+			_, found, _ := unstructured.NestedFieldNoCopy(output.UpdatedItem.UnstructuredContent(), "spec", "network")
+			assert.False(t, found)
+			require.Len(t, warnings(hook), 1)
+			assert.Contains(t, warnings(hook)[0], "has no interfaces in status.network.config")
+		})
+	}
+}
+
+func TestAreGroupsReadyGetTimeout(t *testing.T) {
+	var deadline time.Time
+	c := newInterceptedFakeClient(t, interceptor.Funcs{
+		Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			deadline, _ = ctx.Deadline()
+			return cl.Get(ctx, key, obj, opts...)
+		},
+	})
+	log, _ := newTestLogger()
+
+	ready, err := areGroupsReady(context.Background(), c, log, []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")}, nil, nil)
+	require.NoError(t, err)
+	assert.True(t, ready)
+	assert.WithinDuration(t, time.Now().Add(defaultGetTimeout), deadline, time.Second)
+}
+
+func TestAreGroupsReadyMissingGroup(t *testing.T) {
+	log, hook := newTestLogger()
+	c := newFakeClient(t, newVMGroup("group-2"))
+	additionalItems := []veleroplugin.ResourceIdentifier{
+		vmGroupResourceIdentifier(testNamespace, "group-1"),
+		vmGroupResourceIdentifier(testNamespace, "group-2"),
+	}
+
+	// The missing group is skipped, the restored one is still waited for
+	ready, err := areGroupsReady(context.Background(), c, log, additionalItems, nil, nil)
+	require.NoError(t, err)
+	assert.False(t, ready)
+
+	entry := entryWithMessage(t, hook, "VirtualMachineGroup was not restored - not waiting for it")
+	assert.Equal(t, logrus.WarnLevel, entry.Level)
+	assert.Equal(t, "group-1", entry.Data["group"])
+
+	ready, err = areGroupsReady(context.Background(), c, log, additionalItems[:1], nil, nil)
+	require.NoError(t, err)
+	assert.True(t, ready)
+}
+
+func TestVMRestoreGroupRename(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected string
+	}{
+		{name: "mapping", config: map[string]string{groupNameMappingConfigKey: "group-1:group-1-staging"}, expected: "group-1-staging"},
+		{name: "suffix", config: map[string]string{groupNameSuffixConfigKey: "-staging"}, expected: "group-1-staging"},
+		{name: "suffix key in another case", config: map[string]string{"GroupNameSuffix": "-staging"}, expected: "group-1-staging"},
+		{
+			name:     "mapping takes precedence over suffix",
+			config:   map[string]string{groupNameMappingConfigKey: "group-1:staging", groupNameSuffixConfigKey: "-staging"},
+			expected: "staging",
+		},
+		{name: "unmapped group keeps its name", config: map[string]string{groupNameMappingConfigKey: "group-2:group-2-staging"}, expected: "group-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, _ := newTestVMRestoreAction(t, tt.config, reconciledVMGroup(tt.expected, metav1.ConditionTrue))
+			input := newRestoreInput(t, withGroupName(newVM("vm-1"), "group-1"))
+
+			output, err := action.Execute(input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, restoredVM(t, output.UpdatedItem.UnstructuredContent()).Spec.GroupName)
+
+			// The additional item names the group in the backup, which the group restore renames
+			// the same way as the VM's spec.groupName
+			require.Equal(t, []veleroplugin.ResourceIdentifier{vmGroupResourceIdentifier(testNamespace, "group-1")}, output.AdditionalItems)
+			log, _ := newTestLogger()
+			groupAction := NewVMGroupRestoreItemAction(log, newConfigMapClient(common.PluginKindRestoreItemAction, VMRestorePluginName, tt.config))
+			groupOutput, err := groupAction.Execute(newRestoreInput(t, newVMGroup(output.AdditionalItems[0].Name)))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, nestedString(groupOutput.UpdatedItem.UnstructuredContent(), "metadata", "name"))
+
+			// The wait targets the renamed group
+			ready, err := action.AreAdditionalItemsReady(output.AdditionalItems, input.Restore)
+			require.NoError(t, err)
+			assert.True(t, ready)
+		})
+	}
+}
+
+func TestVMRestoreLogFields(t *testing.T) {
+	action, hook := newTestVMRestoreAction(t, nil)
+
+	_, err := action.Execute(newRestoreInput(t, withGroupName(newVM("vm-1"), "group-1")))
+	require.NoError(t, err)
+
+	assert.Equal(t, logrus.Fields{
+		"action":    VMRestorePluginName,
+		"restore":   "restore-1",
+		"namespace": testNamespace,
+		"vm":        "vm-1",
+	}, entryWithMessage(t, hook, "Processing VirtualMachine").Data)
+	assert.Equal(t, logrus.Fields{
+		"action":    VMRestorePluginName,
+		"restore":   "restore-1",
+		"namespace": testNamespace,
+		"vm":        "vm-1",
+		"group":     "group-1",
+	}, entryWithMessage(t, hook, "VirtualMachine belongs to VirtualMachineGroup").Data)
+}
+
+func TestVMRestoreForceFirstBoot(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   map[string]string
+		expected map[string]string
+	}{
+		{name: "default", expected: map[string]string{"example.com/owner": "team-a"}},
+		{name: "enabled", config: map[string]string{forceFirstBootConfigKey: "true"}, expected: map[string]string{"example.com/owner": "team-a"}},
+		{
+			name:     "disabled",
+			config:   map[string]string{forceFirstBootConfigKey: "false"},
+			expected: map[string]string{vmopv1.FirstBootDoneAnnotation: "true", "example.com/owner": "team-a"},
+		},
+		{
+			name:     "disabled with first-boot-done listed explicitly",
+			config:   map[string]string{forceFirstBootConfigKey: "false", removeAnnotationsConfigKey: vmopv1.FirstBootDoneAnnotation + ",example.com/owner"},
+			expected: map[string]string{vmopv1.FirstBootDoneAnnotation: "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Annotations = map[string]string{vmopv1.FirstBootDoneAnnotation: "true", "example.com/owner": "team-a"}
+
+			_, obj := executeVMRestore(t, tt.config, vm)
+			assert.Equal(t, tt.expected, restoredVM(t, obj).Annotations)
+		})
+	}
+}
+
+func TestVMRestoreInvalidForceFirstBoot(t *testing.T) {
+	action, _ := newTestVMRestoreAction(t, map[string]string{forceFirstBootConfigKey: "maybe"})
+	_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	assert.ErrorContains(t, err, forceFirstBootConfigKey)
+}
+
+func TestVMRestoreWarnOnMissingNetwork(t *testing.T) {
+	action, hook := newTestVMRestoreAction(t, nil)
+
+	output, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	require.NoError(t, err)
+
+	// The VM is still restored, without an IP to preserve
+	assert.False(t, output.SkipRestore)
+	vm := restoredVM(t, output.UpdatedItem.UnstructuredContent())
+	assert.Nil(t, vm.Spec.Network)
+	assert.NotContains(t, vm.Annotations, preservedIPAnnotation)
+
+	// The output has no warnings, so the restore log is the only place the VM is reported
+	assert.Equal(t, []string{"VM vm-ns/vm-1 has no status.network.config - cannot inject network config, its IP may not be preserved"}, warnings(hook))
+}
+
+// withNetworkConfigAt moves the status.network.config of a VM to the dotted path
+func withNetworkConfigAt(t *testing.T, vm *vmopv1.VirtualMachine, path string) *unstructured.Unstructured {
+	t.Helper()
+
+	obj := toUnstructured(t, vm)
+	config, found, err := unstructured.NestedMap(obj.Object, "status", "network", "config")
+	require.NoError(t, err)
+	require.True(t, found)
+	unstructured.RemoveNestedField(obj.Object, "status", "network", "config")
+	require.NoError(t, unstructured.SetNestedMap(obj.Object, config, strings.Split(path, ".")...))
+	return obj
+}
+
+func TestVMRestoreStatusNetworkConfigPaths(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       map[string]string
+		path         string
+		expectedPath string
+	}{
+		{
+			name:         "default layout",
+			config:       map[string]string{statusNetworkConfigPathsConfigKey: "status.networkConfig"},
+			path:         "status.network.config",
+			expectedPath: "status.network.config",
+		},
+		{
+			name:         "fallback layout",
+			config:       map[string]string{statusNetworkConfigPathsConfigKey: "status.networkConfig"},
+			path:         "status.networkConfig",
+			expectedPath: "status.networkConfig",
+		},
+		{
+			name:         "later fallback layout",
+			config:       map[string]string{statusNetworkConfigPathsConfigKey: "status.networkConfig, status.guest.network"},
+			path:         "status.guest.network",
+			expectedPath: "status.guest.network",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+			action, hook := newTestVMRestoreAction(t, tc.config)
+
+			output, err := action.Execute(newRestoreInput(t, withNetworkConfigAt(t, vm, tc.path)))
+			require.NoError(t, err)
+
+			network := restoredVM(t, output.UpdatedItem.UnstructuredContent()).Spec.Network
+			require.NotNil(t, network)
+			require.Len(t, network.Interfaces, 1)
+			assert.Equal(t, []string{"192.168.1.10/24"}, network.Interfaces[0].Addresses)
+
+			entry := entryWithMessage(t, hook, "Injecting network configuration")
+			assert.Equal(t, tc.expectedPath, entry.Data["path"])
+		})
+	}
+}
+
+func TestVMRestoreStatusNetworkConfigPathNotConfigured(t *testing.T) {
+	vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+	action, hook := newTestVMRestoreAction(t, nil)
+
+	output, err := action.Execute(newRestoreInput(t, withNetworkConfigAt(t, vm, "status.networkConfig")))
+	require.NoError(t, err)
+
+	assert.Nil(t, restoredVM(t, output.UpdatedItem.UnstructuredContent()).Spec.Network)
+	entryWithMessage(t, hook, "VM vm-ns/vm-1 has no status.network.config - cannot inject network config, its IP may not be preserved")
+}
+
+func TestVMRestoreStatusNetworkConfigPathsMissing(t *testing.T) {
+	action, hook := newTestVMRestoreAction(t, map[string]string{statusNetworkConfigPathsConfigKey: "status.networkConfig"})
+
+	_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+	require.NoError(t, err)
+
+	entryWithMessage(t, hook, "VM vm-ns/vm-1 has no status.network.config or status.networkConfig - cannot inject network config, its IP may not be preserved")
+}
+
+func TestVMRestoreInvalidStatusNetworkConfigPaths(t *testing.T) {
+	for _, value := range []string{"spec.network", "status..config", "status."} {
+		t.Run(value, func(t *testing.T) {
+			action, _ := newTestVMRestoreAction(t, map[string]string{statusNetworkConfigPathsConfigKey: value})
+
+			_, err := action.Execute(newRestoreInput(t, newVM("vm-1")))
+			assert.ErrorContains(t, err, "invalid statusNetworkConfigPaths config")
+		})
+	}
+}
+
+func TestVMRestoreNetworkInjectionRerun(t *testing.T) {
+	injected := []vmopv1.VirtualMachineNetworkInterfaceSpec{{Name: "eth0", Addresses: []string{"192.168.1.10/24"}, Gateway4: "192.168.1.1"}}
+
+	tests := []struct {
+		name     string
+		spec     *vmopv1.VirtualMachineNetworkSpec
+		expected *vmopv1.VirtualMachineNetworkSpec
+	}{
+		{
+			name: "absent",
+			expected: &vmopv1.VirtualMachineNetworkSpec{
+				HostName:    "vm-1",
+				Nameservers: []string{"10.0.0.2"},
+				Interfaces:  injected,
+			},
+		},
+		{
+			name: "partial",
+			spec: &vmopv1.VirtualMachineNetworkSpec{Nameservers: []string{"10.0.0.53"}, SearchDomains: []string{"example.com"}},
+			expected: &vmopv1.VirtualMachineNetworkSpec{
+				HostName:      "vm-1",
+				Nameservers:   []string{"10.0.0.53"},
+				SearchDomains: []string{"example.com"},
+				Interfaces:    injected,
+			},
+		},
+		{
+			name: "empty",
+			spec: &vmopv1.VirtualMachineNetworkSpec{},
+			expected: &vmopv1.VirtualMachineNetworkSpec{
+				HostName:    "vm-1",
+				Nameservers: []string{"10.0.0.2"},
+				Interfaces:  injected,
+			},
+		},
+		{
+			name:     "fully present",
+			spec:     &vmopv1.VirtualMachineNetworkSpec{Interfaces: []vmopv1.VirtualMachineNetworkInterfaceSpec{{Name: "eth0", DHCP4: true}}},
+			expected: &vmopv1.VirtualMachineNetworkSpec{Interfaces: []vmopv1.VirtualMachineNetworkInterfaceSpec{{Name: "eth0", DHCP4: true}}},
+		},
+		{
+			name:     "disabled",
+			spec:     &vmopv1.VirtualMachineNetworkSpec{Disabled: true},
+			expected: &vmopv1.VirtualMachineNetworkSpec{Disabled: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+			vm.Status.Network.Config.DNS = &vmopv1.VirtualMachineNetworkConfigDNSStatus{HostName: "vm-1", Nameservers: []string{"10.0.0.2"}}
+			vm.Spec.Network = tt.spec
+
+			_, obj := executeVMRestore(t, nil, vm)
+			restored := restoredVM(t, obj)
+			assert.Equal(t, tt.expected, restored.Spec.Network)
+
+			// Restoring the restored VM again changes nothing
+			_, again := executeVMRestore(t, map[string]string{clearStatusConfigKey: "false"}, withNetworkConfigStatus(restored, vm.Status.Network.Config.Interfaces...))
+			assert.Equal(t, tt.expected, restoredVM(t, again).Spec.Network)
+		})
+	}
+}
+
+func TestVMRestoreEmptySpecNetwork(t *testing.T) {
+	// spec.network values as they may appear in a backup, counting as absent
+	for name, specNetwork := range map[string]interface{}{
+		"empty map":        map[string]interface{}{},
+		"empty interfaces": map[string]interface{}{"interfaces": []interface{}{}},
+		"null":             nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+			input := newRestoreInput(t, vm)
+			require.NoError(t, unstructured.SetNestedField(input.Item.UnstructuredContent(), specNetwork, "spec", "network"))
+
+			action, _ := newTestVMRestoreAction(t, nil)
+			output, err := action.Execute(input)
+			require.NoError(t, err)
+
+			network := restoredVM(t, output.UpdatedItem.UnstructuredContent()).Spec.Network
+			require.NotNil(t, network)
+			require.Len(t, network.Interfaces, 1)
+			assert.Equal(t, []string{"192.168.1.10/24"}, network.Interfaces[0].Addresses)
+		})
+	}
+}
+
+func TestVMRestoreReturnsWorkingObject(t *testing.T) {
+	// Nothing to change: the output still wraps the object the action worked on
+	unchanged := map[string]string{
+		restoreLabelConfigKey:         "",
+		clearStatusConfigKey:          "false",
+		preserveInstanceUUIDConfigKey: "true",
+	}
+
+	tests := []struct {
+		name   string
+		config map[string]string
+		check  func(t *testing.T, obj map[string]interface{})
+	}{
+		{
+			name:   "unchanged",
+			config: unchanged,
+			check: func(t *testing.T, obj map[string]interface{}) {
+				assert.Equal(t, "50123456-789a-bcde-f012-3456789abcde", nestedString(obj, "spec", "instanceUUID"))
+			},
+		},
+		{
+			name:   "mutated",
+			config: map[string]string{restoreLabelConfigKey: "", clearStatusConfigKey: "false"},
+			check: func(t *testing.T, obj map[string]interface{}) {
+				assert.Empty(t, nestedString(obj, "spec", "instanceUUID"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vm := newVM("vm-1")
+			vm.Spec.InstanceUUID = "50123456-789a-bcde-f012-3456789abcde"
+			input := newRestoreInput(t, vm)
+
+			action, _ := newTestVMRestoreAction(t, tt.config)
+			output, err := action.Execute(input)
+			require.NoError(t, err)
+
+			assert.NotSame(t, input.Item, output.UpdatedItem, "the output should wrap the working object")
+			tt.check(t, output.UpdatedItem.UnstructuredContent())
+		})
+	}
+}
+
+func TestVMRestorePreservedIPAnnotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		vm       func() *vmopv1.VirtualMachine
+		expected string
+	}{
+		{
+			name: "injected",
+			vm: func() *vmopv1.VirtualMachine {
+				vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "fd00::1", "192.168.1.10/24", "fd00::10/64"))
+				vm.Status.Network.PrimaryIP4 = "192.168.1.10"
+				vm.Status.Network.PrimaryIP6 = "fd00::10"
+				return vm
+			},
+			expected: "192.168.1.10,fd00::10",
+		},
+		{
+			name: "no network config",
+			vm:   func() *vmopv1.VirtualMachine { return newVM("vm-1") },
+		},
+		{
+			name: "skipped",
+			vm: func() *vmopv1.VirtualMachine {
+				vm := withNetworkConfigStatus(newVM("vm-1"), staticInterface("eth0", "192.168.1.1", "", "192.168.1.10/24"))
+				vm.Status.Network.PrimaryIP4 = "192.168.1.10"
+				vm.Annotations = map[string]string{skipNetworkInjectionAnnotation: "true"}
+				return vm
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, hook := newTestVMRestoreAction(t, nil)
+			output, err := action.Execute(newRestoreInput(t, tt.vm()))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, restoredVM(t, output.UpdatedItem.UnstructuredContent()).Annotations[preservedIPAnnotation])
+
+			entry := entryWithMessage(t, hook, "VirtualMachine prepared for restore")
+			assert.Equal(t, tt.expected, entry.Data["preservedIP"])
+		})
+	}
+}